@@ -0,0 +1,132 @@
+package function
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"crypto/subtle"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Admin API keys. APP_SECRET_PASSWORD holds a single key, used exactly as
+// given and named "default". APP_SECRET_KEYS holds a comma separated list of
+// further keys and APP_SECRET_PASSWORD_FILE names a file with one key per
+// line (blank lines and # comments are ignored). Keys in either list may be
+// written name:key so logs identify the caller by name; unnamed ones are
+// called key1, key2, ... in order. All configured keys are accepted, so a key
+// is rotated by adding the new one, moving clients over, then removing the
+// old one.
+
+// apiKey is a configured admin key; only its hash is kept in memory
+type apiKey struct {
+	name string
+	hash [sha256.Size]byte
+}
+
+// parseAPIKeys parses keys from entries, naming unnamed ones from index on
+func parseAPIKeys(entries []string, index int) []apiKey {
+	var keys []apiKey
+	for _, entry := range entries {
+		entry = strings.TrimSpace(entry)
+		if entry == "" || strings.HasPrefix(entry, "#") {
+			continue
+		}
+		index++
+		name, secret, named := strings.Cut(entry, ":")
+		if !named {
+			name, secret = fmt.Sprintf("key%d", index), entry
+		}
+		if secret == "" {
+			continue
+		}
+		keys = append(keys, apiKey{name: name, hash: sha256.Sum256([]byte(secret))})
+	}
+	return keys
+}
+
+var (
+	apiKeyFileMu      sync.Mutex
+	apiKeyFilePath    string
+	apiKeyFileModTime time.Time
+	apiKeyFileEntries []string
+)
+
+// readAPIKeyFile returns the lines of the key file, re-reading it only when
+// it changes so keys can be rotated without a restart
+func readAPIKeyFile(path string) ([]string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	apiKeyFileMu.Lock()
+	defer apiKeyFileMu.Unlock()
+	if path == apiKeyFilePath && info.ModTime().Equal(apiKeyFileModTime) {
+		return apiKeyFileEntries, nil
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var entries []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		entries = append(entries, scanner.Text())
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	apiKeyFilePath, apiKeyFileModTime, apiKeyFileEntries = path, info.ModTime(), entries
+	return entries, nil
+}
+
+// adminAPIKeys returns every configured admin key
+func adminAPIKeys() ([]apiKey, error) {
+	var keys []apiKey
+	if secret := os.Getenv("APP_SECRET_PASSWORD"); secret != "" {
+		keys = append(keys, apiKey{name: "default", hash: sha256.Sum256([]byte(secret))})
+	}
+	listed := parseAPIKeys(strings.Split(os.Getenv("APP_SECRET_KEYS"), ","), 0)
+	keys = append(keys, listed...)
+	if path := os.Getenv("APP_SECRET_PASSWORD_FILE"); path != "" {
+		entries, err := readAPIKeyFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("reading APP_SECRET_PASSWORD_FILE: %w", err)
+		}
+		keys = append(keys, parseAPIKeys(entries, len(listed))...)
+	}
+	return keys, nil
+}
+
+// matchAPIKey returns the name of the key equal to secret. Every key is
+// compared in constant time so timing reveals neither the key nor which matched.
+func matchAPIKey(keys []apiKey, secret string) (string, bool) {
+	hash := sha256.Sum256([]byte(secret))
+	name, found := "", 0
+	for _, key := range keys {
+		if subtle.ConstantTimeCompare(hash[:], key.hash[:]) == 1 {
+			name, found = key.name, 1
+		}
+	}
+	return name, found == 1
+}
+
+// AuthConfigured reports whether any credential source is configured. With
+// none, or a broken one, WorkoutAPI refuses every request rather than
+// running open.
+func AuthConfigured() (bool, error) {
+	if jwtSetupErr != nil {
+		return false, jwtSetupErr
+	}
+	keys, err := adminAPIKeys()
+	if err != nil {
+		return false, err
+	}
+	return len(keys) > 0 || jwtVerifier != nil, nil
+}
@@ -0,0 +1,121 @@
+package function
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAdminAPIKeys(t *testing.T) {
+	tests := []struct {
+		name     string
+		password string
+		keys     string
+		file     string
+		accept   map[string]string // Secret to key name
+		reject   []string
+	}{
+		{
+			name:     "password is one opaque key",
+			password: "s3cret,with:separators",
+			accept:   map[string]string{"s3cret,with:separators": "default"},
+			reject:   []string{"s3cret", "with:separators", "separators"},
+		},
+		{
+			name:   "named and unnamed keys",
+			keys:   "ci:ci-secret, ops-secret ,,",
+			accept: map[string]string{"ci-secret": "ci", "ops-secret": "key2"},
+			reject: []string{"ci", "ci:ci-secret", ""},
+		},
+		{
+			name:     "every source",
+			password: "legacy",
+			keys:     "ci:ci-secret",
+			file:     "# rotated 2024-05-01\nops:ops-secret\n\nspare-secret\n",
+			accept:   map[string]string{"legacy": "default", "ci-secret": "ci", "ops-secret": "ops", "spare-secret": "key3"},
+			reject:   []string{"# rotated 2024-05-01", "ops"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("APP_SECRET_PASSWORD", tt.password)
+			t.Setenv("APP_SECRET_KEYS", tt.keys)
+			t.Setenv("APP_SECRET_PASSWORD_FILE", "")
+			if tt.file != "" {
+				path := filepath.Join(t.TempDir(), "keys")
+				if err := os.WriteFile(path, []byte(tt.file), 0o600); err != nil {
+					t.Fatal(err)
+				}
+				t.Setenv("APP_SECRET_PASSWORD_FILE", path)
+			}
+
+			keys, err := adminAPIKeys()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(keys) != len(tt.accept) {
+				t.Errorf("got %d keys, want %d", len(keys), len(tt.accept))
+			}
+			for secret, want := range tt.accept {
+				if name, ok := matchAPIKey(keys, secret); !ok || name != want {
+					t.Errorf("matchAPIKey(%q) = %q, %v, want %q", secret, name, ok, want)
+				}
+			}
+			for _, secret := range tt.reject {
+				if name, ok := matchAPIKey(keys, secret); ok {
+					t.Errorf("matchAPIKey(%q) accepted as %q", secret, name)
+				}
+			}
+		})
+	}
+}
+
+func TestAPIKeyFileReload(t *testing.T) {
+	useMemoryBackend(t)
+	t.Setenv("APP_SECRET_PASSWORD", "")
+	path := filepath.Join(t.TempDir(), "keys")
+	t.Setenv("APP_SECRET_PASSWORD_FILE", path)
+	handler := NewHandler(NewMemoryBackend())
+
+	write := func(content string, modTime time.Time) {
+		t.Helper()
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(path, modTime, modTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+	status := func(key string) int {
+		t.Helper()
+		return request(t, handler, "GET", "/indoor_sessions", "", "x-api-key", key).Code
+	}
+
+	modTime := time.Now().Add(-time.Hour).Truncate(time.Second)
+	write("old:old-secret\n", modTime)
+	if got := status("old-secret"); got != 200 {
+		t.Fatalf("old key: got %d, want 200", got)
+	}
+
+	// Rotation adds the new key, then removes the old one
+	write("old:old-secret\nnew:new-secret\n", modTime.Add(time.Second))
+	if got := status("new-secret"); got != 200 {
+		t.Errorf("new key after adding it: got %d, want 200", got)
+	}
+	write("new:new-secret\n", modTime.Add(2*time.Second))
+	if got := status("old-secret"); got != 401 {
+		t.Errorf("old key after removing it: got %d, want 401", got)
+	}
+	if got := status("new-secret"); got != 200 {
+		t.Errorf("new key after removing the old one: got %d, want 200", got)
+	}
+
+	// The file is only re-read when its modification time changes
+	write(strings.Repeat("x", len("new:new-secret\n")), modTime.Add(2*time.Second))
+	if got := status("new-secret"); got != 200 {
+		t.Errorf("new key after an edit keeping the mtime: got %d, want the cached keys", got)
+	}
+}
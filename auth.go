@@ -0,0 +1,82 @@
+package function
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+)
+
+// Principal is the authenticated caller of a request
+type Principal struct {
+	// UserID owns every session the request reads or writes. It is empty
+	// for admin keys, which use the shared top-level collections.
+	UserID string
+	// Admin callers may manage users and tokens
+	Admin bool
+	// Name identifies the credential in logs: the admin key's name, the API
+	// token's ID or the bearer token's subject
+	Name string
+	// Scopes restrict a scoped API token; nil allows everything
+	Scopes []string
+}
+
+// errUnauthenticated means the request carried no valid credentials
+var errUnauthenticated = errors.New("missing or invalid API key")
+
+// authenticate resolves the request's credentials to a Principal. When
+// JWT_JWKS enables bearer tokens and no x-api-key is sent, the Authorization
+// header must carry a JWT whose subject is the user. Otherwise Authorization
+// is ignored, so a proxy such as Google IAM may use it for its own ID token,
+// and an x-api-key matching an admin key (see adminAPIKeys) is the admin
+// while any other key must be a user's API token.
+func authenticate(ctx context.Context, r *http.Request, users UserStore) (Principal, error) {
+	clientKey := r.Header.Get("x-api-key")
+	if auth := r.Header.Get("Authorization"); auth != "" && clientKey == "" && jwtVerifier != nil {
+		return authenticateBearer(ctx, jwtVerifier, auth)
+	}
+
+	if clientKey == "" {
+		return Principal{}, errUnauthenticated
+	}
+	keys, err := adminAPIKeys()
+	if err != nil {
+		return Principal{}, err
+	}
+	if name, ok := matchAPIKey(keys, clientKey); ok {
+		return Principal{Admin: true, Name: name}, nil
+	}
+
+	token, err := users.TokenByHash(ctx, hashToken(clientKey))
+	if errors.Is(err, ErrNotFound) {
+		return Principal{}, errUnauthenticated
+	}
+	if err != nil {
+		return Principal{}, err
+	}
+	return Principal{UserID: token.UserID, Name: token.ID, Scopes: token.Scopes}, nil
+}
+
+// authenticateBearer verifies an "Authorization: Bearer <jwt>" header
+func authenticateBearer(ctx context.Context, verifier *JWTVerifier, auth string) (Principal, error) {
+	scheme, token, _ := strings.Cut(auth, " ")
+	if !strings.EqualFold(scheme, "Bearer") || token == "" {
+		return Principal{}, errUnauthenticated
+	}
+	subject, err := verifier.Verify(ctx, strings.TrimSpace(token))
+	if errors.Is(err, errInvalidToken) {
+		return Principal{}, errUnauthenticated
+	}
+	if err != nil {
+		return Principal{}, err
+	}
+	return Principal{UserID: subject, Name: subject}, nil
+}
+
+type principalKey struct{}
+
+// PrincipalFromContext returns the caller authenticated by WorkoutAPI
+func PrincipalFromContext(ctx context.Context) Principal {
+	p, _ := ctx.Value(principalKey{}).(Principal)
+	return p
+}
@@ -0,0 +1,262 @@
+package function
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// MaxBatchOperations caps the number of operations in one POST /batch. An
+// operation writes at most two documents, the session and its tombstone, so
+// a batch stays within the 500 writes Firestore allows in one transaction.
+const MaxBatchOperations = 250
+
+// BatchOperation is one queued mutation replayed through POST /batch
+type BatchOperation struct {
+	Op       string          `json:"op"`       // create, update (create or replace, like PUT) or delete
+	Resource string          `json:"resource"` // e.g. indoor_sessions
+	ID       string          `json:"id,omitempty"`
+	TempID   string          `json:"tempId,omitempty"`  // Client ID for a create, usable as id by later operations
+	Data     json.RawMessage `json:"data,omitempty"`    // The *SessionInput body for create and update
+	IfMatch  string          `json:"ifMatch,omitempty"` // Optional ETag precondition for update and delete
+}
+
+// BatchRequest is the body of POST /batch
+type BatchRequest struct {
+	Operations []BatchOperation `json:"operations"`
+}
+
+// BatchResult reports the outcome of one operation, in request order
+type BatchResult struct {
+	Index   int         `json:"index"`
+	Status  int         `json:"status"` // The HTTP status the equivalent single request would return
+	ID      string      `json:"id,omitempty"`
+	TempID  string      `json:"tempId,omitempty"`
+	Session interface{} `json:"session,omitempty"`
+	Error   *APIError   `json:"error,omitempty"`
+}
+
+// BatchResponse is returned by POST /batch
+type BatchResponse struct {
+	Results []BatchResult     `json:"results"`
+	IDs     map[string]string `json:"ids"` // Client temp ID -> server ID for every create, empty if the batch failed
+}
+
+// sessionInput is implemented by every *SessionInput type
+type sessionInput[T any] interface {
+	Validate() *ValidationError
+	toSession() T
+	applyTo(s *T)
+}
+
+// batchResource applies batch operations to one collection
+type batchResource struct {
+	create func(ctx context.Context, data json.RawMessage) (interface{}, string, error)
+	update func(ctx context.Context, id, ifMatch string, data json.RawMessage) (interface{}, bool, error)
+	remove func(ctx context.Context, id, ifMatch string) error
+}
+
+func newBatchResource[T any, In sessionInput[T], P recordPtr[T]](store SessionStore[T]) batchResource {
+	decode := func(data json.RawMessage) (In, error) {
+		var input In
+		if err := json.Unmarshal(data, &input); err != nil {
+			return input, errInvalidBody
+		}
+		if verr := input.Validate(); verr != nil {
+			return input, verr
+		}
+		return input, nil
+	}
+
+	return batchResource{
+		create: func(ctx context.Context, data json.RawMessage) (interface{}, string, error) {
+			input, err := decode(data)
+			if err != nil {
+				return nil, "", err
+			}
+			session, err := store.Create(ctx, input.toSession())
+			if err != nil {
+				return nil, "", err
+			}
+			return session, P(&session).getID(), nil
+		},
+		update: func(ctx context.Context, id, ifMatch string, data json.RawMessage) (interface{}, bool, error) {
+			input, err := decode(data)
+			if err != nil {
+				return nil, false, err
+			}
+			return store.Put(ctx, id, func(s *T, exists bool) error {
+				if err := putPreconditions[T, P](ifMatch, "", s, exists); err != nil {
+					return err
+				}
+				input.applyTo(s)
+				return nil
+			})
+		},
+		remove: func(ctx context.Context, id, ifMatch string) error {
+			return store.Delete(ctx, id, ifMatchCheck[T, P](ifMatch))
+		},
+	}
+}
+
+var (
+	errInvalidBody = errors.New("invalid request body")
+	errInvalidID   = errors.New("invalid session ID")
+
+	// errBatchFailed aborts the transaction of a batch with a failed operation
+	errBatchFailed = errors.New("batch operation failed")
+)
+
+// HandleBatch applies a list of create, update and delete operations across
+// any of the five collections in one transaction: either every operation is
+// applied or none is. Operations run in order, and updates and deletes may
+// refer to an earlier create by its tempId. An update replaces the session
+// like PUT /{resource}/{id}, creating it if the ID is unused, so a queued
+// update still lands when the session was never synced.
+//
+// A committed batch returns 200 with a result per operation. Otherwise the
+// response has the failing operation's status, its result carries the
+// error and every other operation is reported as 424 not_applied.
+func HandleBatch(w http.ResponseWriter, r *http.Request, stores *Stores) {
+	ctx, span := startHandlerSpan(r, "HandleBatch", "")
+	defer span.End()
+
+	var req BatchRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, r, http.StatusBadRequest, CodeInvalidBody, "Invalid request body")
+		return
+	}
+	if len(req.Operations) > MaxBatchOperations {
+		writeError(w, r, http.StatusBadRequest, CodeInvalidBody, fmt.Sprintf("A batch may contain at most %d operations", MaxBatchOperations))
+		return
+	}
+
+	var resp BatchResponse
+	failed := -1
+	err := stores.RunTransaction(ctx, func(tx *Stores) error {
+		resp, failed = applyBatch(ctx, tx, req.Operations)
+		if failed >= 0 {
+			return errBatchFailed
+		}
+		return nil
+	})
+
+	status := http.StatusOK
+	switch {
+	case errors.Is(err, errBatchFailed):
+		status = resp.Results[failed].Status
+		for i, op := range req.Operations {
+			if i != failed {
+				resp.Results[i] = BatchResult{Index: i, Status: http.StatusFailedDependency, TempID: op.TempID, Error: &APIError{
+					Code:    CodeNotApplied,
+					Message: fmt.Sprintf("Not applied because operation %d failed", failed),
+				}}
+			}
+		}
+		resp.IDs = map[string]string{}
+	case err != nil:
+		logFor(ctx).Error("batch failed", "error", err)
+		writeError(w, r, http.StatusInternalServerError, CodeInternal, "Failed to apply batch")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(resp)
+}
+
+// applyBatch runs operations against the stores of a transaction until one
+// fails, returning the results so far and the index of the failed
+// operation, or -1 if all succeeded
+func applyBatch(ctx context.Context, stores *Stores, operations []BatchOperation) (BatchResponse, int) {
+	principal := PrincipalFromContext(ctx)
+	resources := map[string]batchResource{
+		"indoor_sessions":      newBatchResource[IndoorSession, IndoorSessionInput](stores.Indoor),
+		"outdoor_sessions":     newBatchResource[OutdoorSession, OutdoorSessionInput](stores.Outdoor),
+		"fingerboard_sessions": newBatchResource[FingerboardSession, FingerboardSessionInput](stores.Fingerboard),
+		"competition_sessions": newBatchResource[CompetitionSession, CompetitionSessionInput](stores.Competition),
+		"gym_sessions":         newBatchResource[GymSession, GymSessionInput](stores.Gym),
+	}
+
+	resp := BatchResponse{Results: make([]BatchResult, len(operations)), IDs: map[string]string{}}
+	for i, op := range operations {
+		result := BatchResult{Index: i, TempID: op.TempID}
+
+		id := op.ID
+		if serverID, ok := resp.IDs[id]; ok {
+			id = serverID
+		}
+
+		res, ok := resources[op.Resource]
+		var err error
+		switch {
+		case ctx.Err() != nil:
+			err = ctx.Err()
+		case !ok:
+			result.Status, result.Error = http.StatusBadRequest, &APIError{Code: CodeInvalidBody, Message: "Unknown resource " + op.Resource}
+		case !principal.Allows(op.Resource, true):
+			err = errForbidden
+		case op.Op == "create":
+			result.Session, result.ID, err = res.create(ctx, op.Data)
+			result.Status = http.StatusCreated
+			if err == nil && op.TempID != "" {
+				resp.IDs[op.TempID] = result.ID
+			}
+		case op.Op == "update" && id != "":
+			result.ID = id
+			var created bool
+			if !ValidSessionID(id) {
+				err = errInvalidID
+			} else if result.Session, created, err = res.update(ctx, id, op.IfMatch, op.Data); created {
+				result.Status = http.StatusCreated
+			} else {
+				result.Status = http.StatusOK
+			}
+		case op.Op == "delete" && id != "":
+			result.ID = id
+			err = res.remove(ctx, id, op.IfMatch)
+			result.Status = http.StatusNoContent
+		default:
+			result.Status, result.Error = http.StatusBadRequest, &APIError{Code: CodeInvalidBody, Message: "Operation must be create, or update or delete with an id"}
+		}
+
+		if err != nil {
+			result.Session = nil
+			result.Status, result.Error = batchError(err)
+			if result.Status == http.StatusInternalServerError {
+				logFor(ctx).Error("batch operation failed", "index", i, "op", op.Op, "collection", op.Resource, "session", id, "error", err)
+			}
+			if status, ctxErr := contextError(ctx); ctxErr != nil {
+				result.Status, result.Error = status, ctxErr
+			}
+		}
+		resp.Results[i] = result
+		if result.Error != nil {
+			return resp, i
+		}
+	}
+	return resp, -1
+}
+
+// batchError maps an operation failure to the status and error a single request would get
+func batchError(err error) (int, *APIError) {
+	var verr *ValidationError
+	switch {
+	case errors.As(err, &verr):
+		return http.StatusUnprocessableEntity, &APIError{Code: CodeValidationFailed, Message: "Validation failed", Fields: verr.Fields}
+	case errors.Is(err, errInvalidBody):
+		return http.StatusBadRequest, &APIError{Code: CodeInvalidBody, Message: "Invalid request body"}
+	case errors.Is(err, errInvalidID):
+		return http.StatusBadRequest, &APIError{Code: CodeInvalidParameter, Message: invalidSessionIDMessage}
+	case errors.Is(err, ErrNotFound):
+		return http.StatusNotFound, &APIError{Code: CodeNotFound, Message: "Session not found"}
+	case errors.Is(err, errForbidden):
+		return http.StatusForbidden, &APIError{Code: CodeForbidden, Message: "API key is not permitted to perform this operation"}
+	case errors.Is(err, errPreconditionFailed):
+		return http.StatusPreconditionFailed, &APIError{Code: CodePreconditionFailed, Message: "Session has been modified, fetch it again"}
+	default:
+		return http.StatusInternalServerError, &APIError{Code: CodeInternal, Message: "Failed to apply operation"}
+	}
+}
@@ -0,0 +1,221 @@
+package function
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testBackends returns a constructor for every backend that runs in tests
+func testBackends() map[string]func(*testing.T) Backend {
+	return map[string]func(*testing.T) Backend{
+		"memory": func(*testing.T) Backend { return NewMemoryBackend() },
+		"sqlite": func(t *testing.T) Backend { return NewSQLiteBackend(openTestSQLite(t)) },
+	}
+}
+
+// postBatch sends operations to POST /batch as the admin
+func postBatch(t *testing.T, handler http.Handler, operations string) (*httptest.ResponseRecorder, BatchResponse) {
+	t.Helper()
+	r := httptest.NewRequest("POST", "/batch", strings.NewReader(`{"operations":`+operations+`}`))
+	r.Header.Set("x-api-key", testAdminKey)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+
+	var resp BatchResponse
+	if w.Code < 500 && !strings.Contains(w.Body.String(), `"error":{`) {
+		decode(t, w, &resp)
+	}
+	return w, resp
+}
+
+// countSessions returns the number of sessions listed under resource
+func countSessions(t *testing.T, handler http.Handler, resource string) int {
+	t.Helper()
+	r := httptest.NewRequest("GET", "/"+resource, nil)
+	r.Header.Set("x-api-key", testAdminKey)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	var sessions []json.RawMessage
+	decode(t, w, &sessions)
+	return len(sessions)
+}
+
+func TestBatch(t *testing.T) {
+	useMemoryBackend(t)
+
+	for name, newBackend := range storeBackends() {
+		t.Run(name, func(t *testing.T) {
+			handler := NewHandler(newBackend(t))
+
+			w, resp := postBatch(t, handler, `[
+				{"op": "create", "resource": "indoor_sessions", "tempId": "t1", "data": {"date": "2024-05-01"}},
+				{"op": "update", "resource": "indoor_sessions", "id": "t1", "data": {"date": "2024-05-01", "notes": "edited"}},
+				{"op": "create", "resource": "gym_sessions", "tempId": "t2", "data": {"date": "2024-05-02", "name": "Legs"}},
+				{"op": "delete", "resource": "gym_sessions", "id": "t2"},
+				{"op": "update", "resource": "outdoor_sessions", "id": "client-chosen", "data": {"date": "2024-05-03", "crag": "Stanage"}}
+			]`)
+			if w.Code != http.StatusOK {
+				t.Fatalf("batch: got %d %s", w.Code, w.Body.String())
+			}
+			wantStatus := []int{http.StatusCreated, http.StatusOK, http.StatusCreated, http.StatusNoContent, http.StatusCreated}
+			for i, want := range wantStatus {
+				if got := resp.Results[i].Status; got != want {
+					t.Errorf("results[%d].status = %d, want %d: %+v", i, got, want, resp.Results[i].Error)
+				}
+			}
+			if resp.IDs["t1"] == "" || resp.Results[1].ID != resp.IDs["t1"] {
+				t.Errorf("tempId t1 not resolved: ids %v, update id %q", resp.IDs, resp.Results[1].ID)
+			}
+			if n := countSessions(t, handler, "indoor_sessions"); n != 1 {
+				t.Errorf("indoor sessions = %d, want 1", n)
+			}
+			if n := countSessions(t, handler, "gym_sessions"); n != 0 {
+				t.Errorf("gym sessions = %d, want 0", n)
+			}
+			if n := countSessions(t, handler, "outdoor_sessions"); n != 1 {
+				t.Errorf("outdoor sessions = %d, want 1", n)
+			}
+
+			// Updating the session created above replaces it rather than creating another
+			w, resp = postBatch(t, handler, `[
+				{"op": "update", "resource": "outdoor_sessions", "id": "client-chosen", "data": {"date": "2024-05-03", "crag": "Froggatt"}}
+			]`)
+			if w.Code != http.StatusOK || resp.Results[0].Status != http.StatusOK {
+				t.Errorf("replace: got %d %s", w.Code, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestBatchIsAtomic(t *testing.T) {
+	useMemoryBackend(t)
+
+	tests := []struct {
+		name       string
+		operations string
+		failed     int
+		status     int
+		code       string
+	}{
+		{
+			name: "validation",
+			operations: `[
+				{"op": "create", "resource": "indoor_sessions", "tempId": "t1", "data": {"date": "2024-05-01"}},
+				{"op": "create", "resource": "gym_sessions", "data": {"date": "2024-05-02"}},
+				{"op": "create", "resource": "fingerboard_sessions", "data": {"date": "not a date"}},
+				{"op": "create", "resource": "outdoor_sessions", "data": {"date": "2024-05-04"}}
+			]`,
+			failed: 2, status: http.StatusUnprocessableEntity, code: CodeValidationFailed,
+		},
+		{
+			name: "missing delete",
+			operations: `[
+				{"op": "create", "resource": "indoor_sessions", "data": {"date": "2024-05-01"}},
+				{"op": "delete", "resource": "gym_sessions", "id": "missing"}
+			]`,
+			failed: 1, status: http.StatusNotFound, code: CodeNotFound,
+		},
+		{
+			name: "precondition on create",
+			operations: `[
+				{"op": "create", "resource": "indoor_sessions", "data": {"date": "2024-05-01"}},
+				{"op": "update", "resource": "indoor_sessions", "id": "new-id", "ifMatch": "\"stale\"", "data": {"date": "2024-05-01"}}
+			]`,
+			failed: 1, status: http.StatusPreconditionFailed, code: CodePreconditionFailed,
+		},
+		{
+			name: "unknown resource",
+			operations: `[
+				{"op": "update", "resource": "indoor_sessions", "id": "new-id", "data": {"date": "2024-05-01"}},
+				{"op": "create", "resource": "nope", "data": {}}
+			]`,
+			failed: 1, status: http.StatusBadRequest, code: CodeInvalidBody,
+		},
+	}
+
+	for name, newBackend := range storeBackends() {
+		for _, tt := range tests {
+			t.Run(name+"/"+tt.name, func(t *testing.T) {
+				handler := NewHandler(newBackend(t))
+
+				w, resp := postBatch(t, handler, tt.operations)
+				if w.Code != tt.status {
+					t.Fatalf("batch: got %d %s, want %d", w.Code, w.Body.String(), tt.status)
+				}
+				if len(resp.IDs) != 0 {
+					t.Errorf("ids = %v, want none", resp.IDs)
+				}
+				for i, result := range resp.Results {
+					switch {
+					case i == tt.failed:
+						if result.Status != tt.status || result.Error == nil || result.Error.Code != tt.code {
+							t.Errorf("results[%d] = %d %+v, want %d %s", i, result.Status, result.Error, tt.status, tt.code)
+						}
+					case result.Status != http.StatusFailedDependency || result.Error == nil || result.Error.Code != CodeNotApplied:
+						t.Errorf("results[%d] = %d %+v, want 424 %s", i, result.Status, result.Error, CodeNotApplied)
+					case result.Session != nil:
+						t.Errorf("results[%d] has a session although nothing was applied", i)
+					}
+				}
+				for _, resource := range Resources {
+					if n := countSessions(t, handler, resource); n != 0 {
+						t.Errorf("%s has %d sessions after a failed batch", resource, n)
+					}
+				}
+			})
+		}
+	}
+}
+
+func TestBatchRollsBackDeletes(t *testing.T) {
+	useMemoryBackend(t)
+
+	for name, newBackend := range storeBackends() {
+		t.Run(name, func(t *testing.T) {
+			handler := NewHandler(newBackend(t))
+			_, resp := postBatch(t, handler, `[{"op": "create", "resource": "indoor_sessions", "tempId": "a", "data": {"date": "2024-05-01"}}]`)
+			id := resp.IDs["a"]
+
+			w, _ := postBatch(t, handler, fmt.Sprintf(`[
+				{"op": "delete", "resource": "indoor_sessions", "id": %q},
+				{"op": "delete", "resource": "indoor_sessions", "id": %q}
+			]`, id, id))
+			if w.Code != http.StatusNotFound {
+				t.Fatalf("deleting twice: got %d %s", w.Code, w.Body.String())
+			}
+			if n := countSessions(t, handler, "indoor_sessions"); n != 1 {
+				t.Errorf("indoor sessions = %d after a failed batch, want 1", n)
+			}
+
+			// The rolled back delete left no tombstone behind
+			since := time.Now().Add(-time.Hour).UTC().Format(time.RFC3339)
+			r := httptest.NewRequest("GET", "/indoor_sessions?includeDeleted=true&since="+since, nil)
+			r.Header.Set("x-api-key", testAdminKey)
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, r)
+			if rec.Code != http.StatusOK {
+				t.Fatalf("list deletions: got %d %s", rec.Code, rec.Body.String())
+			}
+			var page sessionPage[IndoorSession]
+			decode(t, rec, &page)
+			if len(page.Deleted) != 0 {
+				t.Errorf("deleted = %+v, want none", page.Deleted)
+			}
+		})
+	}
+}
+
+func TestBatchTooLarge(t *testing.T) {
+	useMemoryBackend(t)
+
+	ops := strings.Repeat(`{"op": "create", "resource": "indoor_sessions", "data": {"date": "2024-05-01"}},`, MaxBatchOperations+1)
+	w, _ := postBatch(t, NewHandler(NewMemoryBackend()), "["+strings.TrimSuffix(ops, ",")+"]")
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("batch of %d: got %d, want 400", MaxBatchOperations+1, w.Code)
+	}
+}
@@ -0,0 +1,148 @@
+// Command server serves the WorkoutAPI routes as a standalone HTTP server,
+// for running outside Cloud Functions (Docker, a VPS, local development).
+//
+// Configuration comes from flags, each of which defaults to an environment
+// variable. The storage backend is selected by STORAGE_BACKEND as for the
+// Cloud Function, and tracing by the OTEL_* variables (see
+// function.SetupTracing). Prometheus metrics are served on /metrics to scrapers
+// presenting METRICS_TOKEN as a bearer token.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	function "github.com/yourname/func-workout-api"
+)
+
+func main() {
+	slog.SetDefault(function.NewLogger(os.Stdout))
+	if err := run(); err != nil {
+		slog.Error("server stopped", "error", err)
+		os.Exit(1)
+	}
+}
+
+// run serves until SIGINT or SIGTERM. It returns errors rather than exiting
+// so deferred cleanup, such as closing the storage backend, always runs.
+func run() error {
+	var envErr error
+	envDuration := func(key string, def time.Duration) time.Duration {
+		d, err := parseEnvDuration(key, def)
+		if err != nil && envErr == nil {
+			envErr = err
+		}
+		return d
+	}
+	addr := flag.String("addr", envOr("ADDR", ":"+envOr("PORT", "8080")), "listen address (env ADDR, or PORT)")
+	readTimeout := flag.Duration("read-timeout", envDuration("READ_TIMEOUT", 15*time.Second), "maximum duration for reading a request (env READ_TIMEOUT)")
+	writeTimeout := flag.Duration("write-timeout", envDuration("WRITE_TIMEOUT", 30*time.Second), "maximum duration for writing a response (env WRITE_TIMEOUT)")
+	idleTimeout := flag.Duration("idle-timeout", envDuration("IDLE_TIMEOUT", 60*time.Second), "keep-alive idle timeout (env IDLE_TIMEOUT)")
+	shutdownTimeout := flag.Duration("shutdown-timeout", envDuration("SHUTDOWN_TIMEOUT", 20*time.Second), "grace period for in-flight requests on shutdown (env SHUTDOWN_TIMEOUT)")
+	flag.Parse()
+	if envErr != nil {
+		return envErr
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	// Refuse to start without credentials rather than serve requests that will all fail
+	if err := function.SetupJWT(); err != nil {
+		return err
+	}
+	if configured, err := function.AuthConfigured(); err != nil {
+		return fmt.Errorf("failed to load API keys: %w", err)
+	} else if !configured {
+		return errors.New("no credentials configured: set APP_SECRET_PASSWORD, APP_SECRET_KEYS, APP_SECRET_PASSWORD_FILE or JWT_JWKS")
+	}
+
+	shutdownTracing, err := function.SetupTracing()
+	if err != nil {
+		return fmt.Errorf("failed to set up tracing: %w", err)
+	}
+	defer shutdownTracing(context.Background())
+
+	// Fail fast on a misconfigured backend instead of on the first request
+	if _, err := function.GetBackend(ctx); err != nil {
+		return fmt.Errorf("failed to open storage backend: %w", err)
+	}
+	// Runs after Shutdown has drained in-flight requests
+	defer func() {
+		if err := function.CloseBackend(); err != nil {
+			slog.Error("failed to close storage backend", "error", err)
+		}
+	}()
+
+	// Prometheus metrics sit beside the API on /metrics, behind METRICS_TOKEN
+	metrics := function.MetricsHandler()
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/metrics" {
+			metrics.ServeHTTP(w, r)
+			return
+		}
+		function.WorkoutAPI(w, r)
+	})
+	if os.Getenv("METRICS_TOKEN") == "" {
+		slog.Warn("METRICS_TOKEN is not set, /metrics will refuse scrapes")
+	}
+
+	srv := &http.Server{
+		Addr:              *addr,
+		Handler:           handler,
+		ReadTimeout:       *readTimeout,
+		ReadHeaderTimeout: *readTimeout,
+		WriteTimeout:      *writeTimeout,
+		IdleTimeout:       *idleTimeout,
+	}
+
+	errc := make(chan error, 1)
+	go func() {
+		slog.Info("listening", "addr", *addr)
+		errc <- srv.ListenAndServe()
+	}()
+
+	select {
+	case err := <-errc:
+		if !errors.Is(err, http.ErrServerClosed) {
+			return fmt.Errorf("server error: %w", err)
+		}
+	case <-ctx.Done():
+		slog.Info("shutting down")
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), *shutdownTimeout)
+		defer cancel()
+		if err := srv.Shutdown(shutdownCtx); err != nil {
+			return fmt.Errorf("graceful shutdown failed: %w", err)
+		}
+	}
+	return nil
+}
+
+// envOr returns the environment variable key, or def when it is unset
+func envOr(key, def string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return def
+}
+
+// parseEnvDuration parses the environment variable key as a time.Duration, or returns def
+func parseEnvDuration(key string, def time.Duration) (time.Duration, error) {
+	v := os.Getenv(key)
+	if v == "" {
+		return def, nil
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		return def, fmt.Errorf("invalid duration in %s: %w", key, err)
+	}
+	return d, nil
+}
@@ -0,0 +1,104 @@
+package function
+
+import (
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CORS policy, read from the environment on each request:
+//
+//	CORS_ALLOWED_ORIGINS    comma separated origins, e.g. https://app.example.com;
+//	                        https://*.example.com matches any subdomain and * any origin
+//	CORS_ALLOW_CREDENTIALS  "true" to allow cookies and HTTP auth on cross-origin requests
+//	                        from listed origins; never for origins matched only by *
+//	CORS_MAX_AGE            how long browsers may cache a preflight, default 10m
+//
+// Requests from origins not on the list get no CORS headers, so browsers
+// block them. With no list configured, cross-origin access is disabled.
+const (
+	DefaultCORSMaxAge = 10 * time.Minute
+
+	corsAllowMethods  = "GET, POST, PUT, PATCH, DELETE, OPTIONS"
+	corsAllowHeaders  = "Authorization, Content-Type, Idempotency-Key, If-Match, If-None-Match, X-Request-ID, x-api-key"
+	corsExposeHeaders = "ETag, Idempotent-Replayed, Retry-After, X-Request-ID"
+)
+
+func init() {
+	warnCORSConfig()
+}
+
+// warnCORSConfig logs a warning when CORS_ALLOW_CREDENTIALS is set alongside
+// a * entry, since any website could then act with a visitor's credentials.
+// Credentials are only ever sent for origins listed explicitly.
+func warnCORSConfig() {
+	if os.Getenv("CORS_ALLOW_CREDENTIALS") != "true" {
+		return
+	}
+	for _, allowed := range strings.Split(os.Getenv("CORS_ALLOWED_ORIGINS"), ",") {
+		if strings.TrimSpace(allowed) == "*" {
+			logger.Warn("CORS_ALLOW_CREDENTIALS does not apply to origins matched by * in CORS_ALLOWED_ORIGINS; list trusted origins explicitly")
+			return
+		}
+	}
+}
+
+// setCORSHeaders sets the CORS headers for requests from an allowed origin
+func setCORSHeaders(w http.ResponseWriter, r *http.Request) {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return
+	}
+	w.Header().Add("Vary", "Origin") // The response depends on the origin, so caches must key on it
+	allowed, wildcard := originAllowed(origin, os.Getenv("CORS_ALLOWED_ORIGINS"))
+	if !allowed {
+		return
+	}
+
+	h := w.Header()
+	h.Set("Access-Control-Allow-Origin", origin)
+	if !wildcard && os.Getenv("CORS_ALLOW_CREDENTIALS") == "true" {
+		h.Set("Access-Control-Allow-Credentials", "true")
+	}
+	h.Set("Access-Control-Expose-Headers", corsExposeHeaders)
+
+	if r.Method == "OPTIONS" && r.Header.Get("Access-Control-Request-Method") != "" {
+		h.Set("Access-Control-Allow-Methods", corsAllowMethods)
+		h.Set("Access-Control-Allow-Headers", corsAllowHeaders)
+		h.Set("Access-Control-Max-Age", strconv.Itoa(int(corsMaxAge().Seconds())))
+	}
+}
+
+// originAllowed reports whether origin matches an entry of the comma
+// separated allowlist, and whether it matched only the * entry
+func originAllowed(origin, allowlist string) (allowed, wildcard bool) {
+	for _, entry := range strings.Split(allowlist, ",") {
+		entry = strings.TrimSpace(entry)
+		switch {
+		case entry == "":
+		case entry == "*":
+			wildcard = true
+		case strings.EqualFold(entry, origin):
+			return true, false
+		case strings.Contains(entry, "://*."):
+			// https://*.example.com matches https://app.example.com but not https://example.com
+			scheme, domain, _ := strings.Cut(entry, "://*")
+			if strings.HasPrefix(strings.ToLower(origin), strings.ToLower(scheme)+"://") &&
+				strings.HasSuffix(strings.ToLower(origin), strings.ToLower(domain)) &&
+				len(origin) > len(scheme)+3+len(domain) {
+				return true, false
+			}
+		}
+	}
+	return wildcard, wildcard
+}
+
+// corsMaxAge returns the configured preflight cache duration
+func corsMaxAge() time.Duration {
+	if d, err := time.ParseDuration(os.Getenv("CORS_MAX_AGE")); err == nil && d >= 0 {
+		return d
+	}
+	return DefaultCORSMaxAge
+}
@@ -0,0 +1,67 @@
+package function
+
+import (
+	"bytes"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestCORSCredentials(t *testing.T) {
+	useMemoryBackend(t)
+	t.Setenv("CORS_ALLOW_CREDENTIALS", "true")
+	t.Setenv("CORS_ALLOWED_ORIGINS", "https://app.example.com, https://*.trusted.com, *")
+
+	tests := []struct {
+		origin      string
+		credentials bool
+	}{
+		{"https://app.example.com", true},
+		{"https://ci.trusted.com", true},
+		{"https://evil.example.org", false}, // Matched only by *
+	}
+	for _, tt := range tests {
+		t.Run(tt.origin, func(t *testing.T) {
+			r := httptest.NewRequest("OPTIONS", "/indoor_sessions", nil)
+			r.Header.Set("Origin", tt.origin)
+			r.Header.Set("Access-Control-Request-Method", "PUT")
+			w := httptest.NewRecorder()
+			setCORSHeaders(w, r)
+
+			h := w.Header()
+			if got := h.Get("Access-Control-Allow-Origin"); got != tt.origin {
+				t.Errorf("Access-Control-Allow-Origin = %q, want %q", got, tt.origin)
+			}
+			if got := h.Get("Access-Control-Allow-Credentials") == "true"; got != tt.credentials {
+				t.Errorf("credentials allowed = %v, want %v", got, tt.credentials)
+			}
+			if !strings.Contains(h.Get("Access-Control-Allow-Headers"), "If-None-Match") {
+				t.Errorf("Access-Control-Allow-Headers = %q, want If-None-Match", h.Get("Access-Control-Allow-Headers"))
+			}
+			if !strings.Contains(h.Get("Access-Control-Expose-Headers"), "Idempotent-Replayed") {
+				t.Errorf("Access-Control-Expose-Headers = %q, want Idempotent-Replayed", h.Get("Access-Control-Expose-Headers"))
+			}
+		})
+	}
+}
+
+func TestWarnCORSConfig(t *testing.T) {
+	useMemoryBackend(t)
+	var logs bytes.Buffer
+	logger = NewLogger(&logs)
+	t.Cleanup(func() { logger = NewLogger(io.Discard) })
+
+	t.Setenv("CORS_ALLOW_CREDENTIALS", "true")
+	t.Setenv("CORS_ALLOWED_ORIGINS", "https://app.example.com")
+	warnCORSConfig()
+	if logs.Len() != 0 {
+		t.Errorf("warned about an explicit allowlist: %s", logs.String())
+	}
+
+	t.Setenv("CORS_ALLOWED_ORIGINS", "https://app.example.com, *")
+	warnCORSConfig()
+	if !strings.Contains(logs.String(), `"severity":"WARNING"`) {
+		t.Errorf("no warning for credentials with *: %q", logs.String())
+	}
+}
@@ -0,0 +1,51 @@
+package function
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"time"
+)
+
+// DefaultRequestTimeout bounds every request unless REQUEST_TIMEOUT overrides
+// it. It is below both the Cloud Functions default timeout and the standalone
+// server's write timeout so a slow request still gets its 504 delivered.
+const DefaultRequestTimeout = 25 * time.Second
+
+// StatusClientClosedRequest is the non-standard status, borrowed from nginx,
+// recorded for requests abandoned by the client. The client never sees it.
+const StatusClientClosedRequest = 499
+
+// RequestTimeout returns the configured per-request deadline; REQUEST_TIMEOUT=0
+// disables it
+func RequestTimeout() time.Duration {
+	if d, err := time.ParseDuration(os.Getenv("REQUEST_TIMEOUT")); err == nil && d >= 0 {
+		return d
+	}
+	return DefaultRequestTimeout
+}
+
+// withDeadline bounds the request's context by RequestTimeout. The context is
+// already cancelled when the client disconnects, and every store call runs
+// under it, so abandoned or overdue requests stop their database work.
+func withDeadline(r *http.Request) (*http.Request, context.CancelFunc) {
+	timeout := RequestTimeout()
+	if timeout == 0 {
+		return r, func() {}
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), timeout)
+	return r.WithContext(ctx), cancel
+}
+
+// contextError reports the status and error for a request whose context has
+// ended, so a failure caused by it is not mistaken for an internal error
+func contextError(ctx context.Context) (int, *APIError) {
+	switch err := ctx.Err(); {
+	case errors.Is(err, context.DeadlineExceeded):
+		return http.StatusGatewayTimeout, &APIError{Code: CodeTimeout, Message: "Request timed out"}
+	case errors.Is(err, context.Canceled):
+		return StatusClientClosedRequest, &APIError{Code: CodeClientClosedRequest, Message: "Client closed request"}
+	}
+	return 0, nil
+}
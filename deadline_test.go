@@ -0,0 +1,173 @@
+package function
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// interruptedContext calls interrupt on the n-th check of its Done channel or
+// Err, so a test can end a store call's context at each point it looks
+type interruptedContext struct {
+	context.Context
+	n         int
+	interrupt func()
+
+	mu     sync.Mutex
+	checks int
+}
+
+func (c *interruptedContext) check() {
+	c.mu.Lock()
+	c.checks++
+	trip := c.checks == c.n
+	c.mu.Unlock()
+	if trip {
+		c.interrupt()
+	}
+}
+
+func (c *interruptedContext) Done() <-chan struct{} {
+	c.check()
+	return c.Context.Done()
+}
+
+func (c *interruptedContext) Err() error {
+	c.check()
+	return c.Context.Err()
+}
+
+// createIndoorSessions stores n indoor sessions with climbs, so reading each
+// one back from SQLite queries a child table too
+func createIndoorSessions(t *testing.T, store SessionStore[IndoorSession], n int) {
+	t.Helper()
+	for i := 0; i < n; i++ {
+		body := fmt.Sprintf(`{"date":"2024-05-%02d","climbs":[{"grade":"6a"},{"grade":"6b"}]}`, i+1)
+		if _, err := store.Create(context.Background(), newTestSession[IndoorSession](t, body)); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// TestListCancelled cancels List at every point it checks its context and
+// checks it returns the context's error rather than a partial page, and
+// leaves the store usable: the test SQLite database has a single connection,
+// so a leaked transaction or rows would block the next List and a stray
+// interrupt would fail it.
+func TestListCancelled(t *testing.T) {
+	const count = 5
+	for name, newBackend := range testBackends() {
+		t.Run(name, func(t *testing.T) {
+			store := newBackend(t).Stores("").Indoor
+			createIndoorSessions(t, store, count)
+
+			for n := 1; ; n++ {
+				if n > 10000 {
+					t.Fatal("List never completed")
+				}
+				ctx, cancel := context.WithCancel(context.Background())
+				sessions, err := store.List(&interruptedContext{Context: ctx, n: n, interrupt: cancel}, ListOptions{})
+				cancel()
+				if err == nil {
+					if len(sessions) != count {
+						t.Fatalf("List = %d sessions, want %d", len(sessions), count)
+					}
+					// Every session was read under a context the store checked
+					if n <= count {
+						t.Errorf("List checked its context %d times for %d sessions", n-1, count)
+					}
+					return
+				}
+				if !errors.Is(err, context.Canceled) {
+					t.Fatalf("cancelled at check %d: got %v, want context.Canceled", n, err)
+				}
+				if sessions != nil {
+					t.Fatalf("cancelled at check %d: got %d sessions with the error", n, len(sessions))
+				}
+
+				ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+				sessions, err = store.List(ctx, ListOptions{})
+				cancel()
+				if err != nil || len(sessions) != count {
+					t.Fatalf("List after cancelling at check %d: got %d sessions, %v", n, len(sessions), err)
+				}
+			}
+		})
+	}
+}
+
+// interruptingBackend interrupts the request partway through listing
+// indoor sessions
+type interruptingBackend struct {
+	Backend
+	interrupt func(ctx context.Context)
+}
+
+func (b interruptingBackend) Stores(userID string) *Stores {
+	stores := *b.Backend.Stores(userID)
+	stores.Indoor = interruptingStore{stores.Indoor, b.interrupt}
+	return &stores
+}
+
+type interruptingStore struct {
+	SessionStore[IndoorSession]
+	interrupt func(ctx context.Context)
+}
+
+func (s interruptingStore) List(ctx context.Context, opts ListOptions) ([]IndoorSession, error) {
+	return s.SessionStore.List(&interruptedContext{Context: ctx, n: 3, interrupt: func() { s.interrupt(ctx) }}, opts)
+}
+
+func TestListInterruptedStatus(t *testing.T) {
+	useMemoryBackend(t)
+	t.Setenv("REQUEST_TIMEOUT", "100ms")
+
+	for name, newBackend := range testBackends() {
+		t.Run(name+"/deadline", func(t *testing.T) {
+			backend := newBackend(t)
+			createIndoorSessions(t, backend.Stores("").Indoor, 5)
+			// The list stalls until the request's deadline passes
+			handler := NewHandler(interruptingBackend{backend, func(ctx context.Context) { <-ctx.Done() }})
+
+			w := serveList(handler, context.Background())
+			assertListError(t, w, http.StatusGatewayTimeout, CodeTimeout)
+		})
+
+		t.Run(name+"/client closed", func(t *testing.T) {
+			backend := newBackend(t)
+			createIndoorSessions(t, backend.Stores("").Indoor, 5)
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			// The client disconnects while the sessions are being read
+			handler := NewHandler(interruptingBackend{backend, func(context.Context) { cancel() }})
+
+			w := serveList(handler, ctx)
+			assertListError(t, w, StatusClientClosedRequest, CodeClientClosedRequest)
+		})
+	}
+}
+
+func serveList(handler http.Handler, ctx context.Context) *httptest.ResponseRecorder {
+	r := httptest.NewRequest("GET", "/indoor_sessions", nil).WithContext(ctx)
+	r.Header.Set("x-api-key", testAdminKey)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	return w
+}
+
+func assertListError(t *testing.T, w *httptest.ResponseRecorder, status int, code string) {
+	t.Helper()
+	if w.Code != status {
+		t.Fatalf("got %d %s, want %d", w.Code, w.Body.String(), status)
+	}
+	var resp errorResponse
+	decode(t, w, &resp)
+	if resp.Error.Code != code {
+		t.Errorf("error code = %q, want %q", resp.Error.Code, code)
+	}
+}
@@ -0,0 +1,89 @@
+package function
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+)
+
+// Error codes returned in the "code" field of every error response. Clients
+// should match on these rather than on the human readable message.
+const (
+	CodeUnauthorized         = "unauthorized"
+	CodeForbidden            = "forbidden"
+	CodeNotFound             = "not_found"
+	CodeMethodNotAllowed     = "method_not_allowed"
+	CodeInvalidBody          = "invalid_body"
+	CodeInvalidParameter     = "invalid_parameter"
+	CodeValidationFailed     = "validation_failed"
+	CodeResyncRequired       = "resync_required"
+	CodePreconditionFailed   = "precondition_failed"
+	CodeIdempotencyConflict  = "idempotency_conflict"
+	CodeNotApplied           = "not_applied"
+	CodePatchConflict        = "patch_conflict"
+	CodeUnsupportedMediaType = "unsupported_media_type"
+	CodeBodyTooLarge         = "body_too_large"
+	CodeRateLimited          = "rate_limited"
+	CodeInternal             = "internal"
+	CodeTimeout              = "timeout"
+	CodeClientClosedRequest  = "client_closed_request"
+	CodeNotConfigured        = "not_configured"
+	CodeDatabaseUnavailable  = "database_unavailable"
+)
+
+// APIError is the JSON error shape shared by every endpoint:
+//
+//	{"error": {"code": "not_found", "message": "Session not found", "requestId": "..."}}
+type APIError struct {
+	Code      string       `json:"code"`
+	Message   string       `json:"message"`
+	RequestID string       `json:"requestId,omitempty"`
+	Fields    []FieldError `json:"fields,omitempty"` // Only set for validation_failed
+}
+
+type errorResponse struct {
+	Error APIError `json:"error"`
+}
+
+// writeError responds with the given status and a JSON error envelope
+func writeError(w http.ResponseWriter, r *http.Request, status int, code, message string) {
+	writeAPIError(w, r, status, APIError{Code: code, Message: message})
+}
+
+func writeAPIError(w http.ResponseWriter, r *http.Request, status int, apiErr APIError) {
+	// A body rejected for running past its cap is too large rather than malformed
+	if status == http.StatusBadRequest && apiErr.Code == CodeInvalidBody {
+		if limit, ok := bodyTooLarge(r); ok {
+			status, apiErr = http.StatusRequestEntityTooLarge, bodyTooLargeError(limit)
+		}
+	}
+	// A store call cut short by the deadline or a disconnect is not an internal error
+	if status == http.StatusInternalServerError {
+		if ctxStatus, ctxErr := contextError(r.Context()); ctxErr != nil {
+			status, apiErr = ctxStatus, *ctxErr
+		}
+	}
+	apiErr.RequestID = RequestIDFromContext(r.Context())
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(errorResponse{Error: apiErr})
+}
+
+type requestIDKey struct{}
+
+// RequestIDFromContext returns the request ID assigned by WorkoutAPI, if any
+func RequestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// withRequestID tags the request with the caller's X-Request-ID, or a new ID
+// when none was sent, and echoes it back in the response header
+func withRequestID(w http.ResponseWriter, r *http.Request) *http.Request {
+	id := r.Header.Get("X-Request-ID")
+	if id == "" || len(id) > 128 {
+		id = newDocumentID()
+	}
+	w.Header().Set("X-Request-ID", id)
+	return r.WithContext(context.WithValue(r.Context(), requestIDKey{}, id))
+}
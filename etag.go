@@ -0,0 +1,70 @@
+package function
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// errPreconditionFailed means the If-Match header did not match the stored session
+var errPreconditionFailed = errors.New("session has been modified")
+
+// ETag returns the entity tag of a session last updated at updatedAt. It is
+// the quoted updatedAt exactly as the session JSON encodes it, so clients can
+// derive the ETag of any session in a list response without fetching it.
+func ETag(updatedAt time.Time) string {
+	return `"` + updatedAt.Format(time.RFC3339Nano) + `"`
+}
+
+// setETag sets the ETag header for a single session response
+func setETag[T any, P recordPtr[T]](w http.ResponseWriter, session P) {
+	w.Header().Set("ETag", ETag(session.getUpdatedAt()))
+}
+
+// checkIfMatch returns errPreconditionFailed unless the request's If-Match
+// header is absent, "*", or lists the session's current ETag. Stores call it
+// with the stored session inside the write transaction.
+func checkIfMatch[T any, P recordPtr[T]](ifMatch string, session P) error {
+	if ifMatch == "" || ifMatch == "*" {
+		return nil
+	}
+	etag := ETag(session.getUpdatedAt())
+	for _, tag := range strings.Split(ifMatch, ",") {
+		if strings.TrimSpace(tag) == etag {
+			return nil
+		}
+	}
+	return errPreconditionFailed
+}
+
+// ifMatchCheck returns a Delete check for the request's If-Match header, or
+// nil when the request is unconditional
+func ifMatchCheck[T any, P recordPtr[T]](ifMatch string) func(*T) error {
+	if ifMatch == "" {
+		return nil
+	}
+	return func(s *T) error { return checkIfMatch[T, P](ifMatch, s) }
+}
+
+// checkPutPreconditions applies If-Match and If-None-Match to a PUT that may
+// create the session. Any If-Match fails when there is no session yet, and
+// If-None-Match: * fails when there is one, so a client can insist on
+// creating rather than overwriting.
+func checkPutPreconditions[T any, P recordPtr[T]](r *http.Request, session P, exists bool) error {
+	return putPreconditions[T, P](r.Header.Get("If-Match"), r.Header.Get("If-None-Match"), session, exists)
+}
+
+// putPreconditions implements checkPutPreconditions for the given header values
+func putPreconditions[T any, P recordPtr[T]](ifMatch, ifNoneMatch string, session P, exists bool) error {
+	if !exists {
+		if ifMatch != "" {
+			return errPreconditionFailed
+		}
+		return nil
+	}
+	if ifNoneMatch == "*" {
+		return errPreconditionFailed
+	}
+	return checkIfMatch[T, P](ifMatch, session)
+}
@@ -0,0 +1,103 @@
+package function
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestIfMatch(t *testing.T) {
+	useMemoryBackend(t)
+	const stale = `"2000-01-01T00:00:00Z"`
+
+	tests := []struct {
+		method, body, contentType string
+		status                    int
+	}{
+		{"PUT", `{"date":"2024-05-02","notes":"put"}`, "application/json", http.StatusOK},
+		{"PATCH", `{"notes":"patched"}`, MergePatchMediaType, http.StatusOK},
+		{"DELETE", "", "", http.StatusNoContent},
+	}
+	for _, tt := range tests {
+		t.Run(tt.method, func(t *testing.T) {
+			handler := NewHandler(NewMemoryBackend())
+			w := request(t, handler, "POST", "/indoor_sessions", `{"date":"2024-05-01"}`)
+			if w.Code != http.StatusCreated {
+				t.Fatalf("create: got %d %s", w.Code, w.Body.String())
+			}
+			var created IndoorSession
+			decode(t, w, &created)
+			etag := w.Header().Get("ETag")
+			path := "/indoor_sessions/" + created.ID
+
+			w = request(t, handler, tt.method, path, tt.body, "Content-Type", tt.contentType, "If-Match", stale)
+			if w.Code != http.StatusPreconditionFailed {
+				t.Fatalf("stale If-Match: got %d %s, want 412", w.Code, w.Body.String())
+			}
+			if got := request(t, handler, "GET", path, ""); got.Header().Get("ETag") != etag {
+				t.Errorf("session changed by a failed precondition: ETag %s, want %s", got.Header().Get("ETag"), etag)
+			}
+
+			w = request(t, handler, tt.method, path, tt.body, "Content-Type", tt.contentType, "If-Match", etag)
+			if w.Code != tt.status {
+				t.Fatalf("matching If-Match: got %d %s, want %d", w.Code, w.Body.String(), tt.status)
+			}
+			if tt.method != "DELETE" && (w.Header().Get("ETag") == "" || w.Header().Get("ETag") == etag) {
+				t.Errorf("ETag after %s = %q, want a new tag", tt.method, w.Header().Get("ETag"))
+			}
+		})
+	}
+}
+
+func TestPutIfNoneMatch(t *testing.T) {
+	useMemoryBackend(t)
+	handler := NewHandler(NewMemoryBackend())
+
+	w := request(t, handler, "PUT", "/indoor_sessions/offline-1", `{"date":"2024-05-01"}`, "If-None-Match", "*")
+	if w.Code != http.StatusCreated {
+		t.Fatalf("create with If-None-Match: got %d %s", w.Code, w.Body.String())
+	}
+	w = request(t, handler, "PUT", "/indoor_sessions/offline-1", `{"date":"2024-05-02"}`, "If-None-Match", "*")
+	if w.Code != http.StatusPreconditionFailed {
+		t.Errorf("overwrite with If-None-Match: got %d %s, want 412", w.Code, w.Body.String())
+	}
+}
+
+func TestListETag(t *testing.T) {
+	useMemoryBackend(t)
+	handler := NewHandler(NewMemoryBackend())
+	listETag := func(query string) string {
+		t.Helper()
+		w := request(t, handler, "GET", "/indoor_sessions"+query, "")
+		if w.Code != http.StatusOK {
+			t.Fatalf("list: got %d %s", w.Code, w.Body.String())
+		}
+		return w.Header().Get("ETag")
+	}
+
+	var ids []string
+	for _, date := range []string{"2024-05-01", "2024-05-02"} {
+		w := request(t, handler, "POST", "/indoor_sessions", `{"date":"`+date+`"}`)
+		var created IndoorSession
+		decode(t, w, &created)
+		ids = append(ids, created.ID)
+	}
+
+	etag := listETag("")
+	if etag == "" || etag != listETag("") {
+		t.Fatalf("list ETag = %q, want the same tag for an unchanged list", etag)
+	}
+	if page := listETag("?limit=1"); page == "" || page == etag {
+		t.Errorf("page ETag = %q, want a tag of its own", page)
+	}
+
+	request(t, handler, "PATCH", "/indoor_sessions/"+ids[0], `{"notes":"edited"}`, "Content-Type", MergePatchMediaType)
+	updated := listETag("")
+	if updated == etag {
+		t.Errorf("list ETag unchanged after an update: %s", updated)
+	}
+
+	request(t, handler, "DELETE", "/indoor_sessions/"+ids[0], "")
+	if deleted := listETag(""); deleted == updated {
+		t.Errorf("list ETag unchanged after a delete: %s", deleted)
+	}
+}
@@ -2,9 +2,18 @@ package function
 
 import (
 	"context"
+	"reflect"
+	"sort"
+	"strings"
 	"sync"
+	"time"
 
 	"cloud.google.com/go/firestore"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/api/iterator"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
 const (
@@ -17,6 +26,17 @@ const (
 	FingerboardCollection = "Fingerboarding"
 	CompetitionCollection = "Competitions"
 	GymCollection         = "Gym_Sessions"
+
+	// Suffix of the collections holding deletion tombstones, e.g. Gym_Sessions_Deleted
+	TombstoneCollectionSuffix = "_Deleted"
+
+	// Users and their API tokens. Each user's sessions live in subcollections
+	// of their user document, e.g. users/{uid}/Indoor_Climbs.
+	UsersCollection  = "users"
+	TokensCollection = "api_tokens"
+
+	// Responses remembered for Idempotency-Key replay; expiresAt suits a TTL policy
+	IdempotencyCollection = "idempotency_keys"
 )
 
 var (
@@ -42,3 +62,694 @@ func GetCollection(client *firestore.Client) *firestore.CollectionRef {
 func GetCollectionByName(client *firestore.Client, name string) *firestore.CollectionRef {
 	return client.Collection(name)
 }
+
+// NewFirestoreStores returns Stores over the shared top-level collections
+func NewFirestoreStores(client *firestore.Client) *Stores {
+	return newFirestoreStores(client, func(name string) *firestore.CollectionRef {
+		return GetCollectionByName(client, name)
+	})
+}
+
+// newFirestoreStores returns Stores over the collections returned by col
+func newFirestoreStores(client *firestore.Client, col func(name string) *firestore.CollectionRef) *Stores {
+	indoor := &firestoreStore[IndoorSession, *IndoorSession]{client: client, col: col(IndoorCollection), resource: "indoor_sessions"}
+	outdoor := &firestoreStore[OutdoorSession, *OutdoorSession]{client: client, col: col(OutdoorCollection), resource: "outdoor_sessions"}
+	fingerboard := &firestoreStore[FingerboardSession, *FingerboardSession]{client: client, col: col(FingerboardCollection), resource: "fingerboard_sessions"}
+	competition := &firestoreStore[CompetitionSession, *CompetitionSession]{client: client, col: col(CompetitionCollection), resource: "competition_sessions"}
+	gym := &firestoreStore[GymSession, *GymSession]{client: client, col: col(GymCollection), resource: "gym_sessions"}
+
+	return &Stores{
+		Indoor:      indoor,
+		Outdoor:     outdoor,
+		Fingerboard: fingerboard,
+		Competition: competition,
+		Gym:         gym,
+		runTx: func(ctx context.Context, fn func(*Stores) error) error {
+			return client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+				ftx := &firestoreTx{tx: tx, docs: map[string]*stagedDoc{}}
+				err := fn(&Stores{
+					Indoor:      &firestoreTxStore[IndoorSession, *IndoorSession]{store: indoor, tx: ftx},
+					Outdoor:     &firestoreTxStore[OutdoorSession, *OutdoorSession]{store: outdoor, tx: ftx},
+					Fingerboard: &firestoreTxStore[FingerboardSession, *FingerboardSession]{store: fingerboard, tx: ftx},
+					Competition: &firestoreTxStore[CompetitionSession, *CompetitionSession]{store: competition, tx: ftx},
+					Gym:         &firestoreTxStore[GymSession, *GymSession]{store: gym, tx: ftx},
+				})
+				if err != nil {
+					return err
+				}
+				return ftx.commit()
+			})
+		},
+	}
+}
+
+// NewFirestoreBackend returns a Backend storing users, tokens and each
+// user's sessions in Firestore
+func NewFirestoreBackend(client *firestore.Client) Backend {
+	return &firestoreBackend{client: client}
+}
+
+type firestoreBackend struct {
+	client *firestore.Client
+}
+
+func (b *firestoreBackend) Users() UserStore { return &firestoreUsers{client: b.client} }
+
+func (b *firestoreBackend) Idempotency() IdempotencyStore {
+	return &firestoreIdempotency{client: b.client}
+}
+
+func (b *firestoreBackend) Stores(userID string) *Stores {
+	if userID == "" {
+		return NewFirestoreStores(b.client)
+	}
+	userDoc := b.client.Collection(UsersCollection).Doc(userID)
+	return newFirestoreStores(b.client, userDoc.Collection)
+}
+
+// firestoreIdempotency is an IdempotencyStore over the idempotency_keys collection
+type firestoreIdempotency struct {
+	client *firestore.Client
+}
+
+func (f *firestoreIdempotency) Reserve(ctx context.Context, rec IdempotencyRecord) (*IdempotencyRecord, error) {
+	docRef := f.client.Collection(IdempotencyCollection).Doc(rec.Key)
+	var existing *IdempotencyRecord
+	err := f.client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		existing = nil
+		doc, err := tx.Get(docRef)
+		if err == nil {
+			var stored IdempotencyRecord
+			if err := doc.DataTo(&stored); err == nil && !stored.ExpiresAt.Before(rec.CreatedAt) {
+				stored.Key = rec.Key
+				existing = &stored
+				return nil
+			}
+		} else if notFoundOr(err) != ErrNotFound {
+			return err
+		}
+		return tx.Set(docRef, rec)
+	})
+	return existing, err
+}
+
+func (f *firestoreIdempotency) Complete(ctx context.Context, rec IdempotencyRecord) error {
+	_, err := f.client.Collection(IdempotencyCollection).Doc(rec.Key).Set(ctx, rec)
+	return err
+}
+
+func (f *firestoreIdempotency) Release(ctx context.Context, key string) error {
+	_, err := f.client.Collection(IdempotencyCollection).Doc(key).Delete(ctx)
+	return err
+}
+
+// firestoreUsers is a UserStore over the users and api_tokens collections
+type firestoreUsers struct {
+	client *firestore.Client
+}
+
+func (u *firestoreUsers) CreateUser(ctx context.Context, name string) (User, error) {
+	user := User{Name: name, CreatedAt: storeNow()}
+	docRef, _, err := u.client.Collection(UsersCollection).Add(ctx, user)
+	if err != nil {
+		return user, err
+	}
+	user.ID = docRef.ID
+	return user, nil
+}
+
+func (u *firestoreUsers) GetUser(ctx context.Context, id string) (User, error) {
+	var user User
+	doc, err := u.client.Collection(UsersCollection).Doc(id).Get(ctx)
+	if err != nil {
+		return user, notFoundOr(err)
+	}
+	if err := doc.DataTo(&user); err != nil {
+		return user, err
+	}
+	user.ID = doc.Ref.ID
+	return user, nil
+}
+
+func (u *firestoreUsers) ListUsers(ctx context.Context) ([]User, error) {
+	docs, err := u.client.Collection(UsersCollection).OrderBy("createdAt", firestore.Asc).Documents(ctx).GetAll()
+	if err != nil {
+		return nil, err
+	}
+	var users []User
+	for _, doc := range docs {
+		var user User
+		if err := doc.DataTo(&user); err != nil {
+			skipMalformed(ctx, "users", doc, err)
+			continue
+		}
+		user.ID = doc.Ref.ID
+		users = append(users, user)
+	}
+	return users, nil
+}
+
+func (u *firestoreUsers) CreateToken(ctx context.Context, token APIToken) (APIToken, error) {
+	token.CreatedAt = storeNow()
+	docRef, _, err := u.client.Collection(TokensCollection).Add(ctx, token)
+	if err != nil {
+		return token, err
+	}
+	token.ID = docRef.ID
+	return token, nil
+}
+
+func (u *firestoreUsers) GetToken(ctx context.Context, id string) (APIToken, error) {
+	var token APIToken
+	doc, err := u.client.Collection(TokensCollection).Doc(id).Get(ctx)
+	if err != nil {
+		return token, notFoundOr(err)
+	}
+	if err := doc.DataTo(&token); err != nil {
+		return token, err
+	}
+	token.ID = doc.Ref.ID
+	return token, nil
+}
+
+func (u *firestoreUsers) ListTokens(ctx context.Context, userID string) ([]APIToken, error) {
+	docs, err := u.client.Collection(TokensCollection).Where("userId", "==", userID).Documents(ctx).GetAll()
+	if err != nil {
+		return nil, err
+	}
+	var tokens []APIToken
+	for _, doc := range docs {
+		var token APIToken
+		if err := doc.DataTo(&token); err != nil {
+			skipMalformed(ctx, "api_tokens", doc, err)
+			continue
+		}
+		token.ID = doc.Ref.ID
+		tokens = append(tokens, token)
+	}
+	// Sorted here rather than in the query to avoid a composite index
+	sort.Slice(tokens, func(i, j int) bool { return tokens[i].CreatedAt.Before(tokens[j].CreatedAt) })
+	return tokens, nil
+}
+
+func (u *firestoreUsers) RevokeToken(ctx context.Context, userID, id string) error {
+	docRef := u.client.Collection(TokensCollection).Doc(id)
+	return u.client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		doc, err := tx.Get(docRef)
+		if err != nil {
+			return notFoundOr(err)
+		}
+		var token APIToken
+		if err := doc.DataTo(&token); err != nil {
+			return err
+		}
+		if token.UserID != userID {
+			return ErrNotFound
+		}
+		return tx.Delete(docRef)
+	})
+}
+
+func (u *firestoreUsers) TokenByHash(ctx context.Context, hash string) (APIToken, error) {
+	var token APIToken
+	docs, err := u.client.Collection(TokensCollection).Where("hash", "==", hash).Limit(1).Documents(ctx).GetAll()
+	if err != nil {
+		return token, err
+	}
+	if len(docs) == 0 {
+		return token, ErrNotFound
+	}
+	if err := docs[0].DataTo(&token); err != nil {
+		return token, err
+	}
+	token.ID = docs[0].Ref.ID
+	return token, nil
+}
+
+// firestoreStore is a SessionStore over a single Firestore collection
+type firestoreStore[T any, P recordPtr[T]] struct {
+	client   *firestore.Client
+	col      *firestore.CollectionRef
+	resource string // e.g. indoor_sessions, for metrics
+}
+
+func (s *firestoreStore[T, P]) List(ctx context.Context, opts ListOptions) ([]T, error) {
+	var query firestore.Query
+	if !opts.Since.IsZero() {
+		// Incremental sync - strictly filter by modification time
+		query = s.col.Where("updatedAt", ">", opts.Since).OrderBy("updatedAt", firestore.Desc)
+	} else {
+		query = s.col.OrderBy("date", firestore.Desc)
+	}
+	query = query.OrderBy(firestore.DocumentID, firestore.Desc)
+
+	if opts.StartDate != "" {
+		query = query.Where("date", ">=", opts.StartDate)
+	}
+	if opts.EndDate != "" {
+		query = query.Where("date", "<=", opts.EndDate)
+	}
+	if opts.After != nil {
+		if !opts.Since.IsZero() {
+			query = query.StartAfter(opts.After.UpdatedAt, opts.After.ID)
+		} else {
+			query = query.StartAfter(opts.After.Date, opts.After.ID)
+		}
+	}
+	if opts.Limit > 0 {
+		query = query.Limit(opts.Limit)
+	}
+
+	iter := query.Documents(ctx)
+	defer iter.Stop()
+
+	var sessions []T
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		var session T
+		if err := doc.DataTo(&session); err != nil {
+			skipMalformed(ctx, s.resource, doc, err)
+			continue
+		}
+		P(&session).setID(doc.Ref.ID)
+		sessions = append(sessions, session)
+	}
+	return sessions, nil
+}
+
+func (s *firestoreStore[T, P]) Get(ctx context.Context, id string) (T, error) {
+	var session T
+	doc, err := s.col.Doc(id).Get(ctx)
+	if err != nil {
+		return session, notFoundOr(err)
+	}
+	if err := doc.DataTo(&session); err != nil {
+		return session, err
+	}
+	P(&session).setID(doc.Ref.ID)
+	return session, nil
+}
+
+func (s *firestoreStore[T, P]) Create(ctx context.Context, session T) (T, error) {
+	now := storeNow()
+	P(&session).setCreatedAt(now)
+	P(&session).setUpdatedAt(now)
+
+	docRef, _, err := s.col.Add(ctx, session)
+	if err != nil {
+		return session, err
+	}
+	P(&session).setID(docRef.ID)
+	return session, nil
+}
+
+func (s *firestoreStore[T, P]) Update(ctx context.Context, id string, apply func(*T) error) (T, error) {
+	var updated T
+	docRef := s.col.Doc(id)
+
+	err := s.client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		doc, err := tx.Get(docRef)
+		if err != nil {
+			return notFoundOr(err)
+		}
+
+		// Decode twice so apply cannot alias the original's slices
+		var current T
+		if err := doc.DataTo(&current); err != nil {
+			return err
+		}
+		updated = *new(T)
+		if err := doc.DataTo(&updated); err != nil {
+			return err
+		}
+		if err := apply(&updated); err != nil {
+			return err
+		}
+		P(&updated).setUpdatedAt(storeNow())
+
+		return tx.Update(docRef, changedFields(current, updated))
+	})
+	if err != nil {
+		return updated, err
+	}
+	P(&updated).setID(id)
+	return updated, nil
+}
+
+func (s *firestoreStore[T, P]) Put(ctx context.Context, id string, apply func(*T, bool) error) (T, bool, error) {
+	var session T
+	var created bool
+	docRef := s.col.Doc(id)
+
+	err := s.client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		session, created = *new(T), false
+		var current T
+		doc, err := tx.Get(docRef)
+		exists := err == nil
+		if exists {
+			if err := doc.DataTo(&current); err != nil {
+				return err
+			}
+			if err := doc.DataTo(&session); err != nil {
+				return err
+			}
+		} else if err = notFoundOr(err); err != ErrNotFound {
+			return err
+		}
+		if err := apply(&session, exists); err != nil {
+			return err
+		}
+
+		now := storeNow()
+		P(&session).setUpdatedAt(now)
+		if exists {
+			return tx.Update(docRef, changedFields(current, session))
+		}
+		created = true
+		P(&session).setCreatedAt(now)
+		if err := tx.Create(docRef, session); err != nil {
+			return err
+		}
+		return tx.Delete(s.tombstones().Doc(id))
+	})
+	if err != nil {
+		return session, false, err
+	}
+	P(&session).setID(id)
+	return session, created, nil
+}
+
+func (s *firestoreStore[T, P]) Delete(ctx context.Context, id string, check func(*T) error) error {
+	docRef := s.col.Doc(id)
+	return s.client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		doc, err := tx.Get(docRef)
+		if err != nil {
+			return notFoundOr(err)
+		}
+		if check != nil {
+			var current T
+			if err := doc.DataTo(&current); err != nil {
+				return err
+			}
+			if err := check(&current); err != nil {
+				return err
+			}
+		}
+		if err := tx.Delete(docRef); err != nil {
+			return err
+		}
+		return tx.Set(s.tombstones().Doc(id), Tombstone{ID: id, Collection: s.col.ID, DeletedAt: storeNow()})
+	})
+}
+
+func (s *firestoreStore[T, P]) Deleted(ctx context.Context, since time.Time) ([]Tombstone, error) {
+	iter := s.tombstones().Where("deletedAt", ">", since).OrderBy("deletedAt", firestore.Asc).Documents(ctx)
+	defer iter.Stop()
+
+	var tombstones []Tombstone
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		var t Tombstone
+		if err := doc.DataTo(&t); err != nil {
+			skipMalformed(ctx, s.resource, doc, err)
+			continue
+		}
+		tombstones = append(tombstones, t)
+	}
+	return tombstones, nil
+}
+
+func (s *firestoreStore[T, P]) PurgeTombstones(ctx context.Context, cutoff time.Time) error {
+	iter := s.tombstones().Where("deletedAt", "<", cutoff).Documents(ctx)
+	defer iter.Stop()
+
+	bw := s.client.BulkWriter(ctx)
+	defer bw.End()
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if _, err := bw.Delete(doc.Ref); err != nil {
+			return err
+		}
+	}
+}
+
+// tombstones is the sibling collection holding this collection's deletions,
+// keyed by session ID, e.g. Indoor_Climbs_Deleted
+func (s *firestoreStore[T, P]) tombstones() *firestore.CollectionRef {
+	if s.col.Parent != nil {
+		return s.col.Parent.Collection(s.col.ID + TombstoneCollectionSuffix) // Beside a user's own collection
+	}
+	return s.client.Collection(s.col.ID + TombstoneCollectionSuffix)
+}
+
+// firestoreTx stages the writes of a transaction spanning several
+// collections. Firestore requires every read of a transaction to come before
+// its first write, so documents are staged as they are read and changed, and
+// written by commit once the transaction function has returned.
+type firestoreTx struct {
+	tx    *firestore.Transaction
+	docs  map[string]*stagedDoc // By document path
+	order []*stagedDoc          // In the order they were first staged
+}
+
+// stagedDoc is the state of one document within a firestoreTx
+type stagedDoc struct {
+	ref      *firestore.DocumentRef
+	original interface{} // Session as read, nil if it did not exist
+	current  interface{} // Session to write, nil to delete
+	blind    bool        // Written without being read, e.g. a tombstone
+}
+
+func (t *firestoreTx) add(d *stagedDoc) {
+	t.docs[d.ref.Path] = d
+	t.order = append(t.order, d)
+}
+
+// set stages writing data to ref without reading it, or deleting ref if data is nil
+func (t *firestoreTx) set(ref *firestore.DocumentRef, data interface{}) {
+	d, ok := t.docs[ref.Path]
+	if !ok {
+		d = &stagedDoc{ref: ref}
+		t.add(d)
+	}
+	d.blind, d.current = true, data
+}
+
+// commit queues the staged writes on the transaction
+func (t *firestoreTx) commit() error {
+	for _, d := range t.order {
+		var err error
+		switch {
+		case d.blind && d.current == nil:
+			err = t.tx.Delete(d.ref)
+		case d.blind:
+			err = t.tx.Set(d.ref, d.current)
+		case d.original == nil && d.current == nil:
+			// Never existed, or created and deleted within the transaction
+		case d.original == nil:
+			err = t.tx.Create(d.ref, d.current)
+		case d.current == nil:
+			err = t.tx.Delete(d.ref)
+		default:
+			if updates := changedFields(d.original, d.current); len(updates) > 0 {
+				err = t.tx.Update(d.ref, updates)
+			}
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// firestoreTxStore is a SessionStore over store whose operations are staged
+// in a firestoreTx
+type firestoreTxStore[T any, P recordPtr[T]] struct {
+	store *firestoreStore[T, P]
+	tx    *firestoreTx
+}
+
+// load returns the staged state of session id, reading it on first use
+func (s *firestoreTxStore[T, P]) load(id string) (*stagedDoc, error) {
+	ref := s.store.col.Doc(id)
+	if d, ok := s.tx.docs[ref.Path]; ok {
+		return d, nil
+	}
+
+	d := &stagedDoc{ref: ref}
+	doc, err := s.tx.tx.Get(ref)
+	if err == nil {
+		// Decode twice so changes to current cannot alias original's slices
+		var original, current T
+		if err := doc.DataTo(&original); err != nil {
+			return nil, err
+		}
+		if err := doc.DataTo(&current); err != nil {
+			return nil, err
+		}
+		d.original, d.current = original, current
+	} else if err = notFoundOr(err); err != ErrNotFound {
+		return nil, err
+	}
+	s.tx.add(d)
+	return d, nil
+}
+
+func (s *firestoreTxStore[T, P]) List(ctx context.Context, opts ListOptions) ([]T, error) {
+	return nil, errNotInTransaction
+}
+
+func (s *firestoreTxStore[T, P]) Get(ctx context.Context, id string) (T, error) {
+	var session T
+	d, err := s.load(id)
+	if err != nil {
+		return session, err
+	}
+	if d.current == nil {
+		return session, ErrNotFound
+	}
+	session = d.current.(T)
+	P(&session).setID(id)
+	return session, nil
+}
+
+func (s *firestoreTxStore[T, P]) Create(ctx context.Context, session T) (T, error) {
+	now := storeNow()
+	P(&session).setCreatedAt(now)
+	P(&session).setUpdatedAt(now)
+
+	d := &stagedDoc{ref: s.store.col.NewDoc(), current: session}
+	s.tx.add(d)
+	P(&session).setID(d.ref.ID)
+	return session, nil
+}
+
+func (s *firestoreTxStore[T, P]) Update(ctx context.Context, id string, apply func(*T) error) (T, error) {
+	var updated T
+	d, err := s.load(id)
+	if err != nil {
+		return updated, err
+	}
+	if d.current == nil {
+		return updated, ErrNotFound
+	}
+	updated = d.current.(T)
+	if err := apply(&updated); err != nil {
+		return updated, err
+	}
+	P(&updated).setID(id)
+	P(&updated).setUpdatedAt(storeNow())
+
+	d.current = updated
+	return updated, nil
+}
+
+func (s *firestoreTxStore[T, P]) Put(ctx context.Context, id string, apply func(*T, bool) error) (T, bool, error) {
+	var session T
+	d, err := s.load(id)
+	if err != nil {
+		return session, false, err
+	}
+	exists := d.current != nil
+	if exists {
+		session = d.current.(T)
+	}
+	if err := apply(&session, exists); err != nil {
+		return session, false, err
+	}
+
+	now := storeNow()
+	P(&session).setID(id)
+	P(&session).setUpdatedAt(now)
+	if !exists {
+		P(&session).setCreatedAt(now)
+		s.tx.set(s.store.tombstones().Doc(id), nil)
+	}
+	d.current = session
+	return session, !exists, nil
+}
+
+func (s *firestoreTxStore[T, P]) Delete(ctx context.Context, id string, check func(*T) error) error {
+	d, err := s.load(id)
+	if err != nil {
+		return err
+	}
+	if d.current == nil {
+		return ErrNotFound
+	}
+	if check != nil {
+		current := d.current.(T)
+		if err := check(&current); err != nil {
+			return err
+		}
+	}
+	d.current = nil
+	s.tx.set(s.store.tombstones().Doc(id), Tombstone{ID: id, Collection: s.store.col.ID, DeletedAt: storeNow()})
+	return nil
+}
+
+func (s *firestoreTxStore[T, P]) Deleted(ctx context.Context, since time.Time) ([]Tombstone, error) {
+	return nil, errNotInTransaction
+}
+
+func (s *firestoreTxStore[T, P]) PurgeTombstones(ctx context.Context, cutoff time.Time) error {
+	return errNotInTransaction
+}
+
+// skipMalformed logs a document a list call on resource skips because it
+// does not decode
+func skipMalformed(ctx context.Context, resource string, doc *firestore.DocumentSnapshot, err error) {
+	collection := doc.Ref.Parent.Path
+	if _, rel, ok := strings.Cut(collection, "/documents/"); ok {
+		collection = rel // e.g. users/{uid}/Indoor_Climbs rather than the full resource name
+	}
+	logFor(ctx).Warn("skipping malformed document", "collection", collection, "id", doc.Ref.ID, "error", err)
+	skippedDocuments.WithLabelValues(resource).Inc()
+	trace.SpanFromContext(ctx).AddEvent("skipped malformed document", trace.WithAttributes(attribute.String("document.id", doc.Ref.ID)))
+}
+
+// notFoundOr maps Firestore's NotFound status to ErrNotFound
+func notFoundOr(err error) error {
+	if status.Code(err) == codes.NotFound {
+		return ErrNotFound
+	}
+	return err
+}
+
+// changedFields returns a Firestore update for every top-level field whose
+// value differs between before and after, keyed by its firestore tag
+func changedFields(before, after interface{}) []firestore.Update {
+	bv, av := reflect.ValueOf(before), reflect.ValueOf(after)
+	t := av.Type()
+
+	var updates []firestore.Update
+	for i := 0; i < t.NumField(); i++ {
+		name, _, _ := strings.Cut(t.Field(i).Tag.Get("firestore"), ",")
+		if name == "" || name == "-" {
+			continue
+		}
+		if !reflect.DeepEqual(bv.Field(i).Interface(), av.Field(i).Interface()) {
+			updates = append(updates, firestore.Update{Path: name, Value: av.Field(i).Interface()})
+		}
+	}
+	return updates
+}
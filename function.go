@@ -2,27 +2,57 @@ package function
 
 import (
 	"context"
+	"database/sql"
+	"errors"
+	"fmt"
 	"net/http"
 	"os"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/GoogleCloudPlatform/functions-framework-go/functions"
 )
 
 func init() {
 	functions.HTTP("WorkoutAPI", WorkoutAPI)
-}
-
-// setCORSHeaders sets the CORS headers for all responses
-func setCORSHeaders(w http.ResponseWriter) {
-	w.Header().Set("Access-Control-Allow-Origin", "*")
-	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, x-api-key")
+	SetupJWT() // A failure is reported by AuthConfigured
 }
 
 // WorkoutAPI is the entry point for the Cloud Function
 func WorkoutAPI(w http.ResponseWriter, r *http.Request) {
-	setCORSHeaders(w)
+	if _, err := SetupTracing(); err != nil {
+		tracingErrOnce.Do(func() { logger.Error("tracing disabled", "error", err) })
+	}
+	serveWorkoutAPI(w, r, GetBackend)
+}
+
+// NewHandler returns an http.Handler serving the WorkoutAPI routes on top of
+// the given backend instead of the one selected by the environment
+func NewHandler(backend Backend) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		serveWorkoutAPI(w, r, func(context.Context) (Backend, error) {
+			return backend, nil
+		})
+	})
+}
+
+func serveWorkoutAPI(w http.ResponseWriter, r *http.Request, getBackend func(context.Context) (Backend, error)) {
+	start := time.Now()
+	setCORSHeaders(w, r)
+	r = withRequestID(w, r)
+
+	r, span := startRequestSpan(r)
+
+	rw := &statusRecorder{ResponseWriter: w}
+	w = rw
+	var principal Principal
+	defer func() {
+		latency := time.Since(start)
+		logRequest(r, rw, principal, latency)
+		observeRequest(r, rw.statusCode(), latency)
+		endRequestSpan(span, r, rw.statusCode())
+	}()
 
 	// Handle preflight requests
 	if r.Method == "OPTIONS" {
@@ -30,25 +60,49 @@ func WorkoutAPI(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Auth check
-	clientKey := r.Header.Get("x-api-key")
-	serverKey := os.Getenv("APP_SECRET_PASSWORD")
-
-	if clientKey != serverKey {
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+	if !limitBody(w, r) {
 		return
 	}
 
-	// Get Firestore client
-	ctx := context.Background()
-	projectID := os.Getenv("GCP_PROJECT_ID")
-	if projectID == "" {
-		projectID = os.Getenv("GOOGLE_CLOUD_PROJECT") // Fallback for Cloud Functions
+	r, cancel := withDeadline(r)
+	defer cancel()
+	ctx := r.Context()
+
+	// The backend outlives this request, so it is not opened under its context
+	backend, err := getBackend(context.Background())
+	if err != nil {
+		logFor(ctx).Error("failed to open storage backend", "error", err)
+		writeError(w, r, http.StatusInternalServerError, CodeDatabaseUnavailable, "Failed to connect to database")
+		return
 	}
 
-	client, err := GetFirestoreClient(ctx, projectID)
+	// Auth check, refusing to run open when no credentials are configured
+	if configured, err := AuthConfigured(); err != nil {
+		logFor(ctx).Error("refusing request: failed to load credentials", "error", err)
+		writeError(w, r, http.StatusServiceUnavailable, CodeNotConfigured, "Authentication is not configured")
+		return
+	} else if !configured {
+		logFor(ctx).Error("refusing request: no credentials configured")
+		writeError(w, r, http.StatusServiceUnavailable, CodeNotConfigured, "Authentication is not configured")
+		return
+	}
+	if !checkAuthFailures(w, r) {
+		return
+	}
+	principal, err = authenticate(ctx, r, backend.Users())
+	if errors.Is(err, errUnauthenticated) {
+		recordAuthFailure(r)
+		w.Header().Set("WWW-Authenticate", `Bearer realm="WorkoutAPI"`)
+		writeError(w, r, http.StatusUnauthorized, CodeUnauthorized, "Missing or invalid credentials")
+		return
+	}
 	if err != nil {
-		http.Error(w, "Failed to connect to database", http.StatusInternalServerError)
+		logFor(ctx).Error("failed to verify credentials", "error", err)
+		writeError(w, r, http.StatusInternalServerError, CodeInternal, "Failed to verify credentials")
+		return
+	}
+	r = r.WithContext(context.WithValue(r.Context(), principalKey{}, principal))
+	if !checkRateLimit(w, r, principal) {
 		return
 	}
 
@@ -56,111 +110,257 @@ func WorkoutAPI(w http.ResponseWriter, r *http.Request) {
 	path := r.URL.Path
 	method := r.Method
 
+	// /users routes manage accounts and are reserved for the admin key
+	if path == "/users" || strings.HasPrefix(path, "/users/") {
+		if !principal.Admin {
+			writeError(w, r, http.StatusForbidden, CodeForbidden, "Admin API key required")
+			return
+		}
+		HandleUsers(w, r, backend.Users())
+		return
+	}
+
+	// /keys routes mint and revoke scoped API keys, also admin only
+	if path == "/keys" || strings.HasPrefix(path, "/keys/") {
+		if !principal.Admin {
+			writeError(w, r, http.StatusForbidden, CodeForbidden, "Admin API key required")
+			return
+		}
+		HandleKeys(w, r, backend.Users())
+		return
+	}
+
+	// Scoped keys may only use the resources and methods they were granted
+	if resource := resourceOf(path); resource != "" && !principal.Allows(resource, method != "GET") {
+		writeScopeError(w, r)
+		return
+	}
+
+	// Every session route is scoped to the caller's own sessions
+	stores := instrumentStores(backend.Stores(principal.UserID))
+
+	// A POST may carry an Idempotency-Key so a retried create is not applied twice
+	if method == "POST" && r.Header.Get("Idempotency-Key") != "" {
+		serveIdempotent(w, r, backend.Idempotency(), func(w http.ResponseWriter, r *http.Request) {
+			routeSessions(w, r, stores)
+		})
+		return
+	}
+	routeSessions(w, r, stores)
+}
+
+// routeSessions dispatches the session, /sync and /batch routes
+func routeSessions(w http.ResponseWriter, r *http.Request, stores *Stores) {
+	path := r.URL.Path
+	method := r.Method
+	// Routed on the same segment the scope check used, so a path is either
+	// a session resource or not found
+	resource := resourceOf(path)
+
 	// /indoor_sessions routes
-	if strings.HasPrefix(path, "/indoor_sessions") {
+	if resource == "indoor_sessions" {
 		sessionID := ParseSessionID(path)
 
 		switch {
 		case method == "GET" && sessionID == "":
-			ListIndoorSessions(w, r, client)
+			ListIndoorSessions(w, r, stores.Indoor)
 		case method == "GET" && sessionID != "":
-			GetIndoorSession(w, r, client, sessionID)
+			GetIndoorSession(w, r, stores.Indoor, sessionID)
 		case method == "POST" && sessionID == "":
-			CreateIndoorSession(w, r, client)
+			CreateIndoorSession(w, r, stores.Indoor)
 		case method == "PUT" && sessionID != "":
-			UpdateIndoorSession(w, r, client, sessionID)
+			UpdateIndoorSession(w, r, stores.Indoor, sessionID)
+		case method == "PATCH" && sessionID != "":
+			PatchIndoorSession(w, r, stores.Indoor, sessionID)
 		case method == "DELETE" && sessionID != "":
-			DeleteIndoorSession(w, r, client, sessionID)
+			DeleteIndoorSession(w, r, stores.Indoor, sessionID)
 		default:
-			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			writeError(w, r, http.StatusMethodNotAllowed, CodeMethodNotAllowed, "Method not allowed")
 		}
 		return
 	}
 
 	// /outdoor_sessions routes
-	if strings.HasPrefix(path, "/outdoor_sessions") {
+	if resource == "outdoor_sessions" {
 		sessionID := ParseOutdoorSessionID(path)
 
 		switch {
 		case method == "GET" && sessionID == "":
-			ListOutdoorSessions(w, r, client)
+			ListOutdoorSessions(w, r, stores.Outdoor)
 		case method == "GET" && sessionID != "":
-			GetOutdoorSession(w, r, client, sessionID)
+			GetOutdoorSession(w, r, stores.Outdoor, sessionID)
 		case method == "POST" && sessionID == "":
-			CreateOutdoorSession(w, r, client)
+			CreateOutdoorSession(w, r, stores.Outdoor)
 		case method == "PUT" && sessionID != "":
-			UpdateOutdoorSession(w, r, client, sessionID)
+			UpdateOutdoorSession(w, r, stores.Outdoor, sessionID)
+		case method == "PATCH" && sessionID != "":
+			PatchOutdoorSession(w, r, stores.Outdoor, sessionID)
 		case method == "DELETE" && sessionID != "":
-			DeleteOutdoorSession(w, r, client, sessionID)
+			DeleteOutdoorSession(w, r, stores.Outdoor, sessionID)
 		default:
-			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			writeError(w, r, http.StatusMethodNotAllowed, CodeMethodNotAllowed, "Method not allowed")
 		}
 		return
 	}
 
 	// /fingerboard_sessions routes
-	if strings.HasPrefix(path, "/fingerboard_sessions") {
+	if resource == "fingerboard_sessions" {
 		sessionID := ParseFingerboardSessionID(path)
 
 		switch {
 		case method == "GET" && sessionID == "":
-			ListFingerboardSessions(w, r, client)
+			ListFingerboardSessions(w, r, stores.Fingerboard)
 		case method == "GET" && sessionID != "":
-			GetFingerboardSession(w, r, client, sessionID)
+			GetFingerboardSession(w, r, stores.Fingerboard, sessionID)
 		case method == "POST" && sessionID == "":
-			CreateFingerboardSession(w, r, client)
+			CreateFingerboardSession(w, r, stores.Fingerboard)
 		case method == "PUT" && sessionID != "":
-			UpdateFingerboardSession(w, r, client, sessionID)
+			UpdateFingerboardSession(w, r, stores.Fingerboard, sessionID)
+		case method == "PATCH" && sessionID != "":
+			PatchFingerboardSession(w, r, stores.Fingerboard, sessionID)
 		case method == "DELETE" && sessionID != "":
-			DeleteFingerboardSession(w, r, client, sessionID)
+			DeleteFingerboardSession(w, r, stores.Fingerboard, sessionID)
 		default:
-			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			writeError(w, r, http.StatusMethodNotAllowed, CodeMethodNotAllowed, "Method not allowed")
 		}
 		return
 	}
 
 	// /competition_sessions routes
-	if strings.HasPrefix(path, "/competition_sessions") {
+	if resource == "competition_sessions" {
 		sessionID := ParseCompetitionSessionID(path)
 
 		switch {
 		case method == "GET" && sessionID == "":
-			ListCompetitionSessions(w, r, client)
+			ListCompetitionSessions(w, r, stores.Competition)
 		case method == "GET" && sessionID != "":
-			GetCompetitionSession(w, r, client, sessionID)
+			GetCompetitionSession(w, r, stores.Competition, sessionID)
 		case method == "POST" && sessionID == "":
-			CreateCompetitionSession(w, r, client)
+			CreateCompetitionSession(w, r, stores.Competition)
 		case method == "PUT" && sessionID != "":
-			UpdateCompetitionSession(w, r, client, sessionID)
+			UpdateCompetitionSession(w, r, stores.Competition, sessionID)
+		case method == "PATCH" && sessionID != "":
+			PatchCompetitionSession(w, r, stores.Competition, sessionID)
 		case method == "DELETE" && sessionID != "":
-			DeleteCompetitionSession(w, r, client, sessionID)
+			DeleteCompetitionSession(w, r, stores.Competition, sessionID)
 		default:
-			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			writeError(w, r, http.StatusMethodNotAllowed, CodeMethodNotAllowed, "Method not allowed")
 		}
 		return
 	}
 
 	// /gym_sessions routes
-	if strings.HasPrefix(path, "/gym_sessions") {
+	if resource == "gym_sessions" {
 		sessionID := ParseGymSessionID(path)
 
 		switch {
 		case method == "GET" && sessionID == "":
-			ListGymSessions(w, r, client)
+			ListGymSessions(w, r, stores.Gym)
 		case method == "GET" && sessionID != "":
-			GetGymSession(w, r, client, sessionID)
+			GetGymSession(w, r, stores.Gym, sessionID)
 		case method == "POST" && sessionID == "":
-			CreateGymSession(w, r, client)
+			CreateGymSession(w, r, stores.Gym)
 		case method == "PUT" && sessionID != "":
-			UpdateGymSession(w, r, client, sessionID)
+			UpdateGymSession(w, r, stores.Gym, sessionID)
+		case method == "PATCH" && sessionID != "":
+			PatchGymSession(w, r, stores.Gym, sessionID)
 		case method == "DELETE" && sessionID != "":
-			DeleteGymSession(w, r, client, sessionID)
+			DeleteGymSession(w, r, stores.Gym, sessionID)
 		default:
-			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			writeError(w, r, http.StatusMethodNotAllowed, CodeMethodNotAllowed, "Method not allowed")
+		}
+		return
+	}
+
+	// /sync returns changes across every collection
+	if path == "/sync" {
+		for _, resource := range Resources {
+			if !PrincipalFromContext(r.Context()).Allows(resource, false) {
+				writeScopeError(w, r)
+				return
+			}
+		}
+		if method == "GET" {
+			HandleSync(w, r, stores)
+		} else {
+			writeError(w, r, http.StatusMethodNotAllowed, CodeMethodNotAllowed, "Method not allowed")
+		}
+		return
+	}
+
+	// /batch replays queued mutations across every collection
+	if path == "/batch" {
+		if method == "POST" {
+			HandleBatch(w, r, stores)
+		} else {
+			writeError(w, r, http.StatusMethodNotAllowed, CodeMethodNotAllowed, "Method not allowed")
 		}
 		return
 	}
 
 	// Default: not found
-	http.Error(w, "Not found", http.StatusNotFound)
+	writeError(w, r, http.StatusNotFound, CodeNotFound, "Not found")
+}
+
+var (
+	defaultMemoryBackend     Backend
+	defaultMemoryBackendOnce sync.Once
+
+	defaultSQLiteBackend     Backend
+	defaultSQLiteBackendOnce sync.Once
+	defaultSQLiteBackendErr  error
+	defaultSQLiteDB          *sql.DB
+)
+
+// GetBackend returns the storage backend behind WorkoutAPI, selected by
+// STORAGE_BACKEND ("firestore" by default, "memory" or "sqlite")
+func GetBackend(ctx context.Context) (Backend, error) {
+	switch backend := os.Getenv("STORAGE_BACKEND"); backend {
+	case "", "firestore":
+	case "memory":
+		defaultMemoryBackendOnce.Do(func() {
+			defaultMemoryBackend = NewMemoryBackend()
+		})
+		return defaultMemoryBackend, nil
+	case "sqlite":
+		defaultSQLiteBackendOnce.Do(func() {
+			path := os.Getenv("SQLITE_PATH")
+			if path == "" {
+				path = "workouts.db"
+			}
+			db, err := OpenSQLite(ctx, path)
+			if err != nil {
+				defaultSQLiteBackendErr = err
+				return
+			}
+			defaultSQLiteDB, defaultSQLiteBackend = db, NewSQLiteBackend(db)
+		})
+		return defaultSQLiteBackend, defaultSQLiteBackendErr
+	default:
+		return nil, fmt.Errorf("unknown STORAGE_BACKEND %q", backend)
+	}
+
+	projectID := os.Getenv("GCP_PROJECT_ID")
+	if projectID == "" {
+		projectID = os.Getenv("GOOGLE_CLOUD_PROJECT") // Fallback for Cloud Functions
+	}
+
+	client, err := GetFirestoreClient(ctx, projectID)
+	if err != nil {
+		return nil, err
+	}
+	return NewFirestoreBackend(client), nil
+}
+
+// CloseBackend releases what GetBackend opened: the SQLite database or the
+// Firestore client. WorkoutAPI must not serve requests afterwards.
+func CloseBackend() error {
+	var errs []error
+	if defaultSQLiteDB != nil {
+		errs = append(errs, defaultSQLiteDB.Close())
+	}
+	if firestoreClient != nil {
+		errs = append(errs, firestoreClient.Close())
+	}
+	return errors.Join(errs...)
 }
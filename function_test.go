@@ -0,0 +1,241 @@
+package function
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testAdminKey = "test-admin-key"
+
+// serve sends a request through WorkoutAPI with the given API key, if any
+func serve(t *testing.T, method, path, key, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	var reader io.Reader
+	if body != "" {
+		reader = strings.NewReader(body)
+	}
+	r := httptest.NewRequest(method, path, reader)
+	if key != "" {
+		r.Header.Set("x-api-key", key)
+	}
+	if body != "" {
+		r.Header.Set("Content-Type", "application/json")
+	}
+	w := httptest.NewRecorder()
+	WorkoutAPI(w, r)
+	return w
+}
+
+// decode unmarshals a response body, failing the test if it is not JSON
+// request serves a request to handler with the admin key, and any headers
+// given as name, value pairs; an empty x-api-key removes the key
+func request(t *testing.T, handler http.Handler, method, path, body string, headers ...string) *httptest.ResponseRecorder {
+	t.Helper()
+	r := httptest.NewRequest(method, path, strings.NewReader(body))
+	r.Header.Set("x-api-key", testAdminKey)
+	for i := 0; i+1 < len(headers); i += 2 {
+		r.Header.Set(headers[i], headers[i+1])
+	}
+	if r.Header.Get("x-api-key") == "" {
+		r.Header.Del("x-api-key")
+	}
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	return w
+}
+
+func decode(t *testing.T, w *httptest.ResponseRecorder, v interface{}) {
+	t.Helper()
+	if err := json.Unmarshal(w.Body.Bytes(), v); err != nil {
+		t.Fatalf("decoding %q: %v", w.Body.String(), err)
+	}
+}
+
+// useMemoryBackend runs WorkoutAPI on the in-memory backend with an admin key
+func useMemoryBackend(t *testing.T) {
+	t.Helper()
+	t.Setenv("STORAGE_BACKEND", "memory")
+	t.Setenv("APP_SECRET_PASSWORD", testAdminKey)
+	t.Setenv("APP_SECRET_KEYS", "")
+	t.Setenv("APP_SECRET_PASSWORD_FILE", "")
+	t.Setenv("JWT_JWKS", "")
+	t.Setenv("RATE_LIMIT", "0")
+	logger = NewLogger(io.Discard)
+}
+
+func TestWorkoutAPICRUD(t *testing.T) {
+	useMemoryBackend(t)
+
+	tests := []struct {
+		resource string
+		create   string
+		update   string
+		field    string // Field changed by update
+		want     interface{}
+	}{
+		{
+			resource: "indoor_sessions",
+			create:   `{"date":"2024-05-01","location":"Gym A","climbingType":"Bouldering","trainingTypes":["Power"],"climbs":[{"grade":"V5","attemptType":"Flash","attemptsNum":1}]}`,
+			update:   `{"date":"2024-05-01","location":"Gym B","climbingType":"Bouldering","trainingTypes":["Power"]}`,
+			field:    "location", want: "Gym B",
+		},
+		{
+			resource: "outdoor_sessions",
+			create:   `{"date":"2024-05-02","area":"Peak District","crag":"Stanage","climbingType":"Sport","trainingTypes":["Endurance"]}`,
+			update:   `{"date":"2024-05-02","area":"Peak District","crag":"Froggatt","climbingType":"Sport","trainingTypes":["Endurance"]}`,
+			field:    "crag", want: "Froggatt",
+		},
+		{
+			resource: "fingerboard_sessions",
+			create:   `{"date":"2024-05-03","location":"Home","exercises":[{"name":"Max hangs","sets":3,"details":[{"weight":10,"reps":1}]}]}`,
+			update:   `{"date":"2024-05-03","location":"Gym","exercises":[]}`,
+			field:    "location", want: "Gym",
+		},
+		{
+			resource: "competition_sessions",
+			create:   `{"date":"2024-05-04","venue":"Regional","type":"Bouldering","rounds":[{"name":"Qualifiers","climbs":[{"status":"Top","attemptCount":2}]}]}`,
+			update:   `{"date":"2024-05-04","venue":"National","type":"Bouldering","rounds":[]}`,
+			field:    "venue", want: "National",
+		},
+		{
+			resource: "gym_sessions",
+			create:   `{"date":"2024-05-05","name":"Pull day","exercises":[{"name":"Rows","sets":[{"weight":40,"reps":8}]}]}`,
+			update:   `{"date":"2024-05-05","name":"Push day","exercises":[]}`,
+			field:    "name", want: "Push day",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.resource, func(t *testing.T) {
+			base := "/" + tt.resource
+
+			w := serve(t, "POST", base, testAdminKey, tt.create)
+			if w.Code != http.StatusCreated {
+				t.Fatalf("create: got %d %s", w.Code, w.Body.String())
+			}
+			var created map[string]interface{}
+			decode(t, w, &created)
+			id, _ := created["id"].(string)
+			if id == "" {
+				t.Fatalf("create: no id in %s", w.Body.String())
+			}
+
+			w = serve(t, "GET", base, testAdminKey, "")
+			if w.Code != http.StatusOK {
+				t.Fatalf("list: got %d %s", w.Code, w.Body.String())
+			}
+			var list []map[string]interface{}
+			decode(t, w, &list)
+			found := false
+			for _, s := range list {
+				found = found || s["id"] == id
+			}
+			if !found {
+				t.Errorf("list: %s missing from %s", id, w.Body.String())
+			}
+
+			w = serve(t, "GET", base+"/"+id, testAdminKey, "")
+			if w.Code != http.StatusOK {
+				t.Fatalf("get: got %d %s", w.Code, w.Body.String())
+			}
+			if w.Header().Get("ETag") == "" {
+				t.Error("get: missing ETag")
+			}
+
+			w = serve(t, "PUT", base+"/"+id, testAdminKey, tt.update)
+			if w.Code != http.StatusOK {
+				t.Fatalf("update: got %d %s", w.Code, w.Body.String())
+			}
+			var updated map[string]interface{}
+			decode(t, w, &updated)
+			if updated[tt.field] != tt.want {
+				t.Errorf("update: %s = %v, want %v", tt.field, updated[tt.field], tt.want)
+			}
+			if updated["createdAt"] != created["createdAt"] {
+				t.Errorf("update: createdAt changed from %v to %v", created["createdAt"], updated["createdAt"])
+			}
+
+			w = serve(t, "GET", base+"/"+id, testAdminKey, "")
+			var fetched map[string]interface{}
+			decode(t, w, &fetched)
+			if fetched[tt.field] != tt.want {
+				t.Errorf("get after update: %s = %v, want %v", tt.field, fetched[tt.field], tt.want)
+			}
+
+			w = serve(t, "DELETE", base+"/"+id, testAdminKey, "")
+			if w.Code != http.StatusNoContent {
+				t.Fatalf("delete: got %d %s", w.Code, w.Body.String())
+			}
+			w = serve(t, "GET", base+"/"+id, testAdminKey, "")
+			if w.Code != http.StatusNotFound {
+				t.Errorf("get after delete: got %d, want 404", w.Code)
+			}
+			w = serve(t, "DELETE", base+"/"+id, testAdminKey, "")
+			if w.Code != http.StatusNotFound {
+				t.Errorf("second delete: got %d, want 404", w.Code)
+			}
+		})
+	}
+}
+
+func TestWorkoutAPIRequiresKey(t *testing.T) {
+	useMemoryBackend(t)
+
+	for _, key := range []string{"", "wrong-key"} {
+		for _, resource := range Resources {
+			w := serve(t, "GET", "/"+resource, key, "")
+			if w.Code != http.StatusUnauthorized {
+				t.Errorf("GET /%s with key %q: got %d, want 401", resource, key, w.Code)
+			}
+			var resp errorResponse
+			decode(t, w, &resp)
+			if resp.Error.Code != CodeUnauthorized {
+				t.Errorf("GET /%s with key %q: code %q, want %q", resource, key, resp.Error.Code, CodeUnauthorized)
+			}
+		}
+	}
+}
+
+func TestWorkoutAPIUnknownRoute(t *testing.T) {
+	useMemoryBackend(t)
+
+	if w := serve(t, "GET", "/nope", testAdminKey, ""); w.Code != http.StatusNotFound {
+		t.Errorf("GET /nope: got %d, want 404", w.Code)
+	}
+}
+
+// TestListSinceReplacesDateFilters checks that a valid since lists every
+// change regardless of startDate and endDate, on every collection
+func TestListSinceReplacesDateFilters(t *testing.T) {
+	useMemoryBackend(t)
+	handler := NewHandler(NewMemoryBackend())
+	since := time.Now().Add(-time.Hour).UTC().Format(time.RFC3339)
+
+	for _, resource := range Resources {
+		t.Run(resource, func(t *testing.T) {
+			for _, date := range []string{"2024-01-01", "2024-06-01"} {
+				r := httptest.NewRequest("POST", "/"+resource, strings.NewReader(`{"date":"`+date+`","type":"Lead","venue":"Arena"}`))
+				r.Header.Set("x-api-key", testAdminKey)
+				w := httptest.NewRecorder()
+				handler.ServeHTTP(w, r)
+				if w.Code != http.StatusCreated {
+					t.Fatalf("create: got %d %s", w.Code, w.Body.String())
+				}
+			}
+			if n := countSessions(t, handler, resource+"?startDate=2024-05-01"); n != 1 {
+				t.Errorf("startDate only: %d sessions, want 1", n)
+			}
+			if n := countSessions(t, handler, resource+"?startDate=2024-05-01&endDate=2024-05-31&since="+since); n != 2 {
+				t.Errorf("since with date filters: %d sessions, want 2", n)
+			}
+			if n := countSessions(t, handler, resource+"?startDate=2024-05-01&since=not-a-time"); n != 1 {
+				t.Errorf("invalid since: %d sessions, want the date filter to apply", n)
+			}
+		})
+	}
+}
@@ -1,206 +1,164 @@
 package function
 
 import (
-	"context"
 	"encoding/json"
+	"errors"
 	"net/http"
 	"strings"
 	"time"
-
-	"cloud.google.com/go/firestore"
-	"google.golang.org/api/iterator"
 )
 
 // ListIndoorSessions returns all indoor sessions, with optional date filtering
-func ListIndoorSessions(w http.ResponseWriter, r *http.Request, client *firestore.Client) {
-	ctx := context.Background()
-	col := GetCollection(client)
-
-	var query firestore.Query
-
-	// Check for incremental sync
-	since := r.URL.Query().Get("since")
-	parsedTime, err := time.Parse(time.RFC3339, since)
+func ListIndoorSessions(w http.ResponseWriter, r *http.Request, store SessionStore[IndoorSession]) {
+	ctx, span := startHandlerSpan(r, "ListIndoorSessions", "")
+	defer span.End()
 
-	if since != "" && err == nil {
-		// Incremental sync - strictly filter by modification time
-		query = col.Where("updatedAt", ">", parsedTime).OrderBy("updatedAt", firestore.Desc)
-	} else {
-		// Standard sync - filter by date
-		startDate := r.URL.Query().Get("startDate")
-		endDate := r.URL.Query().Get("endDate")
-
-		query = col.OrderBy("date", firestore.Desc)
-
-		if startDate != "" {
-			query = query.Where("date", ">=", startDate)
-		}
-		if endDate != "" {
-			query = query.Where("date", "<=", endDate)
-		}
+	opts := listOptionsFromQuery(r)
+	if err := parsePage(r, &opts); err != nil {
+		writeError(w, r, http.StatusBadRequest, CodeInvalidParameter, err.Error())
+		return
 	}
 
-	iter := query.Documents(ctx)
-	defer iter.Stop()
-
-	var sessions []IndoorSession
-	for {
-		doc, err := iter.Next()
-		if err == iterator.Done {
-			break
-		}
-		if err != nil {
-			http.Error(w, "Failed to fetch sessions", http.StatusInternalServerError)
-			return
-		}
-
-		var session IndoorSession
-		if err := doc.DataTo(&session); err != nil {
-			continue // Skip malformed documents
-		}
-		session.ID = doc.Ref.ID
-		sessions = append(sessions, session)
+	sessions, err := store.List(ctx, opts)
+	if err != nil {
+		logFor(ctx).Error("list sessions failed", "collection", "indoor_sessions", "error", err)
+		writeError(w, r, http.StatusInternalServerError, CodeInternal, "Failed to fetch sessions")
+		return
 	}
 
-	if sessions == nil {
-		sessions = []IndoorSession{} // Return empty array, not null
+	deleted, err := listDeleted(ctx, r, store, opts)
+	if err != nil {
+		writeDeletedError(w, r, "indoor_sessions", err)
+		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(sessions)
+	writeSessions(w, opts, sessions, deleted)
 }
 
 // GetIndoorSession returns a single session by ID
-func GetIndoorSession(w http.ResponseWriter, r *http.Request, client *firestore.Client, id string) {
-	ctx := context.Background()
-	col := GetCollection(client)
+func GetIndoorSession(w http.ResponseWriter, r *http.Request, store SessionStore[IndoorSession], id string) {
+	ctx, span := startHandlerSpan(r, "GetIndoorSession", id)
+	defer span.End()
 
-	doc, err := col.Doc(id).Get(ctx)
-	if err != nil {
-		http.Error(w, "Session not found", http.StatusNotFound)
+	session, err := store.Get(ctx, id)
+	if errors.Is(err, ErrNotFound) {
+		writeError(w, r, http.StatusNotFound, CodeNotFound, "Session not found")
 		return
 	}
-
-	var session IndoorSession
-	if err := doc.DataTo(&session); err != nil {
-		http.Error(w, "Failed to parse session", http.StatusInternalServerError)
+	if err != nil {
+		logFor(ctx).Error("get session failed", "collection", "indoor_sessions", "session", id, "error", err)
+		writeError(w, r, http.StatusInternalServerError, CodeInternal, "Failed to fetch session")
 		return
 	}
-	session.ID = doc.Ref.ID
 
+	setETag(w, &session)
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(session)
 }
 
 // CreateIndoorSession creates a new session
-func CreateIndoorSession(w http.ResponseWriter, r *http.Request, client *firestore.Client) {
-	ctx := context.Background()
-	col := GetCollection(client)
+func CreateIndoorSession(w http.ResponseWriter, r *http.Request, store SessionStore[IndoorSession]) {
+	ctx, span := startHandlerSpan(r, "CreateIndoorSession", "")
+	defer span.End()
 
 	var input IndoorSessionInput
 	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
-		return
-	}
-
-	now := time.Now()
-	session := IndoorSession{
-		Date:           input.Date,
-		Location:       input.Location,
-		CustomLocation: input.CustomLocation,
-		ClimbingType:   input.ClimbingType,
-		TrainingTypes:  input.TrainingTypes,
-		Difficulty:     input.Difficulty,
-		Categories:     input.Categories,
-		EnergySystems:  input.EnergySystems,
-		FingerLoad:     input.FingerLoad,
-		ShoulderLoad:   input.ShoulderLoad,
-		ForearmLoad:    input.ForearmLoad,
-		Climbs:         input.Climbs,
-		Notes:          input.Notes,
-		CreatedAt:      now,
-		UpdatedAt:      now,
-	}
-
-	docRef, _, err := col.Add(ctx, session)
-	if err != nil {
-		http.Error(w, "Failed to create session", http.StatusInternalServerError)
+		writeError(w, r, http.StatusBadRequest, CodeInvalidBody, "Invalid request body")
+		return
+	}
+	if verr := input.Validate(); verr != nil {
+		writeValidationError(w, r, verr)
 		return
 	}
 
-	session.ID = docRef.ID
+	session := input.toSession()
 
+	session, err := store.Create(ctx, session)
+	if err != nil {
+		logFor(ctx).Error("create session failed", "collection", "indoor_sessions", "error", err)
+		writeError(w, r, http.StatusInternalServerError, CodeInternal, "Failed to create session")
+		return
+	}
+
+	setETag(w, &session)
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
 	json.NewEncoder(w).Encode(session)
 }
 
-// UpdateIndoorSession updates an existing session
-func UpdateIndoorSession(w http.ResponseWriter, r *http.Request, client *firestore.Client, id string) {
-	ctx := context.Background()
-	col := GetCollection(client)
+// UpdateIndoorSession replaces a session, creating it under the given ID if it
+// does not exist so offline clients can choose their own IDs
+func UpdateIndoorSession(w http.ResponseWriter, r *http.Request, store SessionStore[IndoorSession], id string) {
+	ctx, span := startHandlerSpan(r, "UpdateIndoorSession", id)
+	defer span.End()
 
-	// Check if exists
-	docRef := col.Doc(id)
-	_, err := docRef.Get(ctx)
-	if err != nil {
-		http.Error(w, "Session not found", http.StatusNotFound)
+	if !ValidSessionID(id) {
+		writeError(w, r, http.StatusBadRequest, CodeInvalidParameter, invalidSessionIDMessage)
 		return
 	}
-
 	var input IndoorSessionInput
 	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		writeError(w, r, http.StatusBadRequest, CodeInvalidBody, "Invalid request body")
 		return
 	}
-
-	updates := []firestore.Update{
-		{Path: "date", Value: input.Date},
-		{Path: "location", Value: input.Location},
-		{Path: "customLocation", Value: input.CustomLocation},
-		{Path: "climbingType", Value: input.ClimbingType},
-		{Path: "trainingTypes", Value: input.TrainingTypes},
-		{Path: "difficulty", Value: input.Difficulty},
-		{Path: "categories", Value: input.Categories},
-		{Path: "energySystems", Value: input.EnergySystems},
-
-		{Path: "wallAngles", Value: input.WallAngles},
-		{Path: "fingerLoad", Value: input.FingerLoad},
-		{Path: "shoulderLoad", Value: input.ShoulderLoad},
-		{Path: "forearmLoad", Value: input.ForearmLoad},
-		{Path: "climbs", Value: input.Climbs},
-		{Path: "notes", Value: input.Notes},
-		{Path: "updatedAt", Value: time.Now()},
+	if verr := input.Validate(); verr != nil {
+		writeValidationError(w, r, verr)
+		return
 	}
 
-	_, err = docRef.Update(ctx, updates)
+	session, created, err := store.Put(ctx, id, func(s *IndoorSession, exists bool) error {
+		if err := checkPutPreconditions(r, s, exists); err != nil {
+			return err
+		}
+		input.applyTo(s)
+		return nil
+	})
+	if errors.Is(err, errPreconditionFailed) {
+		writeError(w, r, http.StatusPreconditionFailed, CodePreconditionFailed, "Session has been modified, fetch it again")
+		return
+	}
 	if err != nil {
-		http.Error(w, "Failed to update session", http.StatusInternalServerError)
+		logFor(ctx).Error("save session failed", "collection", "indoor_sessions", "session", id, "error", err)
+		writeError(w, r, http.StatusInternalServerError, CodeInternal, "Failed to save session")
 		return
 	}
 
-	// Return updated session
-	GetIndoorSession(w, r, client, id)
+	setETag(w, &session)
+	w.Header().Set("Content-Type", "application/json")
+	if created {
+		w.WriteHeader(http.StatusCreated)
+	}
+	json.NewEncoder(w).Encode(session)
+}
+
+// PatchIndoorSession applies a JSON Merge Patch or JSON Patch to an existing session
+func PatchIndoorSession(w http.ResponseWriter, r *http.Request, store SessionStore[IndoorSession], id string) {
+	ctx, span := startHandlerSpan(r, "PatchIndoorSession", id)
+	defer span.End()
+	patchSession[IndoorSession, IndoorSessionInput](w, r.WithContext(ctx), store, "indoor_sessions", id)
 }
 
 // DeleteIndoorSession deletes a session by ID
-func DeleteIndoorSession(w http.ResponseWriter, r *http.Request, client *firestore.Client, id string) {
-	ctx := context.Background()
-	col := GetCollection(client)
+func DeleteIndoorSession(w http.ResponseWriter, r *http.Request, store SessionStore[IndoorSession], id string) {
+	ctx, span := startHandlerSpan(r, "DeleteIndoorSession", id)
+	defer span.End()
 
-	docRef := col.Doc(id)
-	_, err := docRef.Get(ctx)
-	if err != nil {
-		http.Error(w, "Session not found", http.StatusNotFound)
+	err := store.Delete(ctx, id, ifMatchCheck[IndoorSession](r.Header.Get("If-Match")))
+	if errors.Is(err, ErrNotFound) {
+		writeError(w, r, http.StatusNotFound, CodeNotFound, "Session not found")
+		return
+	}
+	if errors.Is(err, errPreconditionFailed) {
+		writeError(w, r, http.StatusPreconditionFailed, CodePreconditionFailed, "Session has been modified, fetch it again")
 		return
 	}
-
-	_, err = docRef.Delete(ctx)
 	if err != nil {
-		http.Error(w, "Failed to delete session", http.StatusInternalServerError)
+		logFor(ctx).Error("delete session failed", "collection", "indoor_sessions", "session", id, "error", err)
+		writeError(w, r, http.StatusInternalServerError, CodeInternal, "Failed to delete session")
 		return
 	}
 
+	purgeTombstones(ctx, store)
 	w.WriteHeader(http.StatusNoContent)
 }
 
@@ -223,191 +181,155 @@ func ParseOutdoorSessionID(path string) string {
 }
 
 // ListOutdoorSessions returns all outdoor sessions, with optional date filtering
-func ListOutdoorSessions(w http.ResponseWriter, r *http.Request, client *firestore.Client) {
-	ctx := context.Background()
-	col := GetCollectionByName(client, OutdoorCollection)
-
-	var query firestore.Query
-
-	// Check for incremental sync
-	since := r.URL.Query().Get("since")
-	parsedTime, err := time.Parse(time.RFC3339, since)
-
-	if since != "" && err == nil {
-		query = col.Where("updatedAt", ">", parsedTime).OrderBy("updatedAt", firestore.Desc)
-	} else {
-		startDate := r.URL.Query().Get("startDate")
-		endDate := r.URL.Query().Get("endDate")
+func ListOutdoorSessions(w http.ResponseWriter, r *http.Request, store SessionStore[OutdoorSession]) {
+	ctx, span := startHandlerSpan(r, "ListOutdoorSessions", "")
+	defer span.End()
 
-		query = col.OrderBy("date", firestore.Desc)
-
-		if startDate != "" {
-			query = query.Where("date", ">=", startDate)
-		}
-		if endDate != "" {
-			query = query.Where("date", "<=", endDate)
-		}
+	opts := listOptionsFromQuery(r)
+	if err := parsePage(r, &opts); err != nil {
+		writeError(w, r, http.StatusBadRequest, CodeInvalidParameter, err.Error())
+		return
 	}
 
-	iter := query.Documents(ctx)
-	defer iter.Stop()
-
-	var sessions []OutdoorSession
-	for {
-		doc, err := iter.Next()
-		if err == iterator.Done {
-			break
-		}
-		if err != nil {
-			http.Error(w, "Failed to fetch sessions", http.StatusInternalServerError)
-			return
-		}
-
-		var session OutdoorSession
-		if err := doc.DataTo(&session); err != nil {
-			continue
-		}
-		session.ID = doc.Ref.ID
-		sessions = append(sessions, session)
+	sessions, err := store.List(ctx, opts)
+	if err != nil {
+		logFor(ctx).Error("list sessions failed", "collection", "outdoor_sessions", "error", err)
+		writeError(w, r, http.StatusInternalServerError, CodeInternal, "Failed to fetch sessions")
+		return
 	}
 
-	if sessions == nil {
-		sessions = []OutdoorSession{}
+	deleted, err := listDeleted(ctx, r, store, opts)
+	if err != nil {
+		writeDeletedError(w, r, "outdoor_sessions", err)
+		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(sessions)
+	writeSessions(w, opts, sessions, deleted)
 }
 
 // GetOutdoorSession returns a single outdoor session by ID
-func GetOutdoorSession(w http.ResponseWriter, r *http.Request, client *firestore.Client, id string) {
-	ctx := context.Background()
-	col := GetCollectionByName(client, OutdoorCollection)
+func GetOutdoorSession(w http.ResponseWriter, r *http.Request, store SessionStore[OutdoorSession], id string) {
+	ctx, span := startHandlerSpan(r, "GetOutdoorSession", id)
+	defer span.End()
 
-	doc, err := col.Doc(id).Get(ctx)
-	if err != nil {
-		http.Error(w, "Session not found", http.StatusNotFound)
+	session, err := store.Get(ctx, id)
+	if errors.Is(err, ErrNotFound) {
+		writeError(w, r, http.StatusNotFound, CodeNotFound, "Session not found")
 		return
 	}
-
-	var session OutdoorSession
-	if err := doc.DataTo(&session); err != nil {
-		http.Error(w, "Failed to parse session", http.StatusInternalServerError)
+	if err != nil {
+		logFor(ctx).Error("get session failed", "collection", "outdoor_sessions", "session", id, "error", err)
+		writeError(w, r, http.StatusInternalServerError, CodeInternal, "Failed to fetch session")
 		return
 	}
-	session.ID = doc.Ref.ID
 
+	setETag(w, &session)
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(session)
 }
 
 // CreateOutdoorSession creates a new outdoor session
-func CreateOutdoorSession(w http.ResponseWriter, r *http.Request, client *firestore.Client) {
-	ctx := context.Background()
-	col := GetCollectionByName(client, OutdoorCollection)
+func CreateOutdoorSession(w http.ResponseWriter, r *http.Request, store SessionStore[OutdoorSession]) {
+	ctx, span := startHandlerSpan(r, "CreateOutdoorSession", "")
+	defer span.End()
 
 	var input OutdoorSessionInput
 	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
-		return
-	}
-
-	now := time.Now()
-	session := OutdoorSession{
-		Date:          input.Date,
-		Area:          input.Area,
-		Crag:          input.Crag,
-		Sector:        input.Sector,
-		ClimbingType:  input.ClimbingType,
-		TrainingTypes: input.TrainingTypes,
-		Difficulty:    input.Difficulty,
-		Categories:    input.Categories,
-		EnergySystems: input.EnergySystems,
-		FingerLoad:    input.FingerLoad,
-		ShoulderLoad:  input.ShoulderLoad,
-		ForearmLoad:   input.ForearmLoad,
-		Climbs:        input.Climbs,
-		Notes:         input.Notes,
-		CreatedAt:     now,
-		UpdatedAt:     now,
-	}
-
-	docRef, _, err := col.Add(ctx, session)
-	if err != nil {
-		http.Error(w, "Failed to create session", http.StatusInternalServerError)
+		writeError(w, r, http.StatusBadRequest, CodeInvalidBody, "Invalid request body")
+		return
+	}
+	if verr := input.Validate(); verr != nil {
+		writeValidationError(w, r, verr)
 		return
 	}
 
-	session.ID = docRef.ID
+	session := input.toSession()
+
+	session, err := store.Create(ctx, session)
+	if err != nil {
+		logFor(ctx).Error("create session failed", "collection", "outdoor_sessions", "error", err)
+		writeError(w, r, http.StatusInternalServerError, CodeInternal, "Failed to create session")
+		return
+	}
 
+	setETag(w, &session)
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
 	json.NewEncoder(w).Encode(session)
 }
 
-// UpdateOutdoorSession updates an existing outdoor session
-func UpdateOutdoorSession(w http.ResponseWriter, r *http.Request, client *firestore.Client, id string) {
-	ctx := context.Background()
-	col := GetCollectionByName(client, OutdoorCollection)
+// UpdateOutdoorSession replaces an outdoor session, creating it if it does not exist
+func UpdateOutdoorSession(w http.ResponseWriter, r *http.Request, store SessionStore[OutdoorSession], id string) {
+	ctx, span := startHandlerSpan(r, "UpdateOutdoorSession", id)
+	defer span.End()
 
-	docRef := col.Doc(id)
-	_, err := docRef.Get(ctx)
-	if err != nil {
-		http.Error(w, "Session not found", http.StatusNotFound)
+	if !ValidSessionID(id) {
+		writeError(w, r, http.StatusBadRequest, CodeInvalidParameter, invalidSessionIDMessage)
 		return
 	}
-
 	var input OutdoorSessionInput
 	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		writeError(w, r, http.StatusBadRequest, CodeInvalidBody, "Invalid request body")
 		return
 	}
-
-	updates := []firestore.Update{
-		{Path: "date", Value: input.Date},
-		{Path: "area", Value: input.Area},
-		{Path: "crag", Value: input.Crag},
-		{Path: "sector", Value: input.Sector},
-		{Path: "climbingType", Value: input.ClimbingType},
-		{Path: "trainingTypes", Value: input.TrainingTypes},
-		{Path: "difficulty", Value: input.Difficulty},
-		{Path: "categories", Value: input.Categories},
-		{Path: "energySystems", Value: input.EnergySystems},
-		{Path: "fingerLoad", Value: input.FingerLoad},
-		{Path: "shoulderLoad", Value: input.ShoulderLoad},
-		{Path: "forearmLoad", Value: input.ForearmLoad},
-		{Path: "climbs", Value: input.Climbs},
-		{Path: "notes", Value: input.Notes},
-		{Path: "updatedAt", Value: time.Now()},
+	if verr := input.Validate(); verr != nil {
+		writeValidationError(w, r, verr)
+		return
 	}
 
-	_, err = docRef.Update(ctx, updates)
+	session, created, err := store.Put(ctx, id, func(s *OutdoorSession, exists bool) error {
+		if err := checkPutPreconditions(r, s, exists); err != nil {
+			return err
+		}
+		input.applyTo(s)
+		return nil
+	})
+	if errors.Is(err, errPreconditionFailed) {
+		writeError(w, r, http.StatusPreconditionFailed, CodePreconditionFailed, "Session has been modified, fetch it again")
+		return
+	}
 	if err != nil {
-		http.Error(w, "Failed to update session", http.StatusInternalServerError)
+		logFor(ctx).Error("save session failed", "collection", "outdoor_sessions", "session", id, "error", err)
+		writeError(w, r, http.StatusInternalServerError, CodeInternal, "Failed to save session")
 		return
 	}
 
-	GetOutdoorSession(w, r, client, id)
+	setETag(w, &session)
+	w.Header().Set("Content-Type", "application/json")
+	if created {
+		w.WriteHeader(http.StatusCreated)
+	}
+	json.NewEncoder(w).Encode(session)
+}
+
+// PatchOutdoorSession applies a JSON Merge Patch or JSON Patch to an existing outdoor session
+func PatchOutdoorSession(w http.ResponseWriter, r *http.Request, store SessionStore[OutdoorSession], id string) {
+	ctx, span := startHandlerSpan(r, "PatchOutdoorSession", id)
+	defer span.End()
+	patchSession[OutdoorSession, OutdoorSessionInput](w, r.WithContext(ctx), store, "outdoor_sessions", id)
 }
 
 // DeleteOutdoorSession deletes an outdoor session by ID
-func DeleteOutdoorSession(w http.ResponseWriter, r *http.Request, client *firestore.Client, id string) {
-	ctx := context.Background()
-	col := GetCollectionByName(client, OutdoorCollection)
+func DeleteOutdoorSession(w http.ResponseWriter, r *http.Request, store SessionStore[OutdoorSession], id string) {
+	ctx, span := startHandlerSpan(r, "DeleteOutdoorSession", id)
+	defer span.End()
 
-	docRef := col.Doc(id)
-	_, err := docRef.Get(ctx)
-	if err != nil {
-		http.Error(w, "Session not found", http.StatusNotFound)
+	err := store.Delete(ctx, id, ifMatchCheck[OutdoorSession](r.Header.Get("If-Match")))
+	if errors.Is(err, ErrNotFound) {
+		writeError(w, r, http.StatusNotFound, CodeNotFound, "Session not found")
+		return
+	}
+	if errors.Is(err, errPreconditionFailed) {
+		writeError(w, r, http.StatusPreconditionFailed, CodePreconditionFailed, "Session has been modified, fetch it again")
 		return
 	}
-
-	_, err = docRef.Delete(ctx)
 	if err != nil {
-		http.Error(w, "Failed to delete session", http.StatusInternalServerError)
+		logFor(ctx).Error("delete session failed", "collection", "outdoor_sessions", "session", id, "error", err)
+		writeError(w, r, http.StatusInternalServerError, CodeInternal, "Failed to delete session")
 		return
 	}
 
+	purgeTombstones(ctx, store)
 	w.WriteHeader(http.StatusNoContent)
 }
 
@@ -420,144 +342,167 @@ func ParseFingerboardSessionID(path string) string {
 	return ""
 }
 
-// ListFingerboardSessions
-func ListFingerboardSessions(w http.ResponseWriter, r *http.Request, client *firestore.Client) {
-	ctx := context.Background()
-	col := GetCollectionByName(client, FingerboardCollection)
-
-	startDate := r.URL.Query().Get("startDate")
-	endDate := r.URL.Query().Get("endDate")
-
-	query := col.OrderBy("date", firestore.Desc)
-	if startDate != "" {
-		query = query.Where("date", ">=", startDate)
-	}
-	if endDate != "" {
-		query = query.Where("date", "<=", endDate)
-	}
-
+// listOptionsFromQuery reads startDate, endDate and since from the query
+// string. A valid since replaces the date filters: an incremental sync wants
+// every change, and Firestore cannot range over updatedAt and date at once
+// without a composite index.
+func listOptionsFromQuery(r *http.Request) ListOptions {
 	// Check for incremental sync
-	since := r.URL.Query().Get("since")
-	if since != "" {
-		parsedTime, err := time.Parse(time.RFC3339, since)
-		if err == nil {
-			query = query.Where("updatedAt", ">", parsedTime)
+	if since := r.URL.Query().Get("since"); since != "" {
+		if parsedTime, err := time.Parse(time.RFC3339, since); err == nil {
+			return ListOptions{Since: parsedTime}
 		}
 	}
+	return ListOptions{
+		StartDate: r.URL.Query().Get("startDate"),
+		EndDate:   r.URL.Query().Get("endDate"),
+	}
+}
 
-	iter := query.Documents(ctx)
-	defer iter.Stop()
-	var sessions []FingerboardSession
-	for {
-		doc, err := iter.Next()
-		if err == iterator.Done {
-			break
-		}
-		if err != nil {
-			http.Error(w, "Failed to fetch", http.StatusInternalServerError)
-			return
-		}
-		var s FingerboardSession
-		if err := doc.DataTo(&s); err == nil {
-			s.ID = doc.Ref.ID
-			sessions = append(sessions, s)
-		}
+// ListFingerboardSessions returns all fingerboard sessions, with optional date filtering
+func ListFingerboardSessions(w http.ResponseWriter, r *http.Request, store SessionStore[FingerboardSession]) {
+	ctx, span := startHandlerSpan(r, "ListFingerboardSessions", "")
+	defer span.End()
+	opts := listOptionsFromQuery(r)
+	if err := parsePage(r, &opts); err != nil {
+		writeError(w, r, http.StatusBadRequest, CodeInvalidParameter, err.Error())
+		return
 	}
-	if sessions == nil {
-		sessions = []FingerboardSession{}
+	sessions, err := store.List(ctx, opts)
+	if err != nil {
+		logFor(ctx).Error("list sessions failed", "collection", "fingerboard_sessions", "error", err)
+		writeError(w, r, http.StatusInternalServerError, CodeInternal, "Failed to fetch sessions")
+		return
 	}
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(sessions)
+	deleted, err := listDeleted(ctx, r, store, opts)
+	if err != nil {
+		writeDeletedError(w, r, "fingerboard_sessions", err)
+		return
+	}
+
+	writeSessions(w, opts, sessions, deleted)
 }
 
-// GetFingerboardSession
-func GetFingerboardSession(w http.ResponseWriter, r *http.Request, client *firestore.Client, id string) {
-	ctx := context.Background()
-	doc, err := GetCollectionByName(client, FingerboardCollection).Doc(id).Get(ctx)
-	if err != nil {
-		http.Error(w, "Not found", http.StatusNotFound)
+// GetFingerboardSession returns a single fingerboard session by ID
+func GetFingerboardSession(w http.ResponseWriter, r *http.Request, store SessionStore[FingerboardSession], id string) {
+	ctx, span := startHandlerSpan(r, "GetFingerboardSession", id)
+	defer span.End()
+	s, err := store.Get(ctx, id)
+	if errors.Is(err, ErrNotFound) {
+		writeError(w, r, http.StatusNotFound, CodeNotFound, "Session not found")
 		return
 	}
-	var s FingerboardSession
-	if err := doc.DataTo(&s); err != nil {
-		http.Error(w, "Parse error", http.StatusInternalServerError)
+	if err != nil {
+		logFor(ctx).Error("get session failed", "collection", "fingerboard_sessions", "session", id, "error", err)
+		writeError(w, r, http.StatusInternalServerError, CodeInternal, "Failed to fetch session")
 		return
 	}
-	s.ID = doc.Ref.ID
+	setETag(w, &s)
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(s)
 }
 
-// CreateFingerboardSession
-func CreateFingerboardSession(w http.ResponseWriter, r *http.Request, client *firestore.Client) {
-	ctx := context.Background()
+// CreateFingerboardSession creates a new fingerboard session
+func CreateFingerboardSession(w http.ResponseWriter, r *http.Request, store SessionStore[FingerboardSession]) {
+	ctx, span := startHandlerSpan(r, "CreateFingerboardSession", "")
+	defer span.End()
 	var input FingerboardSessionInput
 	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
-		http.Error(w, "Invalid body", http.StatusBadRequest)
+		writeError(w, r, http.StatusBadRequest, CodeInvalidBody, "Invalid request body")
 		return
 	}
-
-	now := time.Now()
-	s := FingerboardSession{
-		Date: input.Date, Location: input.Location, Exercises: input.Exercises, CreatedAt: now, UpdatedAt: now,
+	if verr := input.Validate(); verr != nil {
+		writeValidationError(w, r, verr)
+		return
 	}
-	docRef, _, err := GetCollectionByName(client, FingerboardCollection).Add(ctx, s)
+
+	s := input.toSession()
+	s, err := store.Create(ctx, s)
 	if err != nil {
-		http.Error(w, "Failed to create", http.StatusInternalServerError)
+		logFor(ctx).Error("create session failed", "collection", "fingerboard_sessions", "error", err)
+		writeError(w, r, http.StatusInternalServerError, CodeInternal, "Failed to create session")
 		return
 	}
-	s.ID = docRef.ID
+	setETag(w, &s)
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
 	json.NewEncoder(w).Encode(s)
 }
 
-// UpdateFingerboardSession
-func UpdateFingerboardSession(w http.ResponseWriter, r *http.Request, client *firestore.Client, id string) {
-	ctx := context.Background()
-	docRef := GetCollectionByName(client, FingerboardCollection).Doc(id)
-	if _, err := docRef.Get(ctx); err != nil {
-		http.Error(w, "Not found", http.StatusNotFound)
+// UpdateFingerboardSession replaces a fingerboard session, creating it if it does not exist
+func UpdateFingerboardSession(w http.ResponseWriter, r *http.Request, store SessionStore[FingerboardSession], id string) {
+	ctx, span := startHandlerSpan(r, "UpdateFingerboardSession", id)
+	defer span.End()
+
+	if !ValidSessionID(id) {
+		writeError(w, r, http.StatusBadRequest, CodeInvalidParameter, invalidSessionIDMessage)
 		return
 	}
-
 	var input FingerboardSessionInput
 	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
-		http.Error(w, "Invalid body", http.StatusBadRequest)
+		writeError(w, r, http.StatusBadRequest, CodeInvalidBody, "Invalid request body")
+		return
+	}
+	if verr := input.Validate(); verr != nil {
+		writeValidationError(w, r, verr)
 		return
 	}
 
-	updates := []firestore.Update{
-		{Path: "date", Value: input.Date},
-		{Path: "location", Value: input.Location},
-		{Path: "exercises", Value: input.Exercises},
-		{Path: "updatedAt", Value: time.Now()},
+	session, created, err := store.Put(ctx, id, func(s *FingerboardSession, exists bool) error {
+		if err := checkPutPreconditions(r, s, exists); err != nil {
+			return err
+		}
+		input.applyTo(s)
+		return nil
+	})
+	if errors.Is(err, errPreconditionFailed) {
+		writeError(w, r, http.StatusPreconditionFailed, CodePreconditionFailed, "Session has been modified, fetch it again")
+		return
 	}
-	if _, err := docRef.Update(ctx, updates); err != nil {
-		http.Error(w, "Update failed", http.StatusInternalServerError)
+	if err != nil {
+		logFor(ctx).Error("save session failed", "collection", "fingerboard_sessions", "session", id, "error", err)
+		writeError(w, r, http.StatusInternalServerError, CodeInternal, "Failed to save session")
 		return
 	}
-	GetFingerboardSession(w, r, client, id)
+
+	setETag(w, &session)
+	w.Header().Set("Content-Type", "application/json")
+	if created {
+		w.WriteHeader(http.StatusCreated)
+	}
+	json.NewEncoder(w).Encode(session)
 }
 
-// DeleteFingerboardSession
-func DeleteFingerboardSession(w http.ResponseWriter, r *http.Request, client *firestore.Client, id string) {
-	ctx := context.Background()
-	docRef := GetCollectionByName(client, FingerboardCollection).Doc(id)
+// PatchFingerboardSession applies a JSON Merge Patch or JSON Patch to an existing fingerboard session
+func PatchFingerboardSession(w http.ResponseWriter, r *http.Request, store SessionStore[FingerboardSession], id string) {
+	ctx, span := startHandlerSpan(r, "PatchFingerboardSession", id)
+	defer span.End()
+	patchSession[FingerboardSession, FingerboardSessionInput](w, r.WithContext(ctx), store, "fingerboard_sessions", id)
+}
 
-	if _, err := docRef.Get(ctx); err != nil {
-		http.Error(w, "Session not found", http.StatusNotFound)
+// DeleteFingerboardSession deletes a fingerboard session by ID
+func DeleteFingerboardSession(w http.ResponseWriter, r *http.Request, store SessionStore[FingerboardSession], id string) {
+	ctx, span := startHandlerSpan(r, "DeleteFingerboardSession", id)
+	defer span.End()
+	err := store.Delete(ctx, id, ifMatchCheck[FingerboardSession](r.Header.Get("If-Match")))
+	if errors.Is(err, ErrNotFound) {
+		writeError(w, r, http.StatusNotFound, CodeNotFound, "Session not found")
 		return
 	}
-
-	if _, err := docRef.Delete(ctx); err != nil {
-		http.Error(w, "Delete failed", http.StatusInternalServerError)
+	if errors.Is(err, errPreconditionFailed) {
+		writeError(w, r, http.StatusPreconditionFailed, CodePreconditionFailed, "Session has been modified, fetch it again")
+		return
+	}
+	if err != nil {
+		logFor(ctx).Error("delete session failed", "collection", "fingerboard_sessions", "session", id, "error", err)
+		writeError(w, r, http.StatusInternalServerError, CodeInternal, "Failed to delete session")
 		return
 	}
+	purgeTombstones(ctx, store)
 	w.WriteHeader(http.StatusNoContent)
 }
 
-// ParseCompetitionSessionID
+// ParseCompetitionSessionID extracts the session ID from path like /competition_sessions/{id}
 func ParseCompetitionSessionID(path string) string {
 	parts := strings.Split(strings.TrimPrefix(path, "/"), "/")
 	if len(parts) >= 2 && parts[0] == "competition_sessions" {
@@ -566,150 +511,150 @@ func ParseCompetitionSessionID(path string) string {
 	return ""
 }
 
-// ListCompetitionSessions
-func ListCompetitionSessions(w http.ResponseWriter, r *http.Request, client *firestore.Client) {
-	ctx := context.Background()
-	col := GetCollectionByName(client, CompetitionCollection)
-	startDate := r.URL.Query().Get("startDate")
-	endDate := r.URL.Query().Get("endDate")
-	query := col.OrderBy("date", firestore.Desc)
-	if startDate != "" {
-		query = query.Where("date", ">=", startDate)
+// ListCompetitionSessions returns all competition sessions, with optional date filtering
+func ListCompetitionSessions(w http.ResponseWriter, r *http.Request, store SessionStore[CompetitionSession]) {
+	ctx, span := startHandlerSpan(r, "ListCompetitionSessions", "")
+	defer span.End()
+	opts := listOptionsFromQuery(r)
+	if err := parsePage(r, &opts); err != nil {
+		writeError(w, r, http.StatusBadRequest, CodeInvalidParameter, err.Error())
+		return
 	}
-	if endDate != "" {
-		query = query.Where("date", "<=", endDate)
+	sessions, err := store.List(ctx, opts)
+	if err != nil {
+		logFor(ctx).Error("list sessions failed", "collection", "competition_sessions", "error", err)
+		writeError(w, r, http.StatusInternalServerError, CodeInternal, "Failed to fetch sessions")
+		return
 	}
-
-	// Check for incremental sync
-	since := r.URL.Query().Get("since")
-	if since != "" {
-		parsedTime, err := time.Parse(time.RFC3339, since)
-		if err == nil {
-			query = query.Where("updatedAt", ">", parsedTime)
-		}
+	deleted, err := listDeleted(ctx, r, store, opts)
+	if err != nil {
+		writeDeletedError(w, r, "competition_sessions", err)
+		return
 	}
 
-	iter := query.Documents(ctx)
-	defer iter.Stop()
-	var sessions []CompetitionSession
-	for {
-		doc, err := iter.Next()
-		if err == iterator.Done {
-			break
-		}
-		if err != nil {
-			http.Error(w, "Failed to fetch", http.StatusInternalServerError)
-			return
-		}
-		var s CompetitionSession
-		if err := doc.DataTo(&s); err == nil {
-			s.ID = doc.Ref.ID
-			sessions = append(sessions, s)
-		}
-	}
-	if sessions == nil {
-		sessions = []CompetitionSession{}
-	}
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(sessions)
+	writeSessions(w, opts, sessions, deleted)
 }
 
-// GetCompetitionSession
-func GetCompetitionSession(w http.ResponseWriter, r *http.Request, client *firestore.Client, id string) {
-	ctx := context.Background()
-	doc, err := GetCollectionByName(client, CompetitionCollection).Doc(id).Get(ctx)
-	if err != nil {
-		http.Error(w, "Not found", http.StatusNotFound)
+// GetCompetitionSession returns a single competition session by ID
+func GetCompetitionSession(w http.ResponseWriter, r *http.Request, store SessionStore[CompetitionSession], id string) {
+	ctx, span := startHandlerSpan(r, "GetCompetitionSession", id)
+	defer span.End()
+	s, err := store.Get(ctx, id)
+	if errors.Is(err, ErrNotFound) {
+		writeError(w, r, http.StatusNotFound, CodeNotFound, "Session not found")
 		return
 	}
-	var s CompetitionSession
-	if err := doc.DataTo(&s); err != nil {
-		http.Error(w, "Parse error", http.StatusInternalServerError)
+	if err != nil {
+		logFor(ctx).Error("get session failed", "collection", "competition_sessions", "session", id, "error", err)
+		writeError(w, r, http.StatusInternalServerError, CodeInternal, "Failed to fetch session")
 		return
 	}
-	s.ID = doc.Ref.ID
+	setETag(w, &s)
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(s)
 }
 
-// CreateCompetitionSession
-func CreateCompetitionSession(w http.ResponseWriter, r *http.Request, client *firestore.Client) {
-	ctx := context.Background()
+// CreateCompetitionSession creates a new competition session
+func CreateCompetitionSession(w http.ResponseWriter, r *http.Request, store SessionStore[CompetitionSession]) {
+	ctx, span := startHandlerSpan(r, "CreateCompetitionSession", "")
+	defer span.End()
 	var input CompetitionSessionInput
 	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
-		http.Error(w, "Invalid body", http.StatusBadRequest)
+		writeError(w, r, http.StatusBadRequest, CodeInvalidBody, "Invalid request body")
 		return
 	}
-
-	now := time.Now()
-	s := CompetitionSession{
-		Date: input.Date, Venue: input.Venue, CustomVenue: input.CustomVenue, Type: input.Type,
-		FingerLoad: input.FingerLoad, ShoulderLoad: input.ShoulderLoad, ForearmLoad: input.ForearmLoad,
-		Rounds: input.Rounds, Notes: input.Notes, CreatedAt: now, UpdatedAt: now,
+	if verr := input.Validate(); verr != nil {
+		writeValidationError(w, r, verr)
+		return
 	}
-	docRef, _, err := GetCollectionByName(client, CompetitionCollection).Add(ctx, s)
+
+	s := input.toSession()
+	s, err := store.Create(ctx, s)
 	if err != nil {
-		http.Error(w, "Failed to create", http.StatusInternalServerError)
+		logFor(ctx).Error("create session failed", "collection", "competition_sessions", "error", err)
+		writeError(w, r, http.StatusInternalServerError, CodeInternal, "Failed to create session")
 		return
 	}
-	s.ID = docRef.ID
+	setETag(w, &s)
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
 	json.NewEncoder(w).Encode(s)
 }
 
-// UpdateCompetitionSession
-func UpdateCompetitionSession(w http.ResponseWriter, r *http.Request, client *firestore.Client, id string) {
-	ctx := context.Background()
-	docRef := GetCollectionByName(client, CompetitionCollection).Doc(id)
-	if _, err := docRef.Get(ctx); err != nil {
-		http.Error(w, "Not found", http.StatusNotFound)
+// UpdateCompetitionSession replaces a competition session, creating it if it does not exist
+func UpdateCompetitionSession(w http.ResponseWriter, r *http.Request, store SessionStore[CompetitionSession], id string) {
+	ctx, span := startHandlerSpan(r, "UpdateCompetitionSession", id)
+	defer span.End()
+
+	if !ValidSessionID(id) {
+		writeError(w, r, http.StatusBadRequest, CodeInvalidParameter, invalidSessionIDMessage)
 		return
 	}
-
 	var input CompetitionSessionInput
 	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
-		http.Error(w, "Invalid body", http.StatusBadRequest)
+		writeError(w, r, http.StatusBadRequest, CodeInvalidBody, "Invalid request body")
+		return
+	}
+	if verr := input.Validate(); verr != nil {
+		writeValidationError(w, r, verr)
 		return
 	}
 
-	updates := []firestore.Update{
-		{Path: "date", Value: input.Date},
-		{Path: "venue", Value: input.Venue},
-		{Path: "customVenue", Value: input.CustomVenue},
-		{Path: "type", Value: input.Type},
-		{Path: "fingerLoad", Value: input.FingerLoad},
-		{Path: "shoulderLoad", Value: input.ShoulderLoad},
-		{Path: "forearmLoad", Value: input.ForearmLoad},
-		{Path: "rounds", Value: input.Rounds},
-		{Path: "notes", Value: input.Notes},
-		{Path: "updatedAt", Value: time.Now()},
+	session, created, err := store.Put(ctx, id, func(s *CompetitionSession, exists bool) error {
+		if err := checkPutPreconditions(r, s, exists); err != nil {
+			return err
+		}
+		input.applyTo(s)
+		return nil
+	})
+	if errors.Is(err, errPreconditionFailed) {
+		writeError(w, r, http.StatusPreconditionFailed, CodePreconditionFailed, "Session has been modified, fetch it again")
+		return
 	}
-	if _, err := docRef.Update(ctx, updates); err != nil {
-		http.Error(w, "Update failed", http.StatusInternalServerError)
+	if err != nil {
+		logFor(ctx).Error("save session failed", "collection", "competition_sessions", "session", id, "error", err)
+		writeError(w, r, http.StatusInternalServerError, CodeInternal, "Failed to save session")
 		return
 	}
-	GetCompetitionSession(w, r, client, id)
+
+	setETag(w, &session)
+	w.Header().Set("Content-Type", "application/json")
+	if created {
+		w.WriteHeader(http.StatusCreated)
+	}
+	json.NewEncoder(w).Encode(session)
 }
 
-// DeleteCompetitionSession
-func DeleteCompetitionSession(w http.ResponseWriter, r *http.Request, client *firestore.Client, id string) {
-	ctx := context.Background()
-	docRef := GetCollectionByName(client, CompetitionCollection).Doc(id)
+// PatchCompetitionSession applies a JSON Merge Patch or JSON Patch to an existing competition session
+func PatchCompetitionSession(w http.ResponseWriter, r *http.Request, store SessionStore[CompetitionSession], id string) {
+	ctx, span := startHandlerSpan(r, "PatchCompetitionSession", id)
+	defer span.End()
+	patchSession[CompetitionSession, CompetitionSessionInput](w, r.WithContext(ctx), store, "competition_sessions", id)
+}
 
-	if _, err := docRef.Get(ctx); err != nil {
-		http.Error(w, "Session not found", http.StatusNotFound)
+// DeleteCompetitionSession deletes a competition session by ID
+func DeleteCompetitionSession(w http.ResponseWriter, r *http.Request, store SessionStore[CompetitionSession], id string) {
+	ctx, span := startHandlerSpan(r, "DeleteCompetitionSession", id)
+	defer span.End()
+	err := store.Delete(ctx, id, ifMatchCheck[CompetitionSession](r.Header.Get("If-Match")))
+	if errors.Is(err, ErrNotFound) {
+		writeError(w, r, http.StatusNotFound, CodeNotFound, "Session not found")
 		return
 	}
-
-	if _, err := docRef.Delete(ctx); err != nil {
-		http.Error(w, "Delete failed", http.StatusInternalServerError)
+	if errors.Is(err, errPreconditionFailed) {
+		writeError(w, r, http.StatusPreconditionFailed, CodePreconditionFailed, "Session has been modified, fetch it again")
 		return
 	}
+	if err != nil {
+		logFor(ctx).Error("delete session failed", "collection", "competition_sessions", "session", id, "error", err)
+		writeError(w, r, http.StatusInternalServerError, CodeInternal, "Failed to delete session")
+		return
+	}
+	purgeTombstones(ctx, store)
 	w.WriteHeader(http.StatusNoContent)
 }
 
-// ParseGymSessionID wrapper
+// ParseGymSessionID extracts the session ID from path like /gym_sessions/{id}
 func ParseGymSessionID(path string) string {
 	parts := strings.Split(strings.TrimPrefix(path, "/"), "/")
 	if len(parts) >= 2 && parts[0] == "gym_sessions" {
@@ -718,139 +663,145 @@ func ParseGymSessionID(path string) string {
 	return ""
 }
 
-// ListGymSessions
-func ListGymSessions(w http.ResponseWriter, r *http.Request, client *firestore.Client) {
-	ctx := context.Background()
-	col := GetCollectionByName(client, GymCollection)
-	startDate := r.URL.Query().Get("startDate")
-	endDate := r.URL.Query().Get("endDate")
-	query := col.OrderBy("date", firestore.Desc)
-	if startDate != "" {
-		query = query.Where("date", ">=", startDate)
+// ListGymSessions returns all gym sessions, with optional date filtering
+func ListGymSessions(w http.ResponseWriter, r *http.Request, store SessionStore[GymSession]) {
+	ctx, span := startHandlerSpan(r, "ListGymSessions", "")
+	defer span.End()
+	opts := listOptionsFromQuery(r)
+	if err := parsePage(r, &opts); err != nil {
+		writeError(w, r, http.StatusBadRequest, CodeInvalidParameter, err.Error())
+		return
 	}
-	if endDate != "" {
-		query = query.Where("date", "<=", endDate)
+	sessions, err := store.List(ctx, opts)
+	if err != nil {
+		logFor(ctx).Error("list sessions failed", "collection", "gym_sessions", "error", err)
+		writeError(w, r, http.StatusInternalServerError, CodeInternal, "Failed to fetch sessions")
+		return
 	}
-
-	// Check for incremental sync
-	since := r.URL.Query().Get("since")
-	if since != "" {
-		parsedTime, err := time.Parse(time.RFC3339, since)
-		if err == nil {
-			query = query.Where("updatedAt", ">", parsedTime)
-		}
+	deleted, err := listDeleted(ctx, r, store, opts)
+	if err != nil {
+		writeDeletedError(w, r, "gym_sessions", err)
+		return
 	}
 
-	iter := query.Documents(ctx)
-	defer iter.Stop()
-	var sessions []GymSession
-	for {
-		doc, err := iter.Next()
-		if err == iterator.Done {
-			break
-		}
-		if err != nil {
-			http.Error(w, "Failed to fetch", http.StatusInternalServerError)
-			return
-		}
-		var s GymSession
-		if err := doc.DataTo(&s); err == nil {
-			s.ID = doc.Ref.ID
-			sessions = append(sessions, s)
-		}
-	}
-	if sessions == nil {
-		sessions = []GymSession{}
-	}
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(sessions)
+	writeSessions(w, opts, sessions, deleted)
 }
 
-// GetGymSession
-func GetGymSession(w http.ResponseWriter, r *http.Request, client *firestore.Client, id string) {
-	ctx := context.Background()
-	doc, err := GetCollectionByName(client, GymCollection).Doc(id).Get(ctx)
-	if err != nil {
-		http.Error(w, "Not found", http.StatusNotFound)
+// GetGymSession returns a single gym session by ID
+func GetGymSession(w http.ResponseWriter, r *http.Request, store SessionStore[GymSession], id string) {
+	ctx, span := startHandlerSpan(r, "GetGymSession", id)
+	defer span.End()
+	s, err := store.Get(ctx, id)
+	if errors.Is(err, ErrNotFound) {
+		writeError(w, r, http.StatusNotFound, CodeNotFound, "Session not found")
 		return
 	}
-	var s GymSession
-	if err := doc.DataTo(&s); err != nil {
-		http.Error(w, "Parse error", http.StatusInternalServerError)
+	if err != nil {
+		logFor(ctx).Error("get session failed", "collection", "gym_sessions", "session", id, "error", err)
+		writeError(w, r, http.StatusInternalServerError, CodeInternal, "Failed to fetch session")
 		return
 	}
-	s.ID = doc.Ref.ID
+	setETag(w, &s)
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(s)
 }
 
-// CreateGymSession
-func CreateGymSession(w http.ResponseWriter, r *http.Request, client *firestore.Client) {
-	ctx := context.Background()
+// CreateGymSession creates a new gym session
+func CreateGymSession(w http.ResponseWriter, r *http.Request, store SessionStore[GymSession]) {
+	ctx, span := startHandlerSpan(r, "CreateGymSession", "")
+	defer span.End()
 	var input GymSessionInput
 	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
-		http.Error(w, "Invalid body", http.StatusBadRequest)
+		writeError(w, r, http.StatusBadRequest, CodeInvalidBody, "Invalid request body")
 		return
 	}
-
-	now := time.Now()
-	s := GymSession{
-		Date: input.Date, Name: input.Name, Bodyweight: input.Bodyweight, TrainingBlock: input.TrainingBlock, Exercises: input.Exercises, CreatedAt: now, UpdatedAt: now,
+	if verr := input.Validate(); verr != nil {
+		writeValidationError(w, r, verr)
+		return
 	}
-	docRef, _, err := GetCollectionByName(client, GymCollection).Add(ctx, s)
+
+	s := input.toSession()
+	s, err := store.Create(ctx, s)
 	if err != nil {
-		http.Error(w, "Failed to create", http.StatusInternalServerError)
+		logFor(ctx).Error("create session failed", "collection", "gym_sessions", "error", err)
+		writeError(w, r, http.StatusInternalServerError, CodeInternal, "Failed to create session")
 		return
 	}
-	s.ID = docRef.ID
+	setETag(w, &s)
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
 	json.NewEncoder(w).Encode(s)
 }
 
-// UpdateGymSession
-func UpdateGymSession(w http.ResponseWriter, r *http.Request, client *firestore.Client, id string) {
-	ctx := context.Background()
-	docRef := GetCollectionByName(client, GymCollection).Doc(id)
-	if _, err := docRef.Get(ctx); err != nil {
-		http.Error(w, "Not found", http.StatusNotFound)
+// UpdateGymSession replaces a gym session, creating it if it does not exist
+func UpdateGymSession(w http.ResponseWriter, r *http.Request, store SessionStore[GymSession], id string) {
+	ctx, span := startHandlerSpan(r, "UpdateGymSession", id)
+	defer span.End()
+
+	if !ValidSessionID(id) {
+		writeError(w, r, http.StatusBadRequest, CodeInvalidParameter, invalidSessionIDMessage)
 		return
 	}
-
 	var input GymSessionInput
 	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
-		http.Error(w, "Invalid body", http.StatusBadRequest)
+		writeError(w, r, http.StatusBadRequest, CodeInvalidBody, "Invalid request body")
+		return
+	}
+	if verr := input.Validate(); verr != nil {
+		writeValidationError(w, r, verr)
 		return
 	}
 
-	updates := []firestore.Update{
-		{Path: "date", Value: input.Date},
-		{Path: "name", Value: input.Name},
-		{Path: "bodyweight", Value: input.Bodyweight},
-		{Path: "trainingBlock", Value: input.TrainingBlock},
-		{Path: "exercises", Value: input.Exercises},
-		{Path: "updatedAt", Value: time.Now()},
+	session, created, err := store.Put(ctx, id, func(s *GymSession, exists bool) error {
+		if err := checkPutPreconditions(r, s, exists); err != nil {
+			return err
+		}
+		input.applyTo(s)
+		return nil
+	})
+	if errors.Is(err, errPreconditionFailed) {
+		writeError(w, r, http.StatusPreconditionFailed, CodePreconditionFailed, "Session has been modified, fetch it again")
+		return
 	}
-	if _, err := docRef.Update(ctx, updates); err != nil {
-		http.Error(w, "Update failed", http.StatusInternalServerError)
+	if err != nil {
+		logFor(ctx).Error("save session failed", "collection", "gym_sessions", "session", id, "error", err)
+		writeError(w, r, http.StatusInternalServerError, CodeInternal, "Failed to save session")
 		return
 	}
-	GetGymSession(w, r, client, id)
+
+	setETag(w, &session)
+	w.Header().Set("Content-Type", "application/json")
+	if created {
+		w.WriteHeader(http.StatusCreated)
+	}
+	json.NewEncoder(w).Encode(session)
 }
 
-// DeleteGymSession
-func DeleteGymSession(w http.ResponseWriter, r *http.Request, client *firestore.Client, id string) {
-	ctx := context.Background()
-	docRef := GetCollectionByName(client, GymCollection).Doc(id)
+// PatchGymSession applies a JSON Merge Patch or JSON Patch to an existing gym session
+func PatchGymSession(w http.ResponseWriter, r *http.Request, store SessionStore[GymSession], id string) {
+	ctx, span := startHandlerSpan(r, "PatchGymSession", id)
+	defer span.End()
+	patchSession[GymSession, GymSessionInput](w, r.WithContext(ctx), store, "gym_sessions", id)
+}
 
-	if _, err := docRef.Get(ctx); err != nil {
-		http.Error(w, "Session not found", http.StatusNotFound)
+// DeleteGymSession deletes a gym session by ID
+func DeleteGymSession(w http.ResponseWriter, r *http.Request, store SessionStore[GymSession], id string) {
+	ctx, span := startHandlerSpan(r, "DeleteGymSession", id)
+	defer span.End()
+	err := store.Delete(ctx, id, ifMatchCheck[GymSession](r.Header.Get("If-Match")))
+	if errors.Is(err, ErrNotFound) {
+		writeError(w, r, http.StatusNotFound, CodeNotFound, "Session not found")
 		return
 	}
-
-	if _, err := docRef.Delete(ctx); err != nil {
-		http.Error(w, "Delete failed", http.StatusInternalServerError)
+	if errors.Is(err, errPreconditionFailed) {
+		writeError(w, r, http.StatusPreconditionFailed, CodePreconditionFailed, "Session has been modified, fetch it again")
+		return
+	}
+	if err != nil {
+		logFor(ctx).Error("delete session failed", "collection", "gym_sessions", "session", id, "error", err)
+		writeError(w, r, http.StatusInternalServerError, CodeInternal, "Failed to delete session")
 		return
 	}
+	purgeTombstones(ctx, store)
 	w.WriteHeader(http.StatusNoContent)
 }
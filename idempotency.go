@@ -0,0 +1,163 @@
+package function
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"os"
+	"time"
+)
+
+// DefaultIdempotencyWindow is how long an Idempotency-Key is remembered
+// unless IDEMPOTENCY_WINDOW overrides it
+const DefaultIdempotencyWindow = 24 * time.Hour
+
+// MaxIdempotencyKeyLength caps the Idempotency-Key header
+const MaxIdempotencyKeyLength = 255
+
+// IdempotencyRecord remembers the response to a request sent with an
+// Idempotency-Key. A record is reserved before the request runs and
+// completed with its response afterwards.
+type IdempotencyRecord struct {
+	Key         string            `firestore:"-"`           // Hash of the caller, their credential and Idempotency-Key
+	Fingerprint string            `firestore:"fingerprint"` // Hash of the method, path and body
+	Completed   bool              `firestore:"completed"`
+	Status      int               `firestore:"status"`
+	Header      map[string]string `firestore:"header"`
+	Body        []byte            `firestore:"body"`
+	CreatedAt   time.Time         `firestore:"createdAt"`
+	ExpiresAt   time.Time         `firestore:"expiresAt"` // Also usable as a Firestore TTL policy field
+}
+
+// IdempotencyStore persists IdempotencyRecords
+type IdempotencyStore interface {
+	// Reserve stores rec unless an unexpired record exists under rec.Key,
+	// in which case nothing is stored and the existing record is returned
+	Reserve(ctx context.Context, rec IdempotencyRecord) (*IdempotencyRecord, error)
+	// Complete saves the response of a reserved request
+	Complete(ctx context.Context, rec IdempotencyRecord) error
+	// Release drops a reservation so the request can be retried
+	Release(ctx context.Context, key string) error
+}
+
+// IdempotencyWindow returns the configured idempotency window
+func IdempotencyWindow() time.Duration {
+	if d, err := time.ParseDuration(os.Getenv("IDEMPOTENCY_WINDOW")); err == nil && d > 0 {
+		return d
+	}
+	return DefaultIdempotencyWindow
+}
+
+// replayedHeaders are saved with a response and sent again on replay
+var replayedHeaders = []string{"Content-Type", "ETag"}
+
+// serveIdempotent runs next at most once per Idempotency-Key. A repeat of a
+// completed request gets the original response back; a repeat with a
+// different method, path or body, or one arriving while the first is still
+// running, gets 409. Only successful responses are kept: a failed request
+// releases its key so the client can fix it and retry.
+func serveIdempotent(w http.ResponseWriter, r *http.Request, store IdempotencyStore, next http.HandlerFunc) {
+	ctx := r.Context()
+
+	key := r.Header.Get("Idempotency-Key")
+	if len(key) > MaxIdempotencyKeyLength {
+		writeError(w, r, http.StatusBadRequest, CodeInvalidParameter, "Idempotency-Key is too long")
+		return
+	}
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, CodeInvalidBody, "Invalid request body")
+		return
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+
+	// Keys are scoped to the credential as well as the user, so two admin
+	// keys or two of a user's tokens never replay each other's responses
+	principal := PrincipalFromContext(ctx)
+	now := storeNow()
+	rec := IdempotencyRecord{
+		Key:         hashParts(principal.UserID, principal.Name, key),
+		Fingerprint: hashParts(r.Method, r.URL.Path, string(body)),
+		CreatedAt:   now,
+		ExpiresAt:   now.Add(IdempotencyWindow()),
+	}
+	existing, err := store.Reserve(ctx, rec)
+	if err != nil {
+		logFor(ctx).Error("reserve idempotency key failed", "error", err)
+		writeError(w, r, http.StatusInternalServerError, CodeInternal, "Failed to check Idempotency-Key")
+		return
+	}
+	if existing != nil {
+		switch {
+		case existing.Fingerprint != rec.Fingerprint:
+			writeError(w, r, http.StatusConflict, CodeIdempotencyConflict, "Idempotency-Key was already used for a different request")
+		case !existing.Completed:
+			writeError(w, r, http.StatusConflict, CodeIdempotencyConflict, "A request with this Idempotency-Key is still in progress")
+		default:
+			for name, value := range existing.Header {
+				w.Header().Set(name, value)
+			}
+			w.Header().Set("Idempotent-Replayed", "true")
+			w.WriteHeader(existing.Status)
+			w.Write(existing.Body)
+		}
+		return
+	}
+
+	rw := &responseRecorder{ResponseWriter: w}
+	next(rw, r)
+
+	// Record the outcome even if the request's deadline has just passed
+	ctx = context.WithoutCancel(ctx)
+
+	if rw.status < 200 || rw.status > 299 {
+		store.Release(ctx, rec.Key)
+		return
+	}
+	rec.Completed, rec.Status, rec.Body = true, rw.status, rw.body.Bytes()
+	rec.Header = map[string]string{}
+	for _, name := range replayedHeaders {
+		if value := w.Header().Get(name); value != "" {
+			rec.Header[name] = value
+		}
+	}
+	if err := store.Complete(ctx, rec); err != nil {
+		// Better to risk a duplicate on retry than leave the key stuck in progress
+		store.Release(ctx, rec.Key)
+	}
+}
+
+// hashParts hashes strings unambiguously into a hex digest
+func hashParts(parts ...string) string {
+	h := sha256.New()
+	for _, p := range parts {
+		h.Write([]byte(p))
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// responseRecorder passes a response through while keeping its status and body
+type responseRecorder struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (rw *responseRecorder) WriteHeader(status int) {
+	if rw.status == 0 {
+		rw.status = status
+	}
+	rw.ResponseWriter.WriteHeader(status)
+}
+
+func (rw *responseRecorder) Write(b []byte) (int, error) {
+	if rw.status == 0 {
+		rw.status = http.StatusOK
+	}
+	rw.body.Write(b)
+	return rw.ResponseWriter.Write(b)
+}
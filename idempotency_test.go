@@ -0,0 +1,40 @@
+package function
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestIdempotencyKeyScopedToCredential(t *testing.T) {
+	useMemoryBackend(t)
+	t.Setenv("APP_SECRET_KEYS", "ci:ci-secret,ops:ops-secret")
+	handler := NewHandler(NewMemoryBackend())
+
+	create := func(apiKey string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest("POST", "/indoor_sessions", strings.NewReader(`{"date":"2024-05-01"}`))
+		r.Header.Set("x-api-key", apiKey)
+		r.Header.Set("Idempotency-Key", "same-key")
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		if w.Code != http.StatusCreated {
+			t.Fatalf("create as %s: got %d %s", apiKey, w.Code, w.Body.String())
+		}
+		return w
+	}
+
+	first := create("ci-secret")
+	if replay := create("ci-secret"); replay.Header().Get("Idempotent-Replayed") != "true" || replay.Body.String() != first.Body.String() {
+		t.Errorf("retry with the same key was not replayed: %s", replay.Body.String())
+	}
+	// Both keys are admins with no user ID, but a different credential gets
+	// its own request rather than the other key's response
+	other := create("ops-secret")
+	if other.Header().Get("Idempotent-Replayed") != "" || other.Body.String() == first.Body.String() {
+		t.Errorf("another admin key replayed the first key's response: %s", other.Body.String())
+	}
+	if n := countSessions(t, handler, "indoor_sessions"); n != 2 {
+		t.Errorf("indoor sessions = %d, want 2", n)
+	}
+}
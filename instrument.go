@@ -0,0 +1,109 @@
+package function
+
+import (
+	"context"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// instrumentStores wraps every store so its operations are measured and
+// traced, including those made in a transaction
+func instrumentStores(s *Stores) *Stores {
+	return &Stores{
+		Indoor:      instrumentedStore[IndoorSession]{s.Indoor, "indoor_sessions"},
+		Outdoor:     instrumentedStore[OutdoorSession]{s.Outdoor, "outdoor_sessions"},
+		Fingerboard: instrumentedStore[FingerboardSession]{s.Fingerboard, "fingerboard_sessions"},
+		Competition: instrumentedStore[CompetitionSession]{s.Competition, "competition_sessions"},
+		Gym:         instrumentedStore[GymSession]{s.Gym, "gym_sessions"},
+		runTx: func(ctx context.Context, fn func(*Stores) error) error {
+			return s.RunTransaction(ctx, func(tx *Stores) error {
+				return fn(instrumentStores(tx))
+			})
+		},
+	}
+}
+
+// instrumentedStore is a SessionStore that records metrics and a span for each call
+type instrumentedStore[T any] struct {
+	store      SessionStore[T]
+	collection string
+}
+
+func (s instrumentedStore[T]) List(ctx context.Context, opts ListOptions) (sessions []T, err error) {
+	ctx, span := startStoreSpan(ctx, s.collection, "list", "")
+	defer func(start time.Time) {
+		observeStore(s.collection, "list", start, err)
+		endStoreSpan(span, err)
+	}(time.Now())
+	sessions, err = s.store.List(ctx, opts)
+	span.SetAttributes(attribute.Int("db.response.returned_rows", len(sessions)))
+	return sessions, err
+}
+
+func (s instrumentedStore[T]) Get(ctx context.Context, id string) (session T, err error) {
+	ctx, span := startStoreSpan(ctx, s.collection, "get", id)
+	defer func(start time.Time) {
+		observeStore(s.collection, "get", start, err)
+		endStoreSpan(span, err)
+	}(time.Now())
+	return s.store.Get(ctx, id)
+}
+
+func (s instrumentedStore[T]) Create(ctx context.Context, session T) (created T, err error) {
+	ctx, span := startStoreSpan(ctx, s.collection, "create", "")
+	defer func(start time.Time) {
+		observeStore(s.collection, "create", start, err)
+		endStoreSpan(span, err)
+	}(time.Now())
+	created, err = s.store.Create(ctx, session)
+	if r, ok := any(&created).(record); ok && err == nil {
+		span.SetAttributes(attribute.String("session.id", r.getID()))
+	}
+	return created, err
+}
+
+func (s instrumentedStore[T]) Update(ctx context.Context, id string, apply func(*T) error) (updated T, err error) {
+	ctx, span := startStoreSpan(ctx, s.collection, "update", id)
+	defer func(start time.Time) {
+		observeStore(s.collection, "update", start, err)
+		endStoreSpan(span, err)
+	}(time.Now())
+	return s.store.Update(ctx, id, apply)
+}
+
+func (s instrumentedStore[T]) Put(ctx context.Context, id string, apply func(*T, bool) error) (session T, created bool, err error) {
+	ctx, span := startStoreSpan(ctx, s.collection, "put", id)
+	defer func(start time.Time) {
+		observeStore(s.collection, "put", start, err)
+		endStoreSpan(span, err)
+	}(time.Now())
+	return s.store.Put(ctx, id, apply)
+}
+
+func (s instrumentedStore[T]) Delete(ctx context.Context, id string, check func(*T) error) (err error) {
+	ctx, span := startStoreSpan(ctx, s.collection, "delete", id)
+	defer func(start time.Time) {
+		observeStore(s.collection, "delete", start, err)
+		endStoreSpan(span, err)
+	}(time.Now())
+	return s.store.Delete(ctx, id, check)
+}
+
+func (s instrumentedStore[T]) Deleted(ctx context.Context, since time.Time) (tombstones []Tombstone, err error) {
+	ctx, span := startStoreSpan(ctx, s.collection, "deleted", "")
+	defer func(start time.Time) {
+		observeStore(s.collection, "deleted", start, err)
+		endStoreSpan(span, err)
+	}(time.Now())
+	return s.store.Deleted(ctx, since)
+}
+
+func (s instrumentedStore[T]) PurgeTombstones(ctx context.Context, cutoff time.Time) (err error) {
+	ctx, span := startStoreSpan(ctx, s.collection, "purge_tombstones", "")
+	defer func(start time.Time) {
+		observeStore(s.collection, "purge_tombstones", start, err)
+		endStoreSpan(span, err)
+	}(time.Now())
+	return s.store.PurgeTombstones(ctx, cutoff)
+}
@@ -0,0 +1,409 @@
+package function
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Bearer token verification. With JWT_JWKS set, requests may authenticate
+// with "Authorization: Bearer <jwt>" instead of x-api-key. JWT_JWKS is a
+// JWKS URL (https://...) or a local file path; JWT_ISSUER and JWT_AUDIENCE
+// (comma separated) are required alongside it. The sub claim becomes the
+// caller's user ID, so e.g. a Firebase Auth uid owns users/{uid}/....
+const (
+	// JWKSRefreshInterval is how long keys fetched from a JWKS URL are cached
+	JWKSRefreshInterval = time.Hour
+	// jwksMinRefetch rate limits refetching a JWKS URL for an unknown key ID
+	jwksMinRefetch = time.Minute
+	// jwksFetchTimeout bounds a JWKS fetch, which no single request owns
+	jwksFetchTimeout = 10 * time.Second
+	// jwtLeeway tolerates clock skew when checking exp, nbf and iat
+	jwtLeeway = time.Minute
+)
+
+// jwksClient fetches remote key sets
+var jwksClient = &http.Client{Timeout: jwksFetchTimeout}
+
+// errInvalidToken means a bearer token failed verification
+var errInvalidToken = errors.New("invalid bearer token")
+
+// JWTVerifier verifies bearer tokens against a JWKS
+type JWTVerifier struct {
+	issuer    string
+	audiences []string
+	keys      *jwks
+}
+
+// NewJWTVerifier returns a verifier for tokens signed by a key in the JWKS at
+// location (a URL or file path), issued by issuer for one of audiences
+func NewJWTVerifier(location, issuer string, audiences []string) (*JWTVerifier, error) {
+	if issuer == "" || len(audiences) == 0 {
+		return nil, errors.New("JWT_ISSUER and JWT_AUDIENCE are required with JWT_JWKS")
+	}
+	keys := &jwks{location: location}
+	if !keys.remote() {
+		// Load local files up front so a bad path fails immediately
+		var err error
+		if keys.keys, err = keys.fetch(); err != nil {
+			return nil, err
+		}
+	}
+	return &JWTVerifier{issuer: issuer, audiences: audiences, keys: keys}, nil
+}
+
+// jwtVerifier verifies bearer tokens, or is nil when they are not enabled.
+// SetupJWT sets it at startup.
+var jwtVerifier *JWTVerifier
+
+// jwtSetupErr is the error from the last SetupJWT, which makes every
+// request fail rather than ignore a broken bearer token configuration
+var jwtSetupErr error
+
+// SetupJWT builds the bearer token verifier configured by JWT_JWKS,
+// JWT_ISSUER and JWT_AUDIENCE. It runs when the package is initialised, and
+// servers call it again at startup so a bad configuration stops them
+// immediately; the Cloud Function refuses requests instead.
+func SetupJWT() error {
+	jwtVerifier, jwtSetupErr = nil, nil
+	location := os.Getenv("JWT_JWKS")
+	if location == "" {
+		return nil
+	}
+	var audiences []string
+	for _, aud := range strings.Split(os.Getenv("JWT_AUDIENCE"), ",") {
+		if aud = strings.TrimSpace(aud); aud != "" {
+			audiences = append(audiences, aud)
+		}
+	}
+	jwtVerifier, jwtSetupErr = NewJWTVerifier(location, os.Getenv("JWT_ISSUER"), audiences)
+	if jwtSetupErr != nil {
+		jwtSetupErr = fmt.Errorf("configuring JWT_JWKS: %w", jwtSetupErr)
+	}
+	return jwtSetupErr
+}
+
+// jwtClaims holds the registered claims checked by Verify
+type jwtClaims struct {
+	Issuer    string      `json:"iss"`
+	Subject   string      `json:"sub"`
+	Audience  jwtAudience `json:"aud"`
+	ExpiresAt *int64      `json:"exp"`
+	NotBefore *int64      `json:"nbf"`
+	IssuedAt  *int64      `json:"iat"`
+}
+
+// jwtAudience accepts the aud claim as a single string or an array
+type jwtAudience []string
+
+func (a *jwtAudience) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*a = jwtAudience{single}
+		return nil
+	}
+	var list []string
+	if err := json.Unmarshal(data, &list); err != nil {
+		return err
+	}
+	*a = list
+	return nil
+}
+
+// Verify checks the token's signature, issuer, audience and lifetime and
+// returns its subject
+func (v *JWTVerifier) Verify(ctx context.Context, token string) (string, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return "", fmt.Errorf("%w: malformed", errInvalidToken)
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return "", fmt.Errorf("%w: header: %v", errInvalidToken, err)
+	}
+	key, err := v.keys.key(ctx, header.Kid)
+	if err != nil {
+		return "", err
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return "", fmt.Errorf("%w: signature: %v", errInvalidToken, err)
+	}
+	if err := verifySignature(header.Alg, key, parts[0]+"."+parts[1], signature); err != nil {
+		return "", err
+	}
+
+	var claims jwtClaims
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return "", fmt.Errorf("%w: claims: %v", errInvalidToken, err)
+	}
+	return v.checkClaims(claims, time.Now())
+}
+
+// checkClaims validates the registered claims at now and returns the subject
+func (v *JWTVerifier) checkClaims(claims jwtClaims, now time.Time) (string, error) {
+	if claims.Issuer != v.issuer {
+		return "", fmt.Errorf("%w: unexpected issuer %q", errInvalidToken, claims.Issuer)
+	}
+	if !audienceMatches(claims.Audience, v.audiences) {
+		return "", fmt.Errorf("%w: unexpected audience", errInvalidToken)
+	}
+	if claims.ExpiresAt == nil || now.After(time.Unix(*claims.ExpiresAt, 0).Add(jwtLeeway)) {
+		return "", fmt.Errorf("%w: expired", errInvalidToken)
+	}
+	if claims.NotBefore != nil && now.Add(jwtLeeway).Before(time.Unix(*claims.NotBefore, 0)) {
+		return "", fmt.Errorf("%w: not yet valid", errInvalidToken)
+	}
+	if claims.IssuedAt != nil && now.Add(jwtLeeway).Before(time.Unix(*claims.IssuedAt, 0)) {
+		return "", fmt.Errorf("%w: issued in the future", errInvalidToken)
+	}
+	// The subject names a Firestore document, so it must be a valid document ID
+	if !validDocID(claims.Subject) {
+		return "", fmt.Errorf("%w: invalid subject", errInvalidToken)
+	}
+	return claims.Subject, nil
+}
+
+func audienceMatches(got jwtAudience, want []string) bool {
+	for _, g := range got {
+		for _, w := range want {
+			if g == w {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// decodeSegment decodes one base64url JSON segment of a JWT
+func decodeSegment(segment string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// verifySignature checks an RS256/384/512 or ES256/384 signature. Other
+// algorithms, notably "none" and the HMAC family, are rejected, as is an ES
+// algorithm on a key of the other curve.
+func verifySignature(alg string, key crypto.PublicKey, signed string, signature []byte) error {
+	var hash crypto.Hash
+	switch alg {
+	case "RS256", "ES256":
+		hash = crypto.SHA256
+	case "RS384", "ES384":
+		hash = crypto.SHA384
+	case "RS512":
+		hash = crypto.SHA512
+	default:
+		return fmt.Errorf("%w: unsupported algorithm %q", errInvalidToken, alg)
+	}
+	h := hash.New()
+	h.Write([]byte(signed))
+	digest := h.Sum(nil)
+
+	switch key := key.(type) {
+	case *rsa.PublicKey:
+		if alg[0] != 'R' || rsa.VerifyPKCS1v15(key, hash, digest, signature) != nil {
+			return fmt.Errorf("%w: bad signature", errInvalidToken)
+		}
+	case *ecdsa.PublicKey:
+		if curve := key.Curve.Params().Name; alg == "ES256" && curve != "P-256" || alg == "ES384" && curve != "P-384" {
+			return fmt.Errorf("%w: %s does not match the %s key", errInvalidToken, alg, curve)
+		}
+		size := (key.Curve.Params().BitSize + 7) / 8
+		if alg[0] != 'E' || len(signature) != 2*size {
+			return fmt.Errorf("%w: bad signature", errInvalidToken)
+		}
+		r := new(big.Int).SetBytes(signature[:size])
+		s := new(big.Int).SetBytes(signature[size:])
+		if !ecdsa.Verify(key, digest, r, s) {
+			return fmt.Errorf("%w: bad signature", errInvalidToken)
+		}
+	default:
+		return fmt.Errorf("%w: unsupported key type", errInvalidToken)
+	}
+	return nil
+}
+
+// jwks caches the public keys of a JSON Web Key Set by key ID. A remote set
+// is fetched by one background goroutine at a time, without holding mu, so
+// a slow JWKS endpoint never blocks requests whose keys are cached.
+type jwks struct {
+	location string
+
+	mu       sync.Mutex
+	keys     map[string]crypto.PublicKey
+	fetched  time.Time
+	fetching chan struct{} // Closed when the fetch in flight completes
+	err      error         // Error of the last fetch
+}
+
+func (k *jwks) remote() bool {
+	return strings.HasPrefix(k.location, "https://") || strings.HasPrefix(k.location, "http://")
+}
+
+// key returns the key with the given ID, refreshing a remote set when it is
+// stale or does not know the ID (the provider may have rotated keys)
+func (k *jwks) key(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	k.mu.Lock()
+	var done <-chan struct{}
+	if k.remote() {
+		age := time.Since(k.fetched)
+		_, known := k.keys[kid]
+		if age > JWKSRefreshInterval || (!known && age > jwksMinRefetch) {
+			done = k.refreshLocked()
+		} else if !known {
+			done = k.fetching // The fetch in flight may bring the key
+		}
+	}
+	k.mu.Unlock()
+
+	if done != nil {
+		select {
+		case <-done:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if k.keys == nil && k.err != nil {
+		return nil, k.err
+	}
+	key, ok := k.keys[kid]
+	if !ok && kid == "" && len(k.keys) == 1 {
+		for _, only := range k.keys {
+			key, ok = only, true // Tokens may omit kid when the set holds one key
+		}
+	}
+	if !ok {
+		return nil, fmt.Errorf("%w: unknown key %q", errInvalidToken, kid)
+	}
+	return key, nil
+}
+
+// refreshLocked starts fetching the key set unless a fetch is already in
+// flight, and returns a channel closed when it completes. On failure the
+// previous keys stay in use.
+func (k *jwks) refreshLocked() <-chan struct{} {
+	if k.fetching != nil {
+		return k.fetching
+	}
+	k.fetched = time.Now()
+	done := make(chan struct{})
+	k.fetching = done
+	go func() {
+		keys, err := k.fetch()
+		k.mu.Lock()
+		defer k.mu.Unlock()
+		if err == nil {
+			k.keys = keys
+		}
+		k.err, k.fetching = err, nil
+		close(done)
+	}()
+	return done
+}
+
+// fetch reads and parses the key set
+func (k *jwks) fetch() (map[string]crypto.PublicKey, error) {
+	var data []byte
+	if k.remote() {
+		resp, err := jwksClient.Get(k.location)
+		if err != nil {
+			return nil, fmt.Errorf("fetching JWKS: %w", err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("fetching JWKS: status %d", resp.StatusCode)
+		}
+		if data, err = io.ReadAll(io.LimitReader(resp.Body, 1<<20)); err != nil {
+			return nil, fmt.Errorf("fetching JWKS: %w", err)
+		}
+	} else {
+		var err error
+		if data, err = os.ReadFile(k.location); err != nil {
+			return nil, fmt.Errorf("reading JWKS: %w", err)
+		}
+	}
+	return parseJWKS(data)
+}
+
+// parseJWKS decodes the RSA and EC signing keys of a JWKS document
+func parseJWKS(data []byte) (map[string]crypto.PublicKey, error) {
+	var set struct {
+		Keys []struct {
+			Kty string `json:"kty"`
+			Kid string `json:"kid"`
+			Use string `json:"use"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+			Crv string `json:"crv"`
+			X   string `json:"x"`
+			Y   string `json:"y"`
+		} `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, fmt.Errorf("parsing JWKS: %w", err)
+	}
+
+	keys := make(map[string]crypto.PublicKey)
+	for _, jwk := range set.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		switch jwk.Kty {
+		case "RSA":
+			n, errN := base64.RawURLEncoding.DecodeString(jwk.N)
+			e, errE := base64.RawURLEncoding.DecodeString(jwk.E)
+			if errN != nil || errE != nil || len(e) > 4 {
+				continue // Skip malformed keys
+			}
+			keys[jwk.Kid] = &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+		case "EC":
+			var curve elliptic.Curve
+			switch jwk.Crv {
+			case "P-256":
+				curve = elliptic.P256()
+			case "P-384":
+				curve = elliptic.P384()
+			default:
+				continue
+			}
+			x, errX := base64.RawURLEncoding.DecodeString(jwk.X)
+			y, errY := base64.RawURLEncoding.DecodeString(jwk.Y)
+			if errX != nil || errY != nil {
+				continue // Skip malformed keys
+			}
+			key := &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+			if !curve.IsOnCurve(key.X, key.Y) {
+				continue
+			}
+			keys[jwk.Kid] = key
+		}
+	}
+	if len(keys) == 0 {
+		return nil, errors.New("JWKS contains no usable signing keys")
+	}
+	return keys, nil
+}
@@ -0,0 +1,211 @@
+package function
+
+import (
+	"errors"
+	"io"
+	"math"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// Request limits, read from the environment:
+//
+//	MAX_BODY_BYTES        largest request body accepted, default 1 MiB
+//	MAX_BATCH_BODY_BYTES  largest POST /batch body, default 8 MiB
+//	RATE_LIMIT            sustained requests per second allowed per credential; unset or 0 disables
+//	RATE_LIMIT_BURST      requests a credential may make at once, default 40
+//
+// Failed authentication attempts are limited the same way per client address.
+// Rate limiting is off unless RATE_LIMIT is set. Limits are kept in memory,
+// so each instance enforces them on its own.
+const (
+	DefaultMaxBodyBytes      = 1 << 20 // Firestore's own document size limit
+	DefaultMaxBatchBodyBytes = 8 << 20
+	DefaultRateLimitBurst    = 40
+)
+
+// maxBodyBytes returns the body size cap for a request
+func maxBodyBytes(r *http.Request) int64 {
+	if r.URL.Path == "/batch" {
+		return envInt64("MAX_BATCH_BODY_BYTES", DefaultMaxBatchBodyBytes)
+	}
+	return envInt64("MAX_BODY_BYTES", DefaultMaxBodyBytes)
+}
+
+// limitBody caps the request body. It reports false, having sent 413, when
+// the declared Content-Length is already over the cap; a body that turns out
+// longer fails to read and is reported as 413 by writeAPIError.
+func limitBody(w http.ResponseWriter, r *http.Request) bool {
+	limit := maxBodyBytes(r)
+	if r.ContentLength > limit {
+		writeBodyTooLarge(w, r, limit)
+		return false
+	}
+	r.Body = &limitedBody{ReadCloser: http.MaxBytesReader(w, r.Body, limit), limit: limit}
+	return true
+}
+
+// limitedBody remembers whether the body went over its cap so the error
+// response can say so, whichever handler was reading it
+type limitedBody struct {
+	io.ReadCloser
+	limit    int64
+	exceeded bool
+}
+
+func (b *limitedBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	var maxErr *http.MaxBytesError
+	if errors.As(err, &maxErr) {
+		b.exceeded = true
+	}
+	return n, err
+}
+
+// bodyTooLarge reports the cap of a request whose body went over it
+func bodyTooLarge(r *http.Request) (int64, bool) {
+	if b, ok := r.Body.(*limitedBody); ok && b.exceeded {
+		return b.limit, true
+	}
+	return 0, false
+}
+
+func writeBodyTooLarge(w http.ResponseWriter, r *http.Request, limit int64) {
+	writeAPIError(w, r, http.StatusRequestEntityTooLarge, bodyTooLargeError(limit))
+}
+
+func bodyTooLargeError(limit int64) APIError {
+	return APIError{Code: CodeBodyTooLarge, Message: "Request body must not exceed " + strconv.FormatInt(limit, 10) + " bytes"}
+}
+
+// rateLimiter holds a token bucket per credential, or per client address
+// for failed authentication attempts
+type rateLimiter struct {
+	mu      sync.Mutex
+	buckets map[string]*bucket
+	swept   time.Time
+}
+
+type bucket struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+var (
+	limiter      = &rateLimiter{buckets: map[string]*bucket{}}
+	authFailures = &rateLimiter{buckets: map[string]*bucket{}}
+)
+
+// get returns key's bucket, creating it when it is new or the limits changed
+func (l *rateLimiter) get(key string, limit rate.Limit, burst int, now time.Time) *rate.Limiter {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	// Drop buckets idle long enough to have refilled, so the map does not grow forever
+	if now.Sub(l.swept) > time.Minute {
+		for k, b := range l.buckets {
+			if now.Sub(b.lastSeen) > 10*time.Minute {
+				delete(l.buckets, k)
+			}
+		}
+		l.swept = now
+	}
+
+	b, ok := l.buckets[key]
+	if !ok || b.limiter.Limit() != limit || b.limiter.Burst() != burst {
+		b = &bucket{limiter: rate.NewLimiter(limit, burst)}
+		l.buckets[key] = b
+	}
+	b.lastSeen = now
+	return b.limiter
+}
+
+// allow takes a token from key's bucket. When the bucket is empty it returns
+// false and how long until a token is available.
+func (l *rateLimiter) allow(key string, limit rate.Limit, burst int, now time.Time) (bool, time.Duration) {
+	res := l.get(key, limit, burst, now).ReserveN(now, 1)
+	if delay := res.DelayFrom(now); delay > 0 {
+		res.CancelAt(now)
+		return false, delay
+	}
+	return true, 0
+}
+
+// wait returns how long until key's bucket has a token, without taking it
+func (l *rateLimiter) wait(key string, limit rate.Limit, burst int, now time.Time) time.Duration {
+	tokens := l.get(key, limit, burst, now).TokensAt(now)
+	if tokens >= 1 {
+		return 0
+	}
+	return time.Duration((1 - tokens) / float64(limit) * float64(time.Second))
+}
+
+// rateLimit returns the configured limit and burst, or false when rate
+// limiting is off
+func rateLimit() (rate.Limit, int, bool) {
+	perSecond, err := strconv.ParseFloat(os.Getenv("RATE_LIMIT"), 64)
+	if err != nil || perSecond <= 0 {
+		return 0, 0, false
+	}
+	return rate.Limit(perSecond), int(envInt64("RATE_LIMIT_BURST", DefaultRateLimitBurst)), true
+}
+
+// checkRateLimit applies the rate limit to the principal's credential,
+// responding 429 with Retry-After and returning false when it is exceeded
+func checkRateLimit(w http.ResponseWriter, r *http.Request, principal Principal) bool {
+	limit, burst, on := rateLimit()
+	if !on {
+		return true
+	}
+
+	key := principal.UserID + "/" + principal.Name
+	if principal.Admin {
+		key = "admin/" + principal.Name
+	}
+	ok, wait := limiter.allow(key, limit, burst, time.Now())
+	if !ok {
+		writeRateLimited(w, r, wait)
+	}
+	return ok
+}
+
+// checkAuthFailures refuses, with 429, a client address whose failed
+// authentication attempts have used up its bucket. It runs before the
+// credentials are looked up, so guessing keys or tokens is bounded by the
+// same limit as using them, and costs no backend reads once refused.
+func checkAuthFailures(w http.ResponseWriter, r *http.Request) bool {
+	limit, burst, on := rateLimit()
+	if !on {
+		return true
+	}
+	if wait := authFailures.wait(remoteIP(r), limit, burst, time.Now()); wait > 0 {
+		writeRateLimited(w, r, wait)
+		return false
+	}
+	return true
+}
+
+// recordAuthFailure charges a failed authentication attempt to the client's address
+func recordAuthFailure(r *http.Request) {
+	if limit, burst, on := rateLimit(); on {
+		authFailures.allow(remoteIP(r), limit, burst, time.Now())
+	}
+}
+
+func writeRateLimited(w http.ResponseWriter, r *http.Request, wait time.Duration) {
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+	writeError(w, r, http.StatusTooManyRequests, CodeRateLimited, "Too many requests, retry later")
+}
+
+// envInt64 parses the environment variable key as a positive integer, or returns def
+func envInt64(key string, def int64) int64 {
+	if n, err := strconv.ParseInt(os.Getenv(key), 10, 64); err == nil && n > 0 {
+		return n
+	}
+	return def
+}
@@ -0,0 +1,130 @@
+package function
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestBodyLimits(t *testing.T) {
+	useMemoryBackend(t)
+	handler := NewHandler(NewMemoryBackend())
+	// A valid session padded with notes to n bytes
+	session := func(n int) string {
+		const prefix, suffix = `{"date":"2024-05-01","notes":"`, `"}`
+		return prefix + strings.Repeat("x", n-len(prefix)-len(suffix)) + suffix
+	}
+
+	tests := []struct {
+		name     string
+		path     string
+		body     string
+		chunked  bool // Sent without a Content-Length
+		status   int
+		tooLarge bool
+	}{
+		{"session under the cap", "/indoor_sessions", session(DefaultMaxBodyBytes - 1024), false, http.StatusCreated, false},
+		{"session over the cap", "/indoor_sessions", session(DefaultMaxBodyBytes + 1), false, http.StatusRequestEntityTooLarge, true},
+		{"chunked session over the cap", "/indoor_sessions", session(DefaultMaxBodyBytes + 1), true, http.StatusRequestEntityTooLarge, true},
+		{"batch over the session cap", "/batch",
+			`{"operations":[{"op":"create","resource":"indoor_sessions","data":` + session(DefaultMaxBodyBytes-1024) + `},` +
+				`{"op":"create","resource":"gym_sessions","data":{"date":"2024-05-01","name":"` + strings.Repeat("x", DefaultMaxBodyBytes) + `"}}]}`,
+			false, http.StatusOK, false},
+		{"batch over the batch cap", "/batch", `{"operations":[` + strings.Repeat(" ", DefaultMaxBatchBodyBytes) + `]}`, false, http.StatusRequestEntityTooLarge, true},
+		{"chunked batch over the batch cap", "/batch", `{"operations":[` + strings.Repeat(" ", DefaultMaxBatchBodyBytes) + `]}`, true, http.StatusRequestEntityTooLarge, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("POST", tt.path, strings.NewReader(tt.body))
+			r.Header.Set("x-api-key", testAdminKey)
+			if tt.chunked {
+				r.ContentLength = -1
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+			if w.Code != tt.status {
+				t.Fatalf("got %d %.200s, want %d", w.Code, w.Body.String(), tt.status)
+			}
+			if tt.tooLarge {
+				var resp errorResponse
+				decode(t, w, &resp)
+				if resp.Error.Code != CodeBodyTooLarge {
+					t.Errorf("error code = %q, want %q", resp.Error.Code, CodeBodyTooLarge)
+				}
+			}
+		})
+	}
+
+	t.Setenv("MAX_BODY_BYTES", "64")
+	if w := request(t, handler, "POST", "/indoor_sessions", session(65)); w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("MAX_BODY_BYTES=64 with 65 bytes: got %d, want 413", w.Code)
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	useMemoryBackend(t)
+	t.Setenv("APP_SECRET_KEYS", "other:other-secret")
+	saved, savedFailures := limiter, authFailures
+	limiter = &rateLimiter{buckets: map[string]*bucket{}}
+	authFailures = &rateLimiter{buckets: map[string]*bucket{}}
+	t.Cleanup(func() { limiter, authFailures = saved, savedFailures })
+	handler := NewHandler(NewMemoryBackend())
+	list := func(key string) *httptest.ResponseRecorder {
+		return request(t, handler, "GET", "/indoor_sessions", "", "x-api-key", key)
+	}
+
+	// Off by default
+	t.Setenv("RATE_LIMIT", "")
+	for i := 0; i < 2*DefaultRateLimitBurst; i++ {
+		if w := list(testAdminKey); w.Code != http.StatusOK {
+			t.Fatalf("request %d without RATE_LIMIT: got %d", i, w.Code)
+		}
+	}
+
+	t.Setenv("RATE_LIMIT", "0.5")
+	t.Setenv("RATE_LIMIT_BURST", "3")
+	for i := 0; i < 3; i++ {
+		if w := list(testAdminKey); w.Code != http.StatusOK {
+			t.Fatalf("request %d within the burst: got %d", i, w.Code)
+		}
+	}
+	w := list(testAdminKey)
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("request over the burst: got %d, want 429", w.Code)
+	}
+	if got := w.Header().Get("Retry-After"); got != "2" {
+		t.Errorf("Retry-After = %q, want 2 at 0.5 requests per second", got)
+	}
+	var resp errorResponse
+	decode(t, w, &resp)
+	if resp.Error.Code != CodeRateLimited {
+		t.Errorf("error code = %q, want %q", resp.Error.Code, CodeRateLimited)
+	}
+
+	// Each credential has its own bucket
+	if w := list("other-secret"); w.Code != http.StatusOK {
+		t.Errorf("another key: got %d, want 200", w.Code)
+	}
+
+	// Failed attempts are limited per address before the credentials are looked up
+	for i := 0; i < 3; i++ {
+		if w := list("wrong-secret"); w.Code != http.StatusUnauthorized {
+			t.Fatalf("bad key %d within the burst: got %d, want 401", i, w.Code)
+		}
+	}
+	if w := list("wrong-secret"); w.Code != http.StatusTooManyRequests {
+		t.Errorf("bad key over the burst: got %d, want 429", w.Code)
+	}
+	if w := list("other-wrong-secret"); w.Code != http.StatusTooManyRequests {
+		t.Errorf("another bad key from the same address: got %d, want 429", w.Code)
+	}
+	r := httptest.NewRequest("GET", "/indoor_sessions", nil)
+	r.Header.Set("x-api-key", "wrong-secret")
+	r.RemoteAddr = "198.51.100.7:4321"
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("bad key from another address: got %d, want 401", w.Code)
+	}
+}
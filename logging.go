@@ -0,0 +1,184 @@
+package function
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/netip"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Logs are JSON lines on stdout shaped for Cloud Logging: the level is
+// written as severity, the text as message, and access logs carry an
+// httpRequest object. LOG_LEVEL (debug, info, warn or error) sets the minimum
+// level, default info.
+var logger = NewLogger(os.Stdout)
+
+// NewLogger returns a JSON logger writing Cloud Logging compatible entries to w
+func NewLogger(w io.Writer) *slog.Logger {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(os.Getenv("LOG_LEVEL"))); err != nil {
+		level = slog.LevelInfo
+	}
+	return slog.New(slog.NewJSONHandler(w, &slog.HandlerOptions{
+		Level: level,
+		ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+			if len(groups) > 0 {
+				return a
+			}
+			switch a.Key {
+			case slog.LevelKey:
+				return slog.String("severity", severity(a.Value.Any().(slog.Level)))
+			case slog.MessageKey:
+				a.Key = "message"
+			}
+			return a
+		},
+	}))
+}
+
+// severity maps a slog level to a Cloud Logging severity
+func severity(level slog.Level) string {
+	switch {
+	case level >= slog.LevelError:
+		return "ERROR"
+	case level >= slog.LevelWarn:
+		return "WARNING"
+	case level >= slog.LevelInfo:
+		return "INFO"
+	}
+	return "DEBUG"
+}
+
+// logFor returns the logger for a request, tagged with its request ID and,
+// once authenticated, the caller
+func logFor(ctx context.Context) *slog.Logger {
+	l := logger
+	if id := RequestIDFromContext(ctx); id != "" {
+		l = l.With("requestId", id)
+	}
+	if p := PrincipalFromContext(ctx); p.Name != "" {
+		l = l.With("principal", p.Name)
+	}
+	return l
+}
+
+// statusRecorder notes the status and size of a response for the access log
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+	size   int
+}
+
+func (rw *statusRecorder) WriteHeader(status int) {
+	if rw.status == 0 {
+		rw.status = status
+	}
+	rw.ResponseWriter.WriteHeader(status)
+}
+
+func (rw *statusRecorder) Write(b []byte) (int, error) {
+	if rw.status == 0 {
+		rw.status = http.StatusOK
+	}
+	n, err := rw.ResponseWriter.Write(b)
+	rw.size += n
+	return n, err
+}
+
+// statusCode returns the status sent, which is 200 if the handler set none
+func (rw *statusRecorder) statusCode() int {
+	if rw.status == 0 {
+		return http.StatusOK
+	}
+	return rw.status
+}
+
+// logRequest writes the access log entry for a finished request
+func logRequest(r *http.Request, rw *statusRecorder, principal Principal, latency time.Duration) {
+	status := rw.statusCode()
+	level := slog.LevelInfo
+	if status >= 500 {
+		level = slog.LevelError
+	}
+
+	l := logger.With("requestId", RequestIDFromContext(r.Context()))
+	if principal.Name != "" {
+		l = l.With("principal", principal.Name, "admin", principal.Admin)
+	}
+	l.Log(r.Context(), level, r.Method+" "+r.URL.Path+" "+strconv.Itoa(status),
+		slog.Group("httpRequest",
+			"requestMethod", r.Method,
+			"requestUrl", r.URL.RequestURI(),
+			"status", status,
+			"responseSize", strconv.Itoa(rw.size),
+			"userAgent", r.UserAgent(),
+			"remoteIp", remoteIP(r),
+			"latency", strconv.FormatFloat(latency.Seconds(), 'f', 6, 64)+"s",
+		),
+		"latencyMs", float64(latency.Microseconds())/1000,
+	)
+}
+
+// remoteIP returns the client address. X-Forwarded-For can be set by any
+// client, so it is only read when the request came through a proxy listed in
+// TRUSTED_PROXIES (comma separated IPs or CIDR ranges, e.g. 10.0.0.0/8).
+// Hops are then taken from the right, skipping trusted proxies, so the
+// address returned is the last one a trusted proxy saw connect to it.
+func remoteIP(r *http.Request) string {
+	host := r.RemoteAddr
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	trusted := trustedProxies()
+	if len(trusted) == 0 || !isTrusted(host, trusted) {
+		return host
+	}
+
+	hops := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := strings.TrimSpace(hops[i])
+		if hop == "" {
+			continue
+		}
+		if !isTrusted(hop, trusted) {
+			return hop
+		}
+		host = hop
+	}
+	return host
+}
+
+// trustedProxies parses TRUSTED_PROXIES, skipping entries that are not an
+// IP address or CIDR range
+func trustedProxies() []netip.Prefix {
+	var prefixes []netip.Prefix
+	for _, entry := range strings.Split(os.Getenv("TRUSTED_PROXIES"), ",") {
+		entry = strings.TrimSpace(entry)
+		if prefix, err := netip.ParsePrefix(entry); err == nil {
+			prefixes = append(prefixes, prefix.Masked())
+		} else if addr, err := netip.ParseAddr(entry); err == nil {
+			prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+		}
+	}
+	return prefixes
+}
+
+func isTrusted(ip string, trusted []netip.Prefix) bool {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+	for _, prefix := range trusted {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,96 @@
+package function
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// failingBackend fails every indoor session read
+type failingBackend struct {
+	Backend
+}
+
+func (b failingBackend) Stores(userID string) *Stores {
+	stores := *b.Backend.Stores(userID)
+	stores.Indoor = failingStore{stores.Indoor}
+	return &stores
+}
+
+type failingStore struct {
+	SessionStore[IndoorSession]
+}
+
+var errStoreDown = errors.New("store unavailable")
+
+func (failingStore) Get(context.Context, string) (IndoorSession, error) {
+	return IndoorSession{}, errStoreDown
+}
+
+func TestInternalErrorLogged(t *testing.T) {
+	useMemoryBackend(t)
+	var logs bytes.Buffer
+	logger = NewLogger(&logs)
+	t.Cleanup(func() { logger = NewLogger(io.Discard) })
+
+	r := httptest.NewRequest("GET", "/indoor_sessions/abc", nil)
+	r.Header.Set("x-api-key", testAdminKey)
+	w := httptest.NewRecorder()
+	NewHandler(failingBackend{NewMemoryBackend()}).ServeHTTP(w, r)
+	if w.Code != http.StatusInternalServerError {
+		t.Fatalf("got %d %s, want 500", w.Code, w.Body.String())
+	}
+
+	dec := json.NewDecoder(&logs)
+	for dec.More() {
+		var entry map[string]interface{}
+		if err := dec.Decode(&entry); err != nil {
+			t.Fatal(err)
+		}
+		if entry["message"] != "get session failed" {
+			continue
+		}
+		if entry["severity"] != "ERROR" || entry["collection"] != "indoor_sessions" || entry["session"] != "abc" || entry["error"] != errStoreDown.Error() {
+			t.Errorf("log entry = %v", entry)
+		}
+		return
+	}
+	t.Errorf("no error logged for the failed read: %s", logs.String())
+}
+
+func TestRemoteIP(t *testing.T) {
+	tests := []struct {
+		name       string
+		trusted    string
+		remoteAddr string
+		forwarded  []string
+		want       string
+	}{
+		{"no proxy", "", "203.0.113.9:1234", nil, "203.0.113.9"},
+		{"forwarded for without trusted proxies", "", "203.0.113.9:1234", []string{"198.51.100.1"}, "203.0.113.9"},
+		{"forwarded for from an untrusted peer", "10.0.0.0/8", "203.0.113.9:1234", []string{"198.51.100.1"}, "203.0.113.9"},
+		{"trusted proxy", "10.0.0.0/8", "10.1.2.3:1234", []string{"198.51.100.1"}, "198.51.100.1"},
+		{"spoofed first hop", "10.0.0.0/8", "10.1.2.3:1234", []string{"1.2.3.4, 198.51.100.1"}, "198.51.100.1"},
+		{"chain of trusted proxies", "10.0.0.0/8, 192.0.2.7", "10.1.2.3:1234", []string{"1.2.3.4, 198.51.100.1, 192.0.2.7", "10.9.9.9"}, "198.51.100.1"},
+		{"only trusted hops", "10.0.0.0/8", "10.1.2.3:1234", []string{"10.4.4.4"}, "10.4.4.4"},
+		{"IPv6 peer", "", "[2001:db8::1]:1234", nil, "2001:db8::1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("TRUSTED_PROXIES", tt.trusted)
+			r := httptest.NewRequest("GET", "/", nil)
+			r.RemoteAddr = tt.remoteAddr
+			for _, v := range tt.forwarded {
+				r.Header.Add("X-Forwarded-For", v)
+			}
+			if got := remoteIP(r); got != tt.want {
+				t.Errorf("remoteIP = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,465 @@
+package function
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"sort"
+	"sync"
+	"time"
+)
+
+// NewMemoryStores returns Stores that keep every session in process memory.
+// Data is lost on restart; intended for local development and tests.
+func NewMemoryStores() *Stores {
+	indoor := newMemoryStore[IndoorSession](IndoorCollection)
+	outdoor := newMemoryStore[OutdoorSession](OutdoorCollection)
+	fingerboard := newMemoryStore[FingerboardSession](FingerboardCollection)
+	competition := newMemoryStore[CompetitionSession](CompetitionCollection)
+	gym := newMemoryStore[GymSession](GymCollection)
+
+	return &Stores{
+		Indoor:      indoor,
+		Outdoor:     outdoor,
+		Fingerboard: fingerboard,
+		Competition: competition,
+		Gym:         gym,
+		runTx: func(ctx context.Context, fn func(*Stores) error) error {
+			// Collections are locked in field order, so transactions cannot deadlock
+			var txs []memoryTx
+			defer func() {
+				for _, tx := range txs {
+					tx.end()
+				}
+			}()
+			staged := &Stores{
+				Indoor:      indoor.begin(&txs),
+				Outdoor:     outdoor.begin(&txs),
+				Fingerboard: fingerboard.begin(&txs),
+				Competition: competition.begin(&txs),
+				Gym:         gym.begin(&txs),
+			}
+			if err := fn(staged); err != nil {
+				return err
+			}
+			for _, tx := range txs {
+				tx.commit()
+			}
+			return nil
+		},
+	}
+}
+
+// NewMemoryBackend returns a Backend keeping users and sessions in process memory
+func NewMemoryBackend() Backend {
+	return &memoryBackend{
+		users:       &memoryUsers{users: map[string]User{}, tokens: map[string]APIToken{}},
+		idempotency: &memoryIdempotency{records: map[string]IdempotencyRecord{}},
+		stores:      map[string]*Stores{},
+	}
+}
+
+type memoryBackend struct {
+	users       *memoryUsers
+	idempotency *memoryIdempotency
+
+	mu     sync.Mutex
+	stores map[string]*Stores // By owner user ID
+}
+
+func (b *memoryBackend) Users() UserStore { return b.users }
+
+func (b *memoryBackend) Idempotency() IdempotencyStore { return b.idempotency }
+
+func (b *memoryBackend) Stores(userID string) *Stores {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	stores, ok := b.stores[userID]
+	if !ok {
+		stores = NewMemoryStores()
+		b.stores[userID] = stores
+	}
+	return stores
+}
+
+// memoryIdempotency is an IdempotencyStore backed by a map
+type memoryIdempotency struct {
+	mu      sync.Mutex
+	records map[string]IdempotencyRecord
+}
+
+func (m *memoryIdempotency) Reserve(ctx context.Context, rec IdempotencyRecord) (*IdempotencyRecord, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for key, existing := range m.records {
+		if existing.ExpiresAt.Before(rec.CreatedAt) {
+			delete(m.records, key)
+		}
+	}
+	if existing, ok := m.records[rec.Key]; ok {
+		return &existing, nil
+	}
+	m.records[rec.Key] = rec
+	return nil, nil
+}
+
+func (m *memoryIdempotency) Complete(ctx context.Context, rec IdempotencyRecord) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.records[rec.Key] = rec
+	return nil
+}
+
+func (m *memoryIdempotency) Release(ctx context.Context, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.records, key)
+	return nil
+}
+
+// memoryUsers is a UserStore backed by maps
+type memoryUsers struct {
+	mu     sync.RWMutex
+	users  map[string]User
+	tokens map[string]APIToken
+}
+
+func (u *memoryUsers) CreateUser(ctx context.Context, name string) (User, error) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	user := User{ID: newDocumentID(), Name: name, CreatedAt: storeNow()}
+	u.users[user.ID] = user
+	return user, nil
+}
+
+func (u *memoryUsers) GetUser(ctx context.Context, id string) (User, error) {
+	u.mu.RLock()
+	defer u.mu.RUnlock()
+
+	user, ok := u.users[id]
+	if !ok {
+		return user, ErrNotFound
+	}
+	return user, nil
+}
+
+func (u *memoryUsers) ListUsers(ctx context.Context) ([]User, error) {
+	u.mu.RLock()
+	defer u.mu.RUnlock()
+
+	var users []User
+	for _, user := range u.users {
+		users = append(users, user)
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i].CreatedAt.Before(users[j].CreatedAt) })
+	return users, nil
+}
+
+func (u *memoryUsers) CreateToken(ctx context.Context, token APIToken) (APIToken, error) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	token.ID = newDocumentID()
+	token.CreatedAt = storeNow()
+	u.tokens[token.ID] = token
+	return token, nil
+}
+
+func (u *memoryUsers) GetToken(ctx context.Context, id string) (APIToken, error) {
+	u.mu.RLock()
+	defer u.mu.RUnlock()
+
+	token, ok := u.tokens[id]
+	if !ok {
+		return token, ErrNotFound
+	}
+	return token, nil
+}
+
+func (u *memoryUsers) ListTokens(ctx context.Context, userID string) ([]APIToken, error) {
+	u.mu.RLock()
+	defer u.mu.RUnlock()
+
+	var tokens []APIToken
+	for _, token := range u.tokens {
+		if token.UserID == userID {
+			tokens = append(tokens, token)
+		}
+	}
+	sort.Slice(tokens, func(i, j int) bool { return tokens[i].CreatedAt.Before(tokens[j].CreatedAt) })
+	return tokens, nil
+}
+
+func (u *memoryUsers) RevokeToken(ctx context.Context, userID, id string) error {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	if token, ok := u.tokens[id]; !ok || token.UserID != userID {
+		return ErrNotFound
+	}
+	delete(u.tokens, id)
+	return nil
+}
+
+func (u *memoryUsers) TokenByHash(ctx context.Context, hash string) (APIToken, error) {
+	u.mu.RLock()
+	defer u.mu.RUnlock()
+
+	for _, token := range u.tokens {
+		if token.Hash == hash {
+			return token, nil
+		}
+	}
+	return APIToken{}, ErrNotFound
+}
+
+// memoryStore is a SessionStore backed by a map, mirroring the Firestore semantics
+type memoryStore[T any, P recordPtr[T]] struct {
+	collection string
+
+	mu         sync.RWMutex
+	sessions   map[string]T
+	tombstones map[string]Tombstone
+}
+
+func newMemoryStore[T any, P recordPtr[T]](collection string) *memoryStore[T, P] {
+	return &memoryStore[T, P]{
+		collection: collection,
+		sessions:   make(map[string]T),
+		tombstones: make(map[string]Tombstone),
+	}
+}
+
+func (s *memoryStore[T, P]) List(ctx context.Context, opts ListOptions) ([]T, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var sessions []T
+	for _, stored := range s.sessions {
+		// Give up on an abandoned or overdue request as the database backends do
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		p := P(&stored)
+		if !opts.Since.IsZero() && !p.getUpdatedAt().After(opts.Since) {
+			continue
+		}
+		if opts.StartDate != "" && p.getDate() < opts.StartDate {
+			continue
+		}
+		if opts.EndDate != "" && p.getDate() > opts.EndDate {
+			continue
+		}
+		if opts.After != nil && !sortsBefore(opts, *opts.After, p) {
+			continue
+		}
+		sessions = append(sessions, cloneSession(stored))
+	}
+
+	sort.Slice(sessions, func(i, j int) bool {
+		return sortsBefore(opts, cursorOf(opts, P(&sessions[i])), P(&sessions[j]))
+	})
+	if opts.Limit > 0 && len(sessions) > opts.Limit {
+		sessions = sessions[:opts.Limit]
+	}
+	return sessions, nil
+}
+
+// cursorOf returns the ordering key of a session for the given listing
+func cursorOf(opts ListOptions, r record) Cursor {
+	if !opts.Since.IsZero() {
+		return Cursor{UpdatedAt: r.getUpdatedAt(), ID: r.getID()}
+	}
+	return Cursor{Date: r.getDate(), ID: r.getID()}
+}
+
+// sortsBefore reports whether the session at key c is listed before r
+func sortsBefore(opts ListOptions, c Cursor, r record) bool {
+	if !opts.Since.IsZero() {
+		if !c.UpdatedAt.Equal(r.getUpdatedAt()) {
+			return c.UpdatedAt.After(r.getUpdatedAt())
+		}
+	} else if c.Date != r.getDate() {
+		return c.Date > r.getDate()
+	}
+	return c.ID > r.getID()
+}
+
+func (s *memoryStore[T, P]) Get(ctx context.Context, id string) (T, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	stored, ok := s.sessions[id]
+	if !ok {
+		var zero T
+		return zero, ErrNotFound
+	}
+	return cloneSession(stored), nil
+}
+
+func (s *memoryStore[T, P]) Create(ctx context.Context, session T) (T, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := storeNow()
+	P(&session).setID(newDocumentID())
+	P(&session).setCreatedAt(now)
+	P(&session).setUpdatedAt(now)
+
+	s.sessions[P(&session).getID()] = cloneSession(session)
+	return session, nil
+}
+
+func (s *memoryStore[T, P]) Update(ctx context.Context, id string, apply func(*T) error) (T, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored, ok := s.sessions[id]
+	if !ok {
+		var zero T
+		return zero, ErrNotFound
+	}
+
+	updated := cloneSession(stored)
+	if err := apply(&updated); err != nil {
+		return updated, err
+	}
+	P(&updated).setID(id)
+	P(&updated).setUpdatedAt(storeNow())
+
+	s.sessions[id] = cloneSession(updated)
+	return updated, nil
+}
+
+func (s *memoryStore[T, P]) Put(ctx context.Context, id string, apply func(*T, bool) error) (T, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored, exists := s.sessions[id]
+	session := cloneSession(stored)
+	if err := apply(&session, exists); err != nil {
+		return session, false, err
+	}
+	now := storeNow()
+	P(&session).setID(id)
+	if !exists {
+		P(&session).setCreatedAt(now)
+		delete(s.tombstones, id)
+	}
+	P(&session).setUpdatedAt(now)
+
+	s.sessions[id] = cloneSession(session)
+	return session, !exists, nil
+}
+
+func (s *memoryStore[T, P]) Delete(ctx context.Context, id string, check func(*T) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored, ok := s.sessions[id]
+	if !ok {
+		return ErrNotFound
+	}
+	if check != nil {
+		current := cloneSession(stored)
+		if err := check(&current); err != nil {
+			return err
+		}
+	}
+	delete(s.sessions, id)
+	s.tombstones[id] = Tombstone{ID: id, Collection: s.collection, DeletedAt: storeNow()}
+	return nil
+}
+
+func (s *memoryStore[T, P]) Deleted(ctx context.Context, since time.Time) ([]Tombstone, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var tombstones []Tombstone
+	for _, t := range s.tombstones {
+		if t.DeletedAt.After(since) {
+			tombstones = append(tombstones, t)
+		}
+	}
+	sort.Slice(tombstones, func(i, j int) bool {
+		return tombstones[i].DeletedAt.Before(tombstones[j].DeletedAt)
+	})
+	return tombstones, nil
+}
+
+func (s *memoryStore[T, P]) PurgeTombstones(ctx context.Context, cutoff time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for id, t := range s.tombstones {
+		if t.DeletedAt.Before(cutoff) {
+			delete(s.tombstones, id)
+		}
+	}
+	return nil
+}
+
+// memoryTx is one collection's part of a memory transaction
+type memoryTx interface {
+	commit() // Publish the staged sessions and tombstones
+	end()    // Unlock the collection
+}
+
+// memoryStoreTx stages a transaction's writes to store in a copy of it
+type memoryStoreTx[T any, P recordPtr[T]] struct {
+	store, staged *memoryStore[T, P]
+}
+
+func (tx memoryStoreTx[T, P]) commit() {
+	tx.store.sessions, tx.store.tombstones = tx.staged.sessions, tx.staged.tombstones
+}
+
+func (tx memoryStoreTx[T, P]) end() { tx.store.mu.Unlock() }
+
+// begin locks the store for a transaction, adds it to txs and returns the
+// copy the transaction works on. Stored sessions are never modified in
+// place, so copying the maps is enough.
+func (s *memoryStore[T, P]) begin(txs *[]memoryTx) *memoryStore[T, P] {
+	s.mu.Lock()
+	staged := newMemoryStore[T, P](s.collection)
+	for id, session := range s.sessions {
+		staged.sessions[id] = session
+	}
+	for id, t := range s.tombstones {
+		staged.tombstones[id] = t
+	}
+	*txs = append(*txs, memoryStoreTx[T, P]{store: s, staged: staged})
+	return staged
+}
+
+// cloneSession deep-copies a session so callers never share slices with the store
+func cloneSession[T any](session T) T {
+	var clone T
+	data, err := json.Marshal(session)
+	if err != nil {
+		panic(err) // Session models always marshal
+	}
+	if err := json.Unmarshal(data, &clone); err != nil {
+		panic(err)
+	}
+	return clone
+}
+
+// newDocumentID returns a random 20 character ID in the style of Firestore auto-IDs
+func newDocumentID() string {
+	const alphabet = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789"
+
+	b := make([]byte, 20)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	for i := range b {
+		b[i] = alphabet[int(b[i])%len(alphabet)]
+	}
+	return string(b)
+}
@@ -0,0 +1,129 @@
+package function
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"errors"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Prometheus metrics, served by MetricsHandler
+var (
+	metricsRegistry = prometheus.NewRegistry()
+
+	httpRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "workoutapi_http_requests_total",
+		Help: "HTTP requests by route, method and status code.",
+	}, []string{"route", "method", "code"})
+
+	httpDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "workoutapi_http_request_duration_seconds",
+		Help:    "HTTP request latency by route and method.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"route", "method"})
+
+	storeOperations = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "workoutapi_store_operations_total",
+		Help: "Session store operations by collection, operation and result (ok, not_found or error).",
+	}, []string{"collection", "operation", "result"})
+
+	storeDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "workoutapi_store_operation_duration_seconds",
+		Help:    "Session store operation latency by collection and operation.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"collection", "operation"})
+
+	skippedDocuments = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "workoutapi_malformed_documents_skipped_total",
+		Help: "Firestore documents skipped by list calls because they failed to decode.",
+	}, []string{"collection"})
+)
+
+func init() {
+	metricsRegistry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		httpRequests, httpDuration, storeOperations, storeDuration, skippedDocuments,
+	)
+}
+
+// MetricsHandler serves the metrics in the Prometheus text format. Scrapers
+// authenticate with Authorization: Bearer and the value of METRICS_TOKEN,
+// which is separate from the API keys; with no token configured the
+// endpoint refuses every request.
+func MetricsHandler() http.Handler {
+	metrics := promhttp.HandlerFor(metricsRegistry, promhttp.HandlerOpts{})
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r = withRequestID(w, r)
+		token := os.Getenv("METRICS_TOKEN")
+		if token == "" {
+			writeError(w, r, http.StatusServiceUnavailable, CodeNotConfigured, "METRICS_TOKEN is not configured")
+			return
+		}
+		scheme, got, _ := strings.Cut(r.Header.Get("Authorization"), " ")
+		want, have := sha256.Sum256([]byte(token)), sha256.Sum256([]byte(got))
+		if !strings.EqualFold(scheme, "Bearer") || subtle.ConstantTimeCompare(want[:], have[:]) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="metrics"`)
+			writeError(w, r, http.StatusUnauthorized, CodeUnauthorized, "Missing or invalid metrics token")
+			return
+		}
+		metrics.ServeHTTP(w, r)
+	})
+}
+
+// observeRequest records a finished request
+func observeRequest(r *http.Request, status int, latency time.Duration) {
+	route, method := routeOf(r.URL.Path), methodOf(r.Method)
+	httpRequests.WithLabelValues(route, method, strconv.Itoa(status)).Inc()
+	httpDuration.WithLabelValues(route, method).Observe(latency.Seconds())
+}
+
+// methodOf maps methods the API does not serve to "other", so clients
+// cannot create label values by sending arbitrary methods
+func methodOf(method string) string {
+	switch method {
+	case "GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS":
+		return method
+	}
+	return "other"
+}
+
+// routeOf reduces a path to its route pattern, e.g. /gym_sessions/{id}, so
+// session IDs do not become label values
+func routeOf(path string) string {
+	parts := strings.Split(strings.Trim(path, "/"), "/")
+	switch {
+	case isResource(parts[0]) && len(parts) == 1, path == "/sync", path == "/batch", path == "/users", path == "/keys":
+		return "/" + parts[0]
+	case isResource(parts[0]) && len(parts) == 2, parts[0] == "keys" && len(parts) == 2:
+		return "/" + parts[0] + "/{id}"
+	case parts[0] == "users" && len(parts) == 2:
+		return "/users/{id}"
+	case parts[0] == "users" && len(parts) == 3 && parts[2] == "tokens":
+		return "/users/{id}/tokens"
+	case parts[0] == "users" && len(parts) == 4 && parts[2] == "tokens":
+		return "/users/{id}/tokens/{tokenId}"
+	}
+	return "other"
+}
+
+// observeStore records a store operation that started at start and ended with err
+func observeStore(collection, operation string, start time.Time, err error) {
+	result := "ok"
+	switch {
+	case errors.Is(err, ErrNotFound):
+		result = "not_found"
+	case err != nil:
+		result = "error"
+	}
+	storeOperations.WithLabelValues(collection, operation, result).Inc()
+	storeDuration.WithLabelValues(collection, operation).Observe(time.Since(start).Seconds())
+}
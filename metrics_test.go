@@ -0,0 +1,44 @@
+package function
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRequestMetricsMethodLabel(t *testing.T) {
+	useMemoryBackend(t)
+	handler := NewHandler(NewMemoryBackend())
+
+	for _, method := range []string{"GET", "PROPFIND", "get", "X-RANDOM-1234"} {
+		r := httptest.NewRequest(method, "/indoor_sessions", nil)
+		r.Header.Set("x-api-key", testAdminKey)
+		handler.ServeHTTP(httptest.NewRecorder(), r)
+	}
+
+	families, err := metricsRegistry.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	seen := map[string]bool{}
+	for _, family := range families {
+		if family.GetName() != "workoutapi_http_requests_total" && family.GetName() != "workoutapi_http_request_duration_seconds" {
+			continue
+		}
+		for _, metric := range family.GetMetric() {
+			for _, label := range metric.GetLabel() {
+				if label.GetName() != "method" {
+					continue
+				}
+				switch method := label.GetValue(); method {
+				case "GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS", "other":
+					seen[method] = true
+				default:
+					t.Errorf("%s has method label %q", family.GetName(), method)
+				}
+			}
+		}
+	}
+	if !seen["GET"] || !seen["other"] {
+		t.Errorf("method labels = %v, want GET and other", seen)
+	}
+}
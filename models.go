@@ -65,6 +65,54 @@ type IndoorSessionInput struct {
 	Notes        string       `json:"notes,omitempty"`
 }
 
+// toSession builds a new session from a create request
+func (in IndoorSessionInput) toSession() IndoorSession {
+	return IndoorSession{
+		Date:           in.Date,
+		Location:       in.Location,
+		CustomLocation: in.CustomLocation,
+		ClimbingType:   in.ClimbingType,
+		TrainingTypes:  in.TrainingTypes,
+		Difficulty:     in.Difficulty,
+		Categories:     in.Categories,
+		EnergySystems:  in.EnergySystems,
+		WallAngles:     in.WallAngles,
+		FingerLoad:     in.FingerLoad,
+		ShoulderLoad:   in.ShoulderLoad,
+		ForearmLoad:    in.ForearmLoad,
+		OpenGrip:       in.OpenGrip,
+		CrimpGrip:      in.CrimpGrip,
+		PinchGrip:      in.PinchGrip,
+		SloperGrip:     in.SloperGrip,
+		JugGrip:        in.JugGrip,
+		Climbs:         in.Climbs,
+		Notes:          in.Notes,
+	}
+}
+
+// applyTo copies an update request onto an existing session
+func (in IndoorSessionInput) applyTo(s *IndoorSession) {
+	s.Date = in.Date
+	s.Location = in.Location
+	s.CustomLocation = in.CustomLocation
+	s.ClimbingType = in.ClimbingType
+	s.TrainingTypes = in.TrainingTypes
+	s.Difficulty = in.Difficulty
+	s.Categories = in.Categories
+	s.EnergySystems = in.EnergySystems
+	s.WallAngles = in.WallAngles
+	s.FingerLoad = in.FingerLoad
+	s.ShoulderLoad = in.ShoulderLoad
+	s.ForearmLoad = in.ForearmLoad
+	s.OpenGrip = in.OpenGrip
+	s.CrimpGrip = in.CrimpGrip
+	s.PinchGrip = in.PinchGrip
+	s.SloperGrip = in.SloperGrip
+	s.JugGrip = in.JugGrip
+	s.Climbs = in.Climbs
+	s.Notes = in.Notes
+}
+
 // OutdoorSession represents an outdoor climbing session
 type OutdoorSession struct {
 	ID            string       `json:"id" firestore:"-"`
@@ -114,6 +162,54 @@ type OutdoorSessionInput struct {
 	Notes         string       `json:"notes,omitempty"`
 }
 
+// toSession builds a new session from a create request
+func (in OutdoorSessionInput) toSession() OutdoorSession {
+	return OutdoorSession{
+		Date:          in.Date,
+		Area:          in.Area,
+		Crag:          in.Crag,
+		Sector:        in.Sector,
+		ClimbingType:  in.ClimbingType,
+		TrainingTypes: in.TrainingTypes,
+		Difficulty:    in.Difficulty,
+		Categories:    in.Categories,
+		EnergySystems: in.EnergySystems,
+		FingerLoad:    in.FingerLoad,
+		ShoulderLoad:  in.ShoulderLoad,
+		ForearmLoad:   in.ForearmLoad,
+		OpenGrip:      in.OpenGrip,
+		CrimpGrip:     in.CrimpGrip,
+		PinchGrip:     in.PinchGrip,
+		SloperGrip:    in.SloperGrip,
+		JugGrip:       in.JugGrip,
+		Climbs:        in.Climbs,
+		Notes:         in.Notes,
+	}
+}
+
+// applyTo copies an update request onto an existing session
+func (in OutdoorSessionInput) applyTo(s *OutdoorSession) {
+	s.Date = in.Date
+	s.Area = in.Area
+	s.Crag = in.Crag
+	s.Sector = in.Sector
+	s.ClimbingType = in.ClimbingType
+	s.TrainingTypes = in.TrainingTypes
+	s.Difficulty = in.Difficulty
+	s.Categories = in.Categories
+	s.EnergySystems = in.EnergySystems
+	s.FingerLoad = in.FingerLoad
+	s.ShoulderLoad = in.ShoulderLoad
+	s.ForearmLoad = in.ForearmLoad
+	s.OpenGrip = in.OpenGrip
+	s.CrimpGrip = in.CrimpGrip
+	s.PinchGrip = in.PinchGrip
+	s.SloperGrip = in.SloperGrip
+	s.JugGrip = in.JugGrip
+	s.Climbs = in.Climbs
+	s.Notes = in.Notes
+}
+
 // Fingerboard Exercise Details
 type ExerciseSet struct {
 	Weight float64 `json:"weight" firestore:"weight"`
@@ -145,6 +241,22 @@ type FingerboardSessionInput struct {
 	Exercises []FingerboardExercise `json:"exercises"`
 }
 
+// toSession builds a new session from a create request
+func (in FingerboardSessionInput) toSession() FingerboardSession {
+	return FingerboardSession{
+		Date:      in.Date,
+		Location:  in.Location,
+		Exercises: in.Exercises,
+	}
+}
+
+// applyTo copies an update request onto an existing session
+func (in FingerboardSessionInput) applyTo(s *FingerboardSession) {
+	s.Date = in.Date
+	s.Location = in.Location
+	s.Exercises = in.Exercises
+}
+
 // Competition Data
 type CompetitionRound struct {
 	Name     string                   `json:"name" firestore:"name"` // Qualifiers, Finals, etc.
@@ -187,6 +299,34 @@ type CompetitionSessionInput struct {
 	Notes        string             `json:"notes,omitempty"`
 }
 
+// toSession builds a new session from a create request
+func (in CompetitionSessionInput) toSession() CompetitionSession {
+	return CompetitionSession{
+		Date:         in.Date,
+		Venue:        in.Venue,
+		CustomVenue:  in.CustomVenue,
+		Type:         in.Type,
+		FingerLoad:   in.FingerLoad,
+		ShoulderLoad: in.ShoulderLoad,
+		ForearmLoad:  in.ForearmLoad,
+		Rounds:       in.Rounds,
+		Notes:        in.Notes,
+	}
+}
+
+// applyTo copies an update request onto an existing session
+func (in CompetitionSessionInput) applyTo(s *CompetitionSession) {
+	s.Date = in.Date
+	s.Venue = in.Venue
+	s.CustomVenue = in.CustomVenue
+	s.Type = in.Type
+	s.FingerLoad = in.FingerLoad
+	s.ShoulderLoad = in.ShoulderLoad
+	s.ForearmLoad = in.ForearmLoad
+	s.Rounds = in.Rounds
+	s.Notes = in.Notes
+}
+
 // Gym Session Data
 type GymSet struct {
 	Weight    float64 `json:"weight" firestore:"weight"`
@@ -224,3 +364,23 @@ type GymSessionInput struct {
 	TrainingBlock string        `json:"trainingBlock,omitempty"`
 	Exercises     []GymExercise `json:"exercises"`
 }
+
+// toSession builds a new session from a create request
+func (in GymSessionInput) toSession() GymSession {
+	return GymSession{
+		Date:          in.Date,
+		Name:          in.Name,
+		Bodyweight:    in.Bodyweight,
+		TrainingBlock: in.TrainingBlock,
+		Exercises:     in.Exercises,
+	}
+}
+
+// applyTo copies an update request onto an existing session
+func (in GymSessionInput) applyTo(s *GymSession) {
+	s.Date = in.Date
+	s.Name = in.Name
+	s.Bodyweight = in.Bodyweight
+	s.TrainingBlock = in.TrainingBlock
+	s.Exercises = in.Exercises
+}
@@ -0,0 +1,304 @@
+package function
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// Fully populated create requests, one per session type. Every field of the
+// input models is set so a field dropped anywhere between the request and
+// the store shows up as a difference.
+var fullSessions = []struct {
+	resource string
+	input    interface{} // Pointer to the input model the body must fully populate
+	body     string
+}{
+	{
+		resource: "indoor_sessions",
+		input:    &IndoorSessionInput{},
+		body: `{
+			"date": "2024-05-01",
+			"location": "Other",
+			"customLocation": "Garage wall",
+			"climbingType": "Bouldering",
+			"trainingTypes": ["Power", "Technique"],
+			"difficulty": "Hard",
+			"categories": ["Crimpy", "Overhang"],
+			"energySystems": ["Alactic"],
+			"wallAngles": ["Slab", "Steep"],
+			"fingerLoad": 8,
+			"shoulderLoad": 5,
+			"forearmLoad": 6,
+			"openGrip": 2,
+			"crimpGrip": 9,
+			"pinchGrip": 3,
+			"sloperGrip": 1,
+			"jugGrip": 4,
+			"climbs": [
+				{"isSport": true, "name": "Blue arete", "grade": "6c", "attemptType": "Redpoint", "attemptsNum": 3,
+				 "notes": "Heel hook", "wall": "Cave", "techniqueFocus": "Footwork"},
+				{"isSport": false, "name": "Yellow", "grade": "V4", "attemptType": "Flash", "attemptsNum": 1,
+				 "notes": "", "wall": "Slab", "techniqueFocus": "Balance"}
+			],
+			"notes": "Felt strong"
+		}`,
+	},
+	{
+		resource: "outdoor_sessions",
+		input:    &OutdoorSessionInput{},
+		body: `{
+			"date": "2024-05-02",
+			"area": "Peak District",
+			"crag": "Stanage",
+			"sector": "Popular End",
+			"climbingType": "Trad",
+			"trainingTypes": ["Endurance"],
+			"difficulty": "Moderate",
+			"categories": ["Cracks"],
+			"energySystems": ["Aerobic", "Lactic"],
+			"fingerLoad": 4,
+			"shoulderLoad": 3,
+			"forearmLoad": 7,
+			"openGrip": 5,
+			"crimpGrip": 2,
+			"pinchGrip": 1,
+			"sloperGrip": 6,
+			"jugGrip": 8,
+			"climbs": [
+				{"isSport": false, "name": "Flying Buttress", "grade": "HVD", "attemptType": "Onsight", "attemptsNum": 1,
+				 "notes": "Classic", "wall": "Buttress", "techniqueFocus": "Jamming"},
+				{"isSport": true, "name": "Sepulchre", "grade": "VS", "attemptType": "Repeat", "attemptsNum": 2,
+				 "notes": "", "wall": "Corner", "techniqueFocus": "Bridging"}
+			],
+			"notes": "Windy"
+		}`,
+	},
+	{
+		resource: "fingerboard_sessions",
+		input:    &FingerboardSessionInput{},
+		body: `{
+			"date": "2024-05-03",
+			"location": "Home",
+			"exercises": [
+				{"id": "ex1", "name": "Max hangs", "gripType": "Half crimp", "sets": 2,
+				 "details": [{"weight": 12.5, "reps": 1}, {"weight": 15, "reps": 1}], "notes": "20mm edge"},
+				{"id": "ex2", "name": "Repeaters", "gripType": "Open hand", "sets": 1,
+				 "details": [{"weight": 0, "reps": 6}], "notes": "7/3"}
+			]
+		}`,
+	},
+	{
+		resource: "competition_sessions",
+		input:    &CompetitionSessionInput{},
+		body: `{
+			"date": "2024-05-04",
+			"venue": "Other",
+			"customVenue": "Local bouldering league",
+			"type": "Bouldering",
+			"fingerLoad": 9,
+			"shoulderLoad": 6,
+			"forearmLoad": 7,
+			"rounds": [
+				{"name": "Qualifiers", "position": 12, "climbs": [
+					{"name": "Q1", "status": "Flash", "attemptCount": 1, "notes": "Slab"},
+					{"name": "Q2", "status": "Zone", "attemptCount": 4, "notes": "Dyno"}
+				]},
+				{"name": "Finals", "position": 3, "climbs": [
+					{"name": "F1", "status": "Top", "attemptCount": 2, "notes": "Compression"}
+				]}
+			],
+			"notes": "Made finals"
+		}`,
+	},
+	{
+		resource: "gym_sessions",
+		input:    &GymSessionInput{},
+		body: `{
+			"date": "2024-05-05",
+			"name": "Pull day",
+			"bodyweight": 71.4,
+			"trainingBlock": "Strength",
+			"exercises": [
+				{"id": "g1", "name": "Weighted pull-ups", "notes": "Strict", "linkedTo": "g2", "difficulty": "Hard",
+				 "sets": [
+					{"weight": 10, "reps": 5, "isWarmup": true, "isFailure": false, "isDropSet": false, "completed": true},
+					{"weight": 20, "reps": 3, "isWarmup": false, "isFailure": true, "isDropSet": true, "completed": false}
+				 ]},
+				{"id": "g2", "name": "Rows", "notes": "Superset", "linkedTo": "g1", "difficulty": "Easy",
+				 "sets": [{"weight": 40, "reps": 8, "isWarmup": false, "isFailure": false, "isDropSet": false, "completed": true}]}
+			]
+		}`,
+	},
+}
+
+// zeroFields returns the paths of the fields of v left at their zero value.
+// Slices are checked element by element and must not be empty.
+func zeroFields(v reflect.Value, path string) []string {
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() {
+			return []string{path}
+		}
+		return zeroFields(v.Elem(), path)
+	case reflect.Struct:
+		var zero []string
+		for i := 0; i < v.NumField(); i++ {
+			zero = append(zero, zeroFields(v.Field(i), path+"."+v.Type().Field(i).Name)...)
+		}
+		return zero
+	case reflect.Slice:
+		if v.Len() == 0 {
+			return []string{path}
+		}
+		// Every element must set each field in at least one of them, so
+		// booleans and counts can be covered by different entries
+		var zero []string
+		for _, field := range zeroFields(v.Index(0), path+"[]") {
+			covered := false
+			for i := 1; i < v.Len() && !covered; i++ {
+				covered = !contains(zeroFields(v.Index(i), path+"[]"), field)
+			}
+			if !covered {
+				zero = append(zero, field)
+			}
+		}
+		return zero
+	default:
+		if v.IsZero() {
+			return []string{path}
+		}
+		return nil
+	}
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// TestSessionFieldsRoundTrip creates each session type from a fully populated
+// request, reads it back and lists it, and checks every field of the request
+// survived
+func TestSessionFieldsRoundTrip(t *testing.T) {
+	useMemoryBackend(t) // Admin key and quiet logs
+
+	for name, newBackend := range storeBackends() {
+		for _, tt := range fullSessions {
+			t.Run(name+"/"+tt.resource, func(t *testing.T) {
+				input := reflect.New(reflect.TypeOf(tt.input).Elem())
+				if err := json.Unmarshal([]byte(tt.body), input.Interface()); err != nil {
+					t.Fatal(err)
+				}
+				if zero := zeroFields(input, ""); len(zero) > 0 {
+					t.Fatalf("test body leaves fields unset: %s", strings.Join(zero, ", "))
+				}
+				handler := NewHandler(newBackend(t))
+
+				req := httptest.NewRequest("POST", "/"+tt.resource, strings.NewReader(tt.body))
+				req.Header.Set("x-api-key", testAdminKey)
+				w := httptest.NewRecorder()
+				handler.ServeHTTP(w, req)
+				if w.Code != http.StatusCreated {
+					t.Fatalf("create: got %d %s", w.Code, w.Body.String())
+				}
+				var created map[string]interface{}
+				decode(t, w, &created)
+				assertFieldsMatch(t, "create", tt.body, created)
+
+				req = httptest.NewRequest("GET", "/"+tt.resource+"/"+created["id"].(string), nil)
+				req.Header.Set("x-api-key", testAdminKey)
+				w = httptest.NewRecorder()
+				handler.ServeHTTP(w, req)
+				if w.Code != http.StatusOK {
+					t.Fatalf("get: got %d %s", w.Code, w.Body.String())
+				}
+				var fetched map[string]interface{}
+				decode(t, w, &fetched)
+				assertFieldsMatch(t, "get", tt.body, fetched)
+
+				// A second session checks that listing keeps each session's children apart
+				req = httptest.NewRequest("POST", "/"+tt.resource, strings.NewReader(tt.body))
+				req.Header.Set("x-api-key", testAdminKey)
+				handler.ServeHTTP(httptest.NewRecorder(), req)
+				req = httptest.NewRequest("GET", "/"+tt.resource, nil)
+				req.Header.Set("x-api-key", testAdminKey)
+				w = httptest.NewRecorder()
+				handler.ServeHTTP(w, req)
+				var listed []map[string]interface{}
+				decode(t, w, &listed)
+				if len(listed) != 2 {
+					t.Fatalf("list: got %d sessions, want 2", len(listed))
+				}
+				for _, session := range listed {
+					assertFieldsMatch(t, "list", tt.body, session)
+				}
+			})
+		}
+	}
+}
+
+// assertFieldsMatch checks that every field of the request body appears
+// unchanged in the response
+func assertFieldsMatch(t *testing.T, op, body string, got map[string]interface{}) {
+	t.Helper()
+	var want map[string]interface{}
+	if err := json.Unmarshal([]byte(body), &want); err != nil {
+		t.Fatal(err)
+	}
+	for field, value := range want {
+		if !reflect.DeepEqual(got[field], value) {
+			w, _ := json.Marshal(value)
+			g, _ := json.Marshal(got[field])
+			t.Errorf("%s: %s = %s, want %s", op, field, g, w)
+		}
+	}
+	for _, field := range []string{"id", "createdAt", "updatedAt"} {
+		if got[field] == nil || got[field] == "" {
+			t.Errorf("%s: %s missing", op, field)
+		}
+	}
+}
+
+// TestSessionModelsJSON checks that the stored models keep every field of
+// their input model under the same JSON name
+func TestSessionModelsJSON(t *testing.T) {
+	pairs := []struct{ input, session interface{} }{
+		{IndoorSessionInput{}, IndoorSession{}},
+		{OutdoorSessionInput{}, OutdoorSession{}},
+		{FingerboardSessionInput{}, FingerboardSession{}},
+		{CompetitionSessionInput{}, CompetitionSession{}},
+		{GymSessionInput{}, GymSession{}},
+	}
+	for _, p := range pairs {
+		sessionTags := map[string]string{}
+		st := reflect.TypeOf(p.session)
+		for i := 0; i < st.NumField(); i++ {
+			sessionTags[st.Field(i).Name] = st.Field(i).Tag.Get("json")
+		}
+		it := reflect.TypeOf(p.input)
+		for i := 0; i < it.NumField(); i++ {
+			f := it.Field(i)
+			if tag, ok := sessionTags[f.Name]; !ok || tag != f.Tag.Get("json") {
+				t.Errorf("%s.%s has json tag %q, %s has %q", it.Name(), f.Name, f.Tag.Get("json"), st.Name(), tag)
+			}
+		}
+	}
+
+	// Sanity check the fixtures decode without unknown fields
+	for _, tt := range fullSessions {
+		dec := json.NewDecoder(bytes.NewReader([]byte(tt.body)))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(reflect.New(reflect.TypeOf(tt.input).Elem()).Interface()); err != nil {
+			t.Errorf("%s fixture: %v", tt.resource, err)
+		}
+	}
+}
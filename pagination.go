@@ -0,0 +1,132 @@
+package function
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// MaxPageSize caps the limit query parameter of the List*Sessions endpoints
+const MaxPageSize = 500
+
+// Cursor marks the last session of a page. Lists are ordered by
+// (date, id) descending, or (updatedAt, id) descending for since-sync,
+// so the cursor carries whichever key the listing was ordered by.
+type Cursor struct {
+	Date      string    `json:"d,omitempty"`
+	UpdatedAt time.Time `json:"u,omitempty"`
+	ID        string    `json:"i"`
+}
+
+// Encode returns the opaque string form handed to clients as nextCursor
+func (c Cursor) Encode() string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// DecodeCursor parses a cursor produced by Cursor.Encode
+func DecodeCursor(s string) (*Cursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	var c Cursor
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, err
+	}
+	if c.ID == "" {
+		return nil, errors.New("cursor has no ID")
+	}
+	return &c, nil
+}
+
+// sessionPage is the list response shape when the client asked for a limit
+// or for deletions
+type sessionPage[T any] struct {
+	Sessions   []T         `json:"sessions"`
+	Deleted    []Tombstone `json:"deleted,omitempty"`
+	NextCursor string      `json:"nextCursor,omitempty"`
+}
+
+// parsePage reads the limit and cursor query parameters into opts. Requests
+// without limit stay unpaged and keep the original bare array response.
+// opts.Limit is set one past the page size so writeSessions can tell
+// whether another page follows.
+func parsePage(r *http.Request, opts *ListOptions) error {
+	limitParam := r.URL.Query().Get("limit")
+	cursorParam := r.URL.Query().Get("cursor")
+	if limitParam == "" && cursorParam == "" {
+		return nil
+	}
+
+	limit := MaxPageSize
+	if limitParam != "" {
+		n, err := strconv.Atoi(limitParam)
+		if err != nil || n < 1 || n > MaxPageSize {
+			return errors.New("limit must be an integer between 1 and " + strconv.Itoa(MaxPageSize))
+		}
+		limit = n
+	}
+	opts.Limit = limit + 1
+
+	if cursorParam != "" {
+		after, err := DecodeCursor(cursorParam)
+		if err != nil {
+			return errors.New("cursor is invalid")
+		}
+		opts.After = after
+	}
+	return nil
+}
+
+// writeSessions writes a list response: a bare array for plain requests, or
+// {"sessions": [...], "deleted": [...], "nextCursor": "..."} when a limit was
+// given or deletions were requested (deleted is non-nil). The ETag header
+// identifies the sessions and deletions in the response.
+func writeSessions[T any, P recordPtr[T]](w http.ResponseWriter, opts ListOptions, sessions []T, deleted []Tombstone) {
+	if sessions == nil {
+		sessions = []T{} // Return empty array, not null
+	}
+	page := sessionPage[T]{Sessions: sessions, Deleted: deleted}
+	if pageSize := opts.Limit - 1; opts.Limit > 0 && len(sessions) > pageSize {
+		page.Sessions = sessions[:pageSize]
+		last := P(&page.Sessions[pageSize-1])
+		next := Cursor{ID: last.getID()}
+		if opts.Since.IsZero() {
+			next.Date = last.getDate()
+		} else {
+			next.UpdatedAt = last.getUpdatedAt()
+		}
+		page.NextCursor = next.Encode()
+	}
+
+	w.Header().Set("ETag", listETag[T, P](page.Sessions, deleted))
+	w.Header().Set("Content-Type", "application/json")
+	if opts.Limit == 0 && deleted == nil {
+		json.NewEncoder(w).Encode(page.Sessions)
+		return
+	}
+	json.NewEncoder(w).Encode(page)
+}
+
+// listETag returns a weak entity tag for a list response, made of the latest
+// updatedAt or deletedAt in it and the number of entries. Any write to a
+// listed session changes the latest time, and a delete changes the count.
+func listETag[T any, P recordPtr[T]](sessions []T, deleted []Tombstone) string {
+	var latest time.Time
+	for i := range sessions {
+		if updated := P(&sessions[i]).getUpdatedAt(); updated.After(latest) {
+			latest = updated
+		}
+	}
+	for _, t := range deleted {
+		if t.DeletedAt.After(latest) {
+			latest = t.DeletedAt
+		}
+	}
+	return fmt.Sprintf(`W/"%s-%d"`, latest.UTC().Format(time.RFC3339Nano), len(sessions)+len(deleted))
+}
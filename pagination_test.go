@@ -0,0 +1,98 @@
+package function
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"reflect"
+	"testing"
+)
+
+func TestListPagination(t *testing.T) {
+	useMemoryBackend(t)
+	handler := NewHandler(NewMemoryBackend())
+	for day := 1; day <= 5; day++ {
+		if w := request(t, handler, "POST", "/indoor_sessions", fmt.Sprintf(`{"date":"2024-05-0%d"}`, day)); w.Code != http.StatusCreated {
+			t.Fatalf("create: got %d %s", w.Code, w.Body.String())
+		}
+	}
+	want := []string{"2024-05-05", "2024-05-04", "2024-05-03", "2024-05-02", "2024-05-01"}
+
+	for _, query := range []string{"limit=0", "limit=-1", "limit=501", "limit=abc", "limit=1.5", "cursor=garbage"} {
+		t.Run(query, func(t *testing.T) {
+			w := request(t, handler, "GET", "/indoor_sessions?"+query, "")
+			if w.Code != http.StatusBadRequest {
+				t.Fatalf("got %d %s, want 400", w.Code, w.Body.String())
+			}
+			var resp errorResponse
+			decode(t, w, &resp)
+			if resp.Error.Code != CodeInvalidParameter {
+				t.Errorf("error code = %q, want %q", resp.Error.Code, CodeInvalidParameter)
+			}
+		})
+	}
+
+	// Without limit or cursor the response stays a bare array
+	w := request(t, handler, "GET", "/indoor_sessions", "")
+	var all []IndoorSession
+	decode(t, w, &all)
+	if dates := sessionDates(all); !reflect.DeepEqual(dates, want) {
+		t.Errorf("unpaged dates = %v, want %v", dates, want)
+	}
+
+	// Following nextCursor visits every session once, in order
+	var dates []string
+	var pages []int
+	query := url.Values{"limit": {"2"}}
+	for {
+		w := request(t, handler, "GET", "/indoor_sessions?"+query.Encode(), "")
+		if w.Code != http.StatusOK {
+			t.Fatalf("GET %s: got %d %s", query.Encode(), w.Code, w.Body.String())
+		}
+		var fields map[string]json.RawMessage
+		decode(t, w, &fields)
+		for key := range fields {
+			if key != "sessions" && key != "nextCursor" {
+				t.Errorf("page has unexpected field %q", key)
+			}
+		}
+		var page sessionPage[IndoorSession]
+		decode(t, w, &page)
+		dates = append(dates, sessionDates(page.Sessions)...)
+		pages = append(pages, len(page.Sessions))
+		if page.NextCursor == "" {
+			break
+		}
+		if len(pages) > len(want) {
+			t.Fatalf("still paging after %d pages", len(pages))
+		}
+		query.Set("cursor", page.NextCursor)
+	}
+	if !reflect.DeepEqual(pages, []int{2, 2, 1}) || !reflect.DeepEqual(dates, want) {
+		t.Errorf("pages of %v with dates %v, want pages of [2 2 1] with dates %v", pages, dates, want)
+	}
+
+	// The largest limit is accepted, and a lone cursor pages at that size
+	w = request(t, handler, "GET", fmt.Sprintf("/indoor_sessions?limit=%d", MaxPageSize), "")
+	var page sessionPage[IndoorSession]
+	decode(t, w, &page)
+	if w.Code != http.StatusOK || len(page.Sessions) != len(want) || page.NextCursor != "" {
+		t.Errorf("limit=%d: got %d with %d sessions and nextCursor %q", MaxPageSize, w.Code, len(page.Sessions), page.NextCursor)
+	}
+	cursor := Cursor{Date: "2024-05-04", ID: all[1].ID}.Encode()
+	w = request(t, handler, "GET", "/indoor_sessions?cursor="+cursor, "")
+	page = sessionPage[IndoorSession]{}
+	decode(t, w, &page)
+	if dates := sessionDates(page.Sessions); !reflect.DeepEqual(dates, want[2:]) {
+		t.Errorf("cursor without limit: dates = %v, want %v", dates, want[2:])
+	}
+}
+
+func sessionDates(sessions []IndoorSession) []string {
+	dates := make([]string, len(sessions))
+	for i, s := range sessions {
+		dates[i] = s.Date
+	}
+	return dates
+}
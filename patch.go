@@ -0,0 +1,423 @@
+package function
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// Media types accepted by the PATCH routes. Plain application/json is
+// treated as a merge patch.
+const (
+	MergePatchMediaType = "application/merge-patch+json"
+	JSONPatchMediaType  = "application/json-patch+json"
+)
+
+// errPatchConflict means a JSON Patch could not be applied to the stored
+// session: a path did not exist or a test operation failed
+var errPatchConflict = errors.New("patch cannot be applied")
+
+// patchOperation is one RFC 6902 operation. Value stays raw so a missing
+// value can be told apart from null.
+type patchOperation struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	From  string          `json:"from"`
+	Value json.RawMessage `json:"value"`
+}
+
+// patchSession implements the PATCH handler for every session type. The
+// patch is applied to the *SessionInput view of the stored session, so id
+// and timestamps cannot be patched, and the result is validated like a PUT
+// except that an invalid value the stored session already had at the same
+// path is kept.
+// Fields that are omitted when empty are absent from that view: JSON Patch
+// clients should use add rather than replace to set them.
+func patchSession[T any, In sessionInput[T], P recordPtr[T]](w http.ResponseWriter, r *http.Request, store SessionStore[T], collection, id string) {
+	ctx := r.Context()
+
+	apply, err := readPatch(r)
+	if errors.Is(err, errUnsupportedPatch) {
+		writeError(w, r, http.StatusUnsupportedMediaType, CodeUnsupportedMediaType,
+			"Content-Type must be "+MergePatchMediaType+" or "+JSONPatchMediaType)
+		return
+	}
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, CodeInvalidBody, "Invalid request body")
+		return
+	}
+
+	session, err := store.Update(ctx, id, func(s *T) error {
+		if err := checkIfMatch[T, P](r.Header.Get("If-Match"), s); err != nil {
+			return err
+		}
+		input, err := patchInput[T, In](s, apply)
+		if err != nil {
+			return err
+		}
+		if verr := input.Validate(); verr != nil {
+			// Values stored before validation existed are left as they are
+			stored, err := patchInput[T, In](s, func(doc interface{}) (interface{}, error) { return doc, nil })
+			if err != nil {
+				return err
+			}
+			same, err := sameFields(input, stored)
+			if err != nil {
+				return err
+			}
+			if verr = verr.without(stored.Validate(), same); verr != nil {
+				return verr
+			}
+		}
+		input.applyTo(s)
+		return nil
+	})
+
+	var verr *ValidationError
+	switch {
+	case err == nil:
+	case errors.Is(err, ErrNotFound):
+		writeError(w, r, http.StatusNotFound, CodeNotFound, "Session not found")
+		return
+	case errors.Is(err, errPreconditionFailed):
+		writeError(w, r, http.StatusPreconditionFailed, CodePreconditionFailed, "Session has been modified, fetch it again")
+		return
+	case errors.As(err, &verr):
+		writeValidationError(w, r, verr)
+		return
+	case errors.Is(err, errPatchConflict):
+		writeError(w, r, http.StatusConflict, CodePatchConflict, err.Error())
+		return
+	case errors.Is(err, errInvalidBody):
+		writeError(w, r, http.StatusBadRequest, CodeInvalidBody, err.Error())
+		return
+	default:
+		logFor(ctx).Error("update session failed", "collection", collection, "session", id, "error", err)
+		writeError(w, r, http.StatusInternalServerError, CodeInternal, "Failed to update session")
+		return
+	}
+
+	setETag[T, P](w, &session)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(session)
+}
+
+var errUnsupportedPatch = errors.New("unsupported patch media type")
+
+// readPatch decodes the request body into a function applying it to a
+// decoded JSON document
+func readPatch(r *http.Request) (func(doc interface{}) (interface{}, error), error) {
+	mediaType := MergePatchMediaType
+	if ct := r.Header.Get("Content-Type"); ct != "" {
+		var err error
+		if mediaType, _, err = mime.ParseMediaType(ct); err != nil {
+			return nil, errUnsupportedPatch
+		}
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	switch mediaType {
+	case MergePatchMediaType, "application/json":
+		var patch interface{}
+		if err := json.Unmarshal(body, &patch); err != nil {
+			return nil, err
+		}
+		return func(doc interface{}) (interface{}, error) { return mergePatch(doc, patch), nil }, nil
+	case JSONPatchMediaType:
+		var ops []patchOperation
+		if err := json.Unmarshal(body, &ops); err != nil {
+			return nil, err
+		}
+		return func(doc interface{}) (interface{}, error) { return applyJSONPatch(doc, ops) }, nil
+	default:
+		return nil, errUnsupportedPatch
+	}
+}
+
+// patchInput applies a patch to the input view of session and decodes the result
+func patchInput[T any, In sessionInput[T]](session *T, apply func(doc interface{}) (interface{}, error)) (In, error) {
+	var input In
+	data, err := json.Marshal(session)
+	if err != nil {
+		return input, err
+	}
+	if err := json.Unmarshal(data, &input); err != nil {
+		return input, err
+	}
+	if data, err = json.Marshal(input); err != nil {
+		return input, err
+	}
+	var doc interface{}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return input, err
+	}
+
+	if doc, err = apply(doc); err != nil {
+		return input, err
+	}
+
+	if data, err = json.Marshal(doc); err != nil {
+		return input, err
+	}
+	dec := json.NewDecoder(strings.NewReader(string(data)))
+	dec.DisallowUnknownFields()
+	input = *new(In)
+	if err := dec.Decode(&input); err != nil {
+		return input, fmt.Errorf("%w: patched session is invalid: %v", errInvalidBody, err)
+	}
+	return input, nil
+}
+
+// sameFields returns a function reporting whether the field at a
+// FieldError path such as climbs[2].attemptsNum holds the same value in the
+// JSON views of a and b
+func sameFields(a, b interface{}) (func(field string) bool, error) {
+	var docs [2]interface{}
+	for i, v := range []interface{}{a, b} {
+		data, err := json.Marshal(v)
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(data, &docs[i]); err != nil {
+			return nil, err
+		}
+	}
+	return func(field string) bool {
+		path := strings.Split(strings.NewReplacer("[", ".", "]", "").Replace(field), ".")
+		x, err := pointerGet(docs[0], path)
+		if err != nil {
+			return false
+		}
+		y, err := pointerGet(docs[1], path)
+		return err == nil && reflect.DeepEqual(x, y)
+	}, nil
+}
+
+// mergePatch applies an RFC 7396 JSON Merge Patch to target
+func mergePatch(target, patch interface{}) interface{} {
+	patchObj, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+	targetObj, ok := target.(map[string]interface{})
+	if !ok {
+		targetObj = map[string]interface{}{}
+	}
+	for key, value := range patchObj {
+		if value == nil {
+			delete(targetObj, key)
+		} else {
+			targetObj[key] = mergePatch(targetObj[key], value)
+		}
+	}
+	return targetObj
+}
+
+// applyJSONPatch applies RFC 6902 operations to doc in order
+func applyJSONPatch(doc interface{}, ops []patchOperation) (interface{}, error) {
+	for i, op := range ops {
+		path, err := parsePointer(op.Path)
+		if err != nil {
+			return nil, fmt.Errorf("%w: operation %d: %v", errInvalidBody, i, err)
+		}
+
+		var value interface{}
+		switch op.Op {
+		case "add", "replace", "test":
+			if op.Value == nil {
+				return nil, fmt.Errorf("%w: operation %d: value is required", errInvalidBody, i)
+			}
+			if err := json.Unmarshal(op.Value, &value); err != nil {
+				return nil, fmt.Errorf("%w: operation %d: %v", errInvalidBody, i, err)
+			}
+		case "move", "copy":
+			from, err := parsePointer(op.From)
+			if err != nil {
+				return nil, fmt.Errorf("%w: operation %d: %v", errInvalidBody, i, err)
+			}
+			if op.Op == "move" && len(from) == 0 {
+				return nil, fmt.Errorf("%w: operation %d: cannot move the whole session", errInvalidBody, i)
+			}
+			if op.Op == "move" && strings.HasPrefix(op.Path, op.From+"/") {
+				return nil, fmt.Errorf("%w: operation %d: cannot move %s into itself", errInvalidBody, i, op.From)
+			}
+			if value, err = pointerGet(doc, from); err != nil {
+				return nil, fmt.Errorf("operation %d: %w", i, err)
+			}
+			if op.Op == "copy" {
+				value = cloneSession(value)
+			} else if doc, err = pointerUpdate(doc, from, pointerRemove); err != nil {
+				return nil, fmt.Errorf("operation %d: %w", i, err)
+			}
+		case "remove":
+		default:
+			return nil, fmt.Errorf("%w: operation %d: unknown op %q", errInvalidBody, i, op.Op)
+		}
+
+		switch {
+		case len(path) == 0 && op.Op == "remove":
+			err = fmt.Errorf("%w: cannot remove the whole session", errInvalidBody)
+		case len(path) == 0 && op.Op != "test":
+			doc = value // The empty pointer addresses the whole document
+		case op.Op == "add", op.Op == "move", op.Op == "copy":
+			doc, err = pointerUpdate(doc, path, pointerAdd(value))
+		case op.Op == "replace":
+			doc, err = pointerUpdate(doc, path, pointerReplace(value))
+		case op.Op == "remove":
+			doc, err = pointerUpdate(doc, path, pointerRemove)
+		case op.Op == "test":
+			var current interface{}
+			if current, err = pointerGet(doc, path); err == nil && !reflect.DeepEqual(current, value) {
+				err = fmt.Errorf("%w: test failed at %s", errPatchConflict, op.Path)
+			}
+		}
+		if err != nil {
+			return nil, fmt.Errorf("operation %d: %w", i, err)
+		}
+	}
+	return doc, nil
+}
+
+// parsePointer splits an RFC 6901 JSON Pointer into unescaped tokens
+func parsePointer(pointer string) ([]string, error) {
+	if pointer == "" {
+		return nil, nil
+	}
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, fmt.Errorf("path %q must start with /", pointer)
+	}
+	tokens := strings.Split(pointer[1:], "/")
+	for i, t := range tokens {
+		tokens[i] = strings.ReplaceAll(strings.ReplaceAll(t, "~1", "/"), "~0", "~")
+	}
+	return tokens, nil
+}
+
+// pointerGet returns the value at path
+func pointerGet(doc interface{}, path []string) (interface{}, error) {
+	for _, token := range path {
+		switch node := doc.(type) {
+		case map[string]interface{}:
+			v, ok := node[token]
+			if !ok {
+				return nil, fmt.Errorf("%w: %s does not exist", errPatchConflict, token)
+			}
+			doc = v
+		case []interface{}:
+			i, err := arrayIndex(token, len(node)-1)
+			if err != nil {
+				return nil, err
+			}
+			doc = node[i]
+		default:
+			return nil, fmt.Errorf("%w: %s does not exist", errPatchConflict, token)
+		}
+	}
+	return doc, nil
+}
+
+// pointerLeaf modifies the member key of an object or array and returns the new container
+type pointerLeaf func(node interface{}, key string) (interface{}, error)
+
+// pointerUpdate applies leaf to the container holding the last token of a
+// non-empty path and returns the new document
+func pointerUpdate(doc interface{}, path []string, leaf pointerLeaf) (interface{}, error) {
+	if len(path) == 1 {
+		return leaf(doc, path[0])
+	}
+	child, err := pointerGet(doc, path[:1])
+	if err != nil {
+		return nil, err
+	}
+	if child, err = pointerUpdate(child, path[1:], leaf); err != nil {
+		return nil, err
+	}
+	return pointerReplace(child)(doc, path[0])
+}
+
+func pointerAdd(value interface{}) pointerLeaf {
+	return func(node interface{}, key string) (interface{}, error) {
+		switch node := node.(type) {
+		case map[string]interface{}:
+			node[key] = value
+			return node, nil
+		case []interface{}:
+			i := len(node)
+			if key != "-" {
+				var err error
+				if i, err = arrayIndex(key, len(node)); err != nil {
+					return nil, err
+				}
+			}
+			node = append(node, nil)
+			copy(node[i+1:], node[i:])
+			node[i] = value
+			return node, nil
+		default:
+			return nil, fmt.Errorf("%w: cannot add %s to a scalar", errPatchConflict, key)
+		}
+	}
+}
+
+func pointerReplace(value interface{}) pointerLeaf {
+	return func(node interface{}, key string) (interface{}, error) {
+		switch node := node.(type) {
+		case map[string]interface{}:
+			if _, ok := node[key]; !ok {
+				return nil, fmt.Errorf("%w: %s does not exist", errPatchConflict, key)
+			}
+			node[key] = value
+			return node, nil
+		case []interface{}:
+			i, err := arrayIndex(key, len(node)-1)
+			if err != nil {
+				return nil, err
+			}
+			node[i] = value
+			return node, nil
+		default:
+			return nil, fmt.Errorf("%w: %s does not exist", errPatchConflict, key)
+		}
+	}
+}
+
+func pointerRemove(node interface{}, key string) (interface{}, error) {
+	switch node := node.(type) {
+	case map[string]interface{}:
+		if _, ok := node[key]; !ok {
+			return nil, fmt.Errorf("%w: %s does not exist", errPatchConflict, key)
+		}
+		delete(node, key)
+		return node, nil
+	case []interface{}:
+		i, err := arrayIndex(key, len(node)-1)
+		if err != nil {
+			return nil, err
+		}
+		return append(node[:i], node[i+1:]...), nil
+	default:
+		return nil, fmt.Errorf("%w: %s does not exist", errPatchConflict, key)
+	}
+}
+
+// arrayIndex parses an array index token no greater than max
+func arrayIndex(token string, max int) (int, error) {
+	i, err := strconv.Atoi(token)
+	if err != nil || i < 0 || (len(token) > 1 && token[0] == '0') {
+		return 0, fmt.Errorf("%w: %q is not an array index", errInvalidBody, token)
+	}
+	if i > max {
+		return 0, fmt.Errorf("%w: index %d is out of range", errPatchConflict, i)
+	}
+	return i, nil
+}
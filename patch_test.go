@@ -0,0 +1,157 @@
+package function
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestPatchSession(t *testing.T) {
+	useMemoryBackend(t)
+	const stored = `{"date":"2024-05-01","location":"Arena","notes":"Warm","fingerLoad":5,
+		"trainingTypes":["Power"],"climbs":[{"grade":"6a"},{"grade":"6b","attemptType":"Flash"}]}`
+
+	grades := func(s IndoorSession) string {
+		var g []string
+		for _, c := range s.Climbs {
+			g = append(g, c.Grade)
+		}
+		return strings.Join(g, ",")
+	}
+
+	tests := []struct {
+		name        string
+		contentType string
+		patch       string
+		status      int
+		code        string                   // Error code of a failed patch
+		check       func(IndoorSession) bool // Patched session of a successful one
+	}{
+		{
+			name: "merge patch sets fields", contentType: MergePatchMediaType,
+			patch: `{"location":"Crag","fingerLoad":7}`, status: http.StatusOK,
+			check: func(s IndoorSession) bool {
+				return s.Location == "Crag" && s.FingerLoad == 7 && s.Notes == "Warm" && grades(s) == "6a,6b"
+			},
+		},
+		{
+			name: "merge patch null removes", contentType: MergePatchMediaType,
+			patch: `{"notes":null,"trainingTypes":null}`, status: http.StatusOK,
+			check: func(s IndoorSession) bool { return s.Notes == "" && s.TrainingTypes == nil && s.Location == "Arena" },
+		},
+		{
+			name: "merge patch replaces arrays", contentType: MergePatchMediaType,
+			patch: `{"climbs":[{"grade":"7a"}]}`, status: http.StatusOK,
+			check: func(s IndoorSession) bool { return grades(s) == "7a" },
+		},
+		{
+			name: "plain JSON is a merge patch", contentType: "application/json",
+			patch: `{"notes":"Cold"}`, status: http.StatusOK,
+			check: func(s IndoorSession) bool { return s.Notes == "Cold" },
+		},
+		{
+			name: "JSON Patch add", contentType: JSONPatchMediaType,
+			patch: `[{"op":"add","path":"/climbs/-","value":{"grade":"6c"}},{"op":"add","path":"/climbs/0","value":{"grade":"5c"}}]`, status: http.StatusOK,
+			check: func(s IndoorSession) bool { return grades(s) == "5c,6a,6b,6c" },
+		},
+		{
+			name: "JSON Patch remove", contentType: JSONPatchMediaType,
+			patch: `[{"op":"remove","path":"/climbs/0"},{"op":"remove","path":"/notes"}]`, status: http.StatusOK,
+			check: func(s IndoorSession) bool { return grades(s) == "6b" && s.Notes == "" },
+		},
+		{
+			name: "JSON Patch replace", contentType: JSONPatchMediaType,
+			patch: `[{"op":"replace","path":"/climbs/1/grade","value":"6b+"}]`, status: http.StatusOK,
+			check: func(s IndoorSession) bool { return grades(s) == "6a,6b+" && s.Climbs[1].AttemptType == "Flash" },
+		},
+		{
+			name: "JSON Patch test passes", contentType: JSONPatchMediaType,
+			patch: `[{"op":"test","path":"/climbs/1/grade","value":"6b"},{"op":"replace","path":"/climbs/1/grade","value":"6c"}]`, status: http.StatusOK,
+			check: func(s IndoorSession) bool { return grades(s) == "6a,6c" },
+		},
+		{
+			name: "JSON Patch test fails", contentType: JSONPatchMediaType,
+			patch:  `[{"op":"test","path":"/climbs/1/grade","value":"7a"},{"op":"replace","path":"/climbs/1/grade","value":"6c"}]`,
+			status: http.StatusConflict, code: CodePatchConflict,
+		},
+		{
+			name: "JSON Patch missing path", contentType: JSONPatchMediaType,
+			patch:  `[{"op":"replace","path":"/climbs/5/grade","value":"6c"}]`,
+			status: http.StatusConflict, code: CodePatchConflict,
+		},
+		{
+			name: "JSON Patch unknown op", contentType: JSONPatchMediaType,
+			patch:  `[{"op":"frobnicate","path":"/notes"}]`,
+			status: http.StatusBadRequest, code: CodeInvalidBody,
+		},
+		{
+			name: "unsupported Content-Type", contentType: "text/plain",
+			patch: `notes=Cold`, status: http.StatusUnsupportedMediaType, code: CodeUnsupportedMediaType,
+		},
+		{
+			name: "unknown field", contentType: MergePatchMediaType,
+			patch: `{"id":"other","bogus":true}`, status: http.StatusBadRequest, code: CodeInvalidBody,
+		},
+		{
+			name: "wrong type", contentType: JSONPatchMediaType,
+			patch: `[{"op":"replace","path":"/climbs","value":"none"}]`, status: http.StatusBadRequest, code: CodeInvalidBody,
+		},
+		{
+			name: "invalid session", contentType: MergePatchMediaType,
+			patch: `{"date":"2024-13-45","fingerLoad":11}`, status: http.StatusUnprocessableEntity, code: CodeValidationFailed,
+		},
+		{
+			name: "removing a required field", contentType: JSONPatchMediaType,
+			patch: `[{"op":"remove","path":"/date"}]`, status: http.StatusUnprocessableEntity, code: CodeValidationFailed,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := NewHandler(NewMemoryBackend())
+			w := request(t, handler, "POST", "/indoor_sessions", stored)
+			if w.Code != http.StatusCreated {
+				t.Fatalf("create: got %d %s", w.Code, w.Body.String())
+			}
+			var before IndoorSession
+			decode(t, w, &before)
+			path := "/indoor_sessions/" + before.ID
+
+			w = request(t, handler, "PATCH", path, tt.patch, "Content-Type", tt.contentType)
+			if w.Code != tt.status {
+				t.Fatalf("PATCH: got %d %s, want %d", w.Code, w.Body.String(), tt.status)
+			}
+			if tt.check != nil {
+				var patched IndoorSession
+				decode(t, w, &patched)
+				if patched.ID != before.ID || !patched.CreatedAt.Equal(before.CreatedAt) || !patched.UpdatedAt.After(before.UpdatedAt) {
+					t.Errorf("PATCH changed identity or kept updatedAt: %+v", patched)
+				}
+				if !tt.check(patched) {
+					t.Errorf("PATCH result = %+v", patched)
+				}
+				return
+			}
+
+			var resp errorResponse
+			decode(t, w, &resp)
+			if resp.Error.Code != tt.code {
+				t.Errorf("error code = %q, want %q", resp.Error.Code, tt.code)
+			}
+			// A failed patch leaves the session untouched
+			var after IndoorSession
+			decode(t, request(t, handler, "GET", path, ""), &after)
+			if !after.UpdatedAt.Equal(before.UpdatedAt) || grades(after) != "6a,6b" || after.Notes != "Warm" {
+				t.Errorf("session changed by a failed PATCH: %+v", after)
+			}
+		})
+	}
+}
+
+func TestPatchNotFound(t *testing.T) {
+	useMemoryBackend(t)
+	w := request(t, NewHandler(NewMemoryBackend()), "PATCH", "/indoor_sessions/missing", `{"notes":"x"}`, "Content-Type", MergePatchMediaType)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("PATCH a missing session: got %d %s, want 404", w.Code, w.Body.String())
+	}
+}
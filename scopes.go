@@ -0,0 +1,160 @@
+package function
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Scope permissions. A scope is written resource:permission, e.g.
+// gym_sessions:read, with * standing for every resource. read allows GET;
+// write allows POST, PUT, PATCH and DELETE and does not imply read.
+const (
+	ScopeRead  = "read"
+	ScopeWrite = "write"
+)
+
+// Resources lists the session resources served by WorkoutAPI
+var Resources = []string{"indoor_sessions", "outdoor_sessions", "fingerboard_sessions", "competition_sessions", "gym_sessions"}
+
+// parseScope splits and validates a scope string
+func parseScope(scope string) (resource, permission string, err error) {
+	resource, permission, ok := strings.Cut(scope, ":")
+	if !ok || (permission != ScopeRead && permission != ScopeWrite) {
+		return "", "", fmt.Errorf("scope %q must be resource:read or resource:write", scope)
+	}
+	if resource != "*" && !isResource(resource) {
+		return "", "", fmt.Errorf("scope %q names an unknown resource", scope)
+	}
+	return resource, permission, nil
+}
+
+func isResource(name string) bool {
+	for _, r := range Resources {
+		if r == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Allows reports whether the principal may read (write false) or modify
+// (write true) resource. Admins and unscoped tokens may do anything.
+func (p Principal) Allows(resource string, write bool) bool {
+	if p.Admin || p.Scopes == nil {
+		return true
+	}
+	want := ScopeRead
+	if write {
+		want = ScopeWrite
+	}
+	for _, scope := range p.Scopes {
+		res, perm, err := parseScope(scope)
+		if err == nil && perm == want && (res == "*" || res == resource) {
+			return true
+		}
+	}
+	return false
+}
+
+// resourceOf returns the session resource addressed by path, or "". The
+// first path segment must equal the resource name exactly; routeSessions
+// routes on the same value.
+func resourceOf(path string) string {
+	name, _, _ := strings.Cut(strings.TrimPrefix(path, "/"), "/")
+	if isResource(name) {
+		return name
+	}
+	return ""
+}
+
+// writeScopeError responds to a request outside the principal's scopes
+func writeScopeError(w http.ResponseWriter, r *http.Request) {
+	writeError(w, r, http.StatusForbidden, CodeForbidden, "API key is not permitted to perform this request")
+}
+
+// keyInput is the body of POST /keys
+type keyInput struct {
+	Name   string   `json:"name"`
+	UserID string   `json:"userId"` // Owner of the sessions the key can reach, empty for the shared collections
+	Scopes []string `json:"scopes"` // Omitted or null for an unrestricted key
+}
+
+// HandleKeys serves the admin routes for minting and revoking API keys,
+// optionally restricted to scopes:
+//
+//	GET /keys?userId=..., POST /keys, DELETE /keys/{id}
+func HandleKeys(w http.ResponseWriter, r *http.Request, users UserStore) {
+	ctx := r.Context()
+
+	id := strings.TrimPrefix(strings.TrimPrefix(r.URL.Path, "/keys"), "/")
+	switch {
+	case id == "" && r.Method == "GET":
+		tokens, err := users.ListTokens(ctx, r.URL.Query().Get("userId"))
+		if err != nil {
+			logFor(ctx).Error("list keys failed", "userId", r.URL.Query().Get("userId"), "error", err)
+			writeError(w, r, http.StatusInternalServerError, CodeInternal, "Failed to fetch keys")
+			return
+		}
+		if tokens == nil {
+			tokens = []APIToken{}
+		}
+		writeJSON(w, http.StatusOK, tokens)
+
+	case id == "" && r.Method == "POST":
+		var input keyInput
+		if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+			writeError(w, r, http.StatusBadRequest, CodeInvalidBody, "Invalid request body")
+			return
+		}
+		var fields []FieldError
+		for i, scope := range input.Scopes {
+			if _, _, err := parseScope(scope); err != nil {
+				fields = append(fields, FieldError{Field: fmt.Sprintf("scopes[%d]", i), Message: err.Error()})
+			}
+		}
+		if input.Scopes != nil && len(input.Scopes) == 0 {
+			fields = append(fields, FieldError{Field: "scopes", Message: "must not be empty; omit it for an unrestricted key"})
+		}
+		if fields != nil {
+			writeValidationError(w, r, &ValidationError{Fields: fields})
+			return
+		}
+		if input.UserID != "" {
+			if _, err := users.GetUser(ctx, input.UserID); err != nil {
+				writeUserError(w, r, err)
+				return
+			}
+		}
+
+		secret := newTokenSecret()
+		token, err := users.CreateToken(ctx, APIToken{UserID: input.UserID, Name: input.Name, Scopes: input.Scopes, Hash: hashToken(secret)})
+		if err != nil {
+			logFor(ctx).Error("create key failed", "userId", input.UserID, "error", err)
+			writeError(w, r, http.StatusInternalServerError, CodeInternal, "Failed to create key")
+			return
+		}
+		logFor(ctx).Info("minted API key", "keyId", token.ID, "userId", token.UserID, "scopes", token.Scopes)
+		writeJSON(w, http.StatusCreated, issuedToken{APIToken: token, Secret: secret})
+
+	case id != "" && !strings.Contains(id, "/") && r.Method == "DELETE":
+		token, err := users.GetToken(ctx, id)
+		if err == nil {
+			err = users.RevokeToken(ctx, token.UserID, id)
+		}
+		if err != nil {
+			writeUserError(w, r, err)
+			return
+		}
+		logFor(ctx).Info("revoked API key", "keyId", id, "userId", token.UserID)
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		writeError(w, r, http.StatusNotFound, CodeNotFound, "Not found")
+	}
+}
+
+// errForbidden is reported for batch operations outside the principal's scopes
+var errForbidden = errors.New("operation not permitted")
@@ -0,0 +1,154 @@
+package function
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// mintKey creates an API key for the shared collections through POST /keys
+// and returns it with its secret; scopes is the JSON scopes value, or "" to
+// omit it
+func mintKey(t *testing.T, handler http.Handler, scopes string) issuedToken {
+	t.Helper()
+	body := `{"name":"test"}`
+	if scopes != "" {
+		body = `{"name":"test","scopes":` + scopes + `}`
+	}
+	w := request(t, handler, "POST", "/keys", body)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("POST /keys: got %d %s", w.Code, w.Body.String())
+	}
+	var token issuedToken
+	decode(t, w, &token)
+	return token
+}
+
+func TestScopedKeys(t *testing.T) {
+	useMemoryBackend(t)
+	handler := NewHandler(NewMemoryBackend())
+	w := request(t, handler, "POST", "/indoor_sessions", `{"date":"2024-05-01"}`)
+	var session IndoorSession
+	decode(t, w, &session)
+	path := "/indoor_sessions/" + session.ID
+
+	readOnly := mintKey(t, handler, `["*:read"]`).Secret
+	gymOnly := mintKey(t, handler, `["gym_sessions:read","gym_sessions:write"]`).Secret
+	writeOnly := mintKey(t, handler, `["indoor_sessions:write"]`).Secret
+	unscoped := mintKey(t, handler, "").Secret
+
+	tests := []struct {
+		name, key, method, path, body string
+		status                        int
+	}{
+		{"read-only GET list", readOnly, "GET", "/indoor_sessions", "", http.StatusOK},
+		{"read-only GET", readOnly, "GET", path, "", http.StatusOK},
+		{"read-only POST", readOnly, "POST", "/indoor_sessions", `{"date":"2024-05-02"}`, http.StatusForbidden},
+		{"read-only PUT", readOnly, "PUT", path, `{"date":"2024-05-02"}`, http.StatusForbidden},
+		{"read-only PATCH", readOnly, "PATCH", path, `{"notes":"x"}`, http.StatusForbidden},
+		{"read-only DELETE", readOnly, "DELETE", path, "", http.StatusForbidden},
+		{"read-only sync", readOnly, "GET", "/sync", "", http.StatusOK},
+		{"read-only batch", readOnly, "POST", "/batch", `{"operations":[{"op":"delete","resource":"indoor_sessions","id":"` + session.ID + `"}]}`, http.StatusForbidden},
+		{"gym-only GET other resource", gymOnly, "GET", "/indoor_sessions", "", http.StatusForbidden},
+		{"gym-only sync", gymOnly, "GET", "/sync", "", http.StatusForbidden},
+		{"gym-only GET", gymOnly, "GET", "/gym_sessions", "", http.StatusOK},
+		{"gym-only POST", gymOnly, "POST", "/gym_sessions", `{"date":"2024-05-02"}`, http.StatusCreated},
+		{"write does not imply read", writeOnly, "GET", path, "", http.StatusForbidden},
+		{"write-only PATCH", writeOnly, "PATCH", path, `{"notes":"x"}`, http.StatusOK},
+		{"unscoped", unscoped, "GET", "/gym_sessions", "", http.StatusOK},
+		{"gym-only GET suffixed resource", gymOnly, "GET", "/indoor_sessionsX", "", http.StatusNotFound},
+		{"gym-only POST suffixed resource", gymOnly, "POST", "/indoor_sessionsX", `{"date":"2024-05-02"}`, http.StatusNotFound},
+		{"gym-only GET resource extension", gymOnly, "GET", "/indoor_sessions.json", "", http.StatusNotFound},
+		{"gym-only POST resource extension", gymOnly, "POST", "/indoor_sessions.json", `{"date":"2024-05-02"}`, http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := request(t, handler, tt.method, tt.path, tt.body, "x-api-key", tt.key, "Content-Type", "application/json")
+			if w.Code != tt.status {
+				t.Fatalf("got %d %s, want %d", w.Code, w.Body.String(), tt.status)
+			}
+			if tt.status == http.StatusForbidden && tt.path != "/batch" { // Batch errors are per operation
+				var resp errorResponse
+				decode(t, w, &resp)
+				if resp.Error.Code != CodeForbidden {
+					t.Errorf("error code = %q, want %q", resp.Error.Code, CodeForbidden)
+				}
+			}
+		})
+	}
+	if w := request(t, handler, "GET", path, ""); !strings.Contains(w.Body.String(), `"notes":"x"`) {
+		t.Errorf("session after the write-only PATCH: %s", w.Body.String())
+	}
+}
+
+func TestBatchScopes(t *testing.T) {
+	useMemoryBackend(t)
+	handler := NewHandler(NewMemoryBackend())
+	key := mintKey(t, handler, `["indoor_sessions:write"]`).Secret
+
+	w := request(t, handler, "POST", "/batch", `{"operations":[
+		{"op":"create","resource":"indoor_sessions","data":{"date":"2024-05-01"}},
+		{"op":"create","resource":"gym_sessions","data":{"date":"2024-05-01"}}
+	]}`, "x-api-key", key)
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("batch outside the key's scopes: got %d %s, want 403", w.Code, w.Body.String())
+	}
+	var resp BatchResponse
+	decode(t, w, &resp)
+	if r := resp.Results[1]; r.Status != http.StatusForbidden || r.Error == nil || r.Error.Code != CodeForbidden {
+		t.Errorf("gym operation = %+v, want 403 %s", r, CodeForbidden)
+	}
+	if r := resp.Results[0]; r.Status != http.StatusFailedDependency {
+		t.Errorf("indoor operation = %+v, want 424 as the batch failed", r)
+	}
+	if n := countSessions(t, handler, "indoor_sessions"); n != 0 {
+		t.Errorf("indoor sessions after the forbidden batch = %d, want 0", n)
+	}
+
+	w = request(t, handler, "POST", "/batch", `{"operations":[{"op":"create","resource":"indoor_sessions","data":{"date":"2024-05-01"}}]}`, "x-api-key", key)
+	if w.Code != http.StatusOK {
+		t.Errorf("batch within the key's scopes: got %d %s, want 200", w.Code, w.Body.String())
+	}
+}
+
+func TestKeysAdminOnly(t *testing.T) {
+	useMemoryBackend(t)
+	handler := NewHandler(NewMemoryBackend())
+	scoped := mintKey(t, handler, `["*:read","*:write"]`)
+	unscoped := mintKey(t, handler, "")
+
+	for _, key := range []string{scoped.Secret, unscoped.Secret} {
+		for _, req := range []struct{ method, path, body string }{
+			{"GET", "/keys", ""},
+			{"POST", "/keys", `{"name":"escalate"}`},
+			{"DELETE", "/keys/" + scoped.ID, ""},
+		} {
+			if w := request(t, handler, req.method, req.path, req.body, "x-api-key", key); w.Code != http.StatusForbidden {
+				t.Errorf("%s %s with a non-admin key: got %d %s, want 403", req.method, req.path, w.Code, w.Body.String())
+			}
+		}
+	}
+
+	// The admin lists and revokes keys, and a revoked key stops working
+	w := request(t, handler, "GET", "/keys", "")
+	var keys []APIToken
+	decode(t, w, &keys)
+	if len(keys) != 2 {
+		t.Errorf("GET /keys = %d keys, want 2", len(keys))
+	}
+	for _, k := range keys {
+		if raw, _ := json.Marshal(k); strings.Contains(string(raw), scoped.Secret) {
+			t.Errorf("GET /keys exposes a secret: %s", raw)
+		}
+	}
+	if w := request(t, handler, "POST", "/keys", `{"scopes":["*:delete"]}`); w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("POST /keys with an invalid scope: got %d, want 422", w.Code)
+	}
+	if w := request(t, handler, "DELETE", "/keys/"+scoped.ID, ""); w.Code != http.StatusNoContent {
+		t.Fatalf("DELETE /keys/%s: got %d %s", scoped.ID, w.Code, w.Body.String())
+	}
+	if w := request(t, handler, "GET", "/indoor_sessions", "", "x-api-key", scoped.Secret); w.Code != http.StatusUnauthorized {
+		t.Errorf("revoked key: got %d, want 401", w.Code)
+	}
+}
@@ -0,0 +1,949 @@
+package function
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"modernc.org/sqlite" // Pure Go SQLite driver
+)
+
+// sqliteMigrations are applied in order on startup; append only, never edit
+var sqliteMigrations = []string{
+	`CREATE TABLE indoor_sessions (
+		owner           TEXT NOT NULL,
+		id              TEXT NOT NULL,
+		date            TEXT NOT NULL,
+		location        TEXT NOT NULL,
+		custom_location TEXT NOT NULL,
+		climbing_type   TEXT NOT NULL,
+		training_types  TEXT NOT NULL,
+		difficulty      TEXT NOT NULL,
+		categories      TEXT NOT NULL,
+		energy_systems  TEXT NOT NULL,
+		wall_angles     TEXT NOT NULL,
+		finger_load     INTEGER NOT NULL,
+		shoulder_load   INTEGER NOT NULL,
+		forearm_load    INTEGER NOT NULL,
+		open_grip       INTEGER NOT NULL,
+		crimp_grip      INTEGER NOT NULL,
+		pinch_grip      INTEGER NOT NULL,
+		sloper_grip     INTEGER NOT NULL,
+		jug_grip        INTEGER NOT NULL,
+		notes           TEXT NOT NULL,
+		created_at      INTEGER NOT NULL,
+		updated_at      INTEGER NOT NULL,
+		PRIMARY KEY (owner, id)
+	);
+	CREATE INDEX indoor_sessions_owner_date ON indoor_sessions (owner, date);
+	CREATE INDEX indoor_sessions_owner_updated_at ON indoor_sessions (owner, updated_at);
+
+	CREATE TABLE indoor_climbs (
+		owner           TEXT NOT NULL,
+		session_id      TEXT NOT NULL,
+		position        INTEGER NOT NULL,
+		is_sport        INTEGER NOT NULL,
+		name            TEXT NOT NULL,
+		grade           TEXT NOT NULL,
+		attempt_type    TEXT NOT NULL,
+		attempts_num    INTEGER NOT NULL,
+		notes           TEXT NOT NULL,
+		wall            TEXT NOT NULL,
+		technique_focus TEXT NOT NULL,
+		PRIMARY KEY (owner, session_id, position),
+		FOREIGN KEY (owner, session_id) REFERENCES indoor_sessions (owner, id) ON DELETE CASCADE
+	);
+
+	CREATE TABLE outdoor_sessions (
+		owner          TEXT NOT NULL,
+		id             TEXT NOT NULL,
+		date           TEXT NOT NULL,
+		area           TEXT NOT NULL,
+		crag           TEXT NOT NULL,
+		sector         TEXT NOT NULL,
+		climbing_type  TEXT NOT NULL,
+		training_types TEXT NOT NULL,
+		difficulty     TEXT NOT NULL,
+		categories     TEXT NOT NULL,
+		energy_systems TEXT NOT NULL,
+		finger_load    INTEGER NOT NULL,
+		shoulder_load  INTEGER NOT NULL,
+		forearm_load   INTEGER NOT NULL,
+		open_grip      INTEGER NOT NULL,
+		crimp_grip     INTEGER NOT NULL,
+		pinch_grip     INTEGER NOT NULL,
+		sloper_grip    INTEGER NOT NULL,
+		jug_grip       INTEGER NOT NULL,
+		notes          TEXT NOT NULL,
+		created_at     INTEGER NOT NULL,
+		updated_at     INTEGER NOT NULL,
+		PRIMARY KEY (owner, id)
+	);
+	CREATE INDEX outdoor_sessions_owner_date ON outdoor_sessions (owner, date);
+	CREATE INDEX outdoor_sessions_owner_updated_at ON outdoor_sessions (owner, updated_at);
+
+	CREATE TABLE outdoor_climbs (
+		owner           TEXT NOT NULL,
+		session_id      TEXT NOT NULL,
+		position        INTEGER NOT NULL,
+		is_sport        INTEGER NOT NULL,
+		name            TEXT NOT NULL,
+		grade           TEXT NOT NULL,
+		attempt_type    TEXT NOT NULL,
+		attempts_num    INTEGER NOT NULL,
+		notes           TEXT NOT NULL,
+		wall            TEXT NOT NULL,
+		technique_focus TEXT NOT NULL,
+		PRIMARY KEY (owner, session_id, position),
+		FOREIGN KEY (owner, session_id) REFERENCES outdoor_sessions (owner, id) ON DELETE CASCADE
+	);
+
+	CREATE TABLE fingerboard_sessions (
+		owner      TEXT NOT NULL,
+		id         TEXT NOT NULL,
+		date       TEXT NOT NULL,
+		location   TEXT NOT NULL,
+		created_at INTEGER NOT NULL,
+		updated_at INTEGER NOT NULL,
+		PRIMARY KEY (owner, id)
+	);
+	CREATE INDEX fingerboard_sessions_owner_date ON fingerboard_sessions (owner, date);
+	CREATE INDEX fingerboard_sessions_owner_updated_at ON fingerboard_sessions (owner, updated_at);
+
+	CREATE TABLE fingerboard_exercises (
+		owner       TEXT NOT NULL,
+		session_id  TEXT NOT NULL,
+		position    INTEGER NOT NULL,
+		exercise_id TEXT NOT NULL,
+		name        TEXT NOT NULL,
+		grip_type   TEXT NOT NULL,
+		sets        INTEGER NOT NULL,
+		notes       TEXT NOT NULL,
+		PRIMARY KEY (owner, session_id, position),
+		FOREIGN KEY (owner, session_id) REFERENCES fingerboard_sessions (owner, id) ON DELETE CASCADE
+	);
+
+	CREATE TABLE fingerboard_sets (
+		owner             TEXT NOT NULL,
+		session_id        TEXT NOT NULL,
+		exercise_position INTEGER NOT NULL,
+		position          INTEGER NOT NULL,
+		weight            REAL NOT NULL,
+		reps              INTEGER NOT NULL,
+		PRIMARY KEY (owner, session_id, exercise_position, position),
+		FOREIGN KEY (owner, session_id, exercise_position)
+			REFERENCES fingerboard_exercises (owner, session_id, position) ON DELETE CASCADE
+	);
+
+	CREATE TABLE competition_sessions (
+		owner         TEXT NOT NULL,
+		id            TEXT NOT NULL,
+		date          TEXT NOT NULL,
+		venue         TEXT NOT NULL,
+		custom_venue  TEXT NOT NULL,
+		type          TEXT NOT NULL,
+		finger_load   INTEGER NOT NULL,
+		shoulder_load INTEGER NOT NULL,
+		forearm_load  INTEGER NOT NULL,
+		notes         TEXT NOT NULL,
+		created_at    INTEGER NOT NULL,
+		updated_at    INTEGER NOT NULL,
+		PRIMARY KEY (owner, id)
+	);
+	CREATE INDEX competition_sessions_owner_date ON competition_sessions (owner, date);
+	CREATE INDEX competition_sessions_owner_updated_at ON competition_sessions (owner, updated_at);
+
+	CREATE TABLE competition_rounds (
+		owner      TEXT NOT NULL,
+		session_id TEXT NOT NULL,
+		position   INTEGER NOT NULL,
+		name       TEXT NOT NULL,
+		placing    INTEGER,
+		PRIMARY KEY (owner, session_id, position),
+		FOREIGN KEY (owner, session_id) REFERENCES competition_sessions (owner, id) ON DELETE CASCADE
+	);
+
+	CREATE TABLE competition_climbs (
+		owner          TEXT NOT NULL,
+		session_id     TEXT NOT NULL,
+		round_position INTEGER NOT NULL,
+		position       INTEGER NOT NULL,
+		name           TEXT NOT NULL,
+		status         TEXT NOT NULL,
+		attempt_count  INTEGER NOT NULL,
+		notes          TEXT NOT NULL,
+		PRIMARY KEY (owner, session_id, round_position, position),
+		FOREIGN KEY (owner, session_id, round_position)
+			REFERENCES competition_rounds (owner, session_id, position) ON DELETE CASCADE
+	);
+
+	CREATE TABLE gym_sessions (
+		owner          TEXT NOT NULL,
+		id             TEXT NOT NULL,
+		date           TEXT NOT NULL,
+		name           TEXT NOT NULL,
+		bodyweight     REAL NOT NULL,
+		training_block TEXT NOT NULL,
+		created_at     INTEGER NOT NULL,
+		updated_at     INTEGER NOT NULL,
+		PRIMARY KEY (owner, id)
+	);
+	CREATE INDEX gym_sessions_owner_date ON gym_sessions (owner, date);
+	CREATE INDEX gym_sessions_owner_updated_at ON gym_sessions (owner, updated_at);
+
+	CREATE TABLE gym_exercises (
+		owner       TEXT NOT NULL,
+		session_id  TEXT NOT NULL,
+		position    INTEGER NOT NULL,
+		exercise_id TEXT NOT NULL,
+		name        TEXT NOT NULL,
+		notes       TEXT NOT NULL,
+		linked_to   TEXT NOT NULL,
+		difficulty  TEXT NOT NULL,
+		PRIMARY KEY (owner, session_id, position),
+		FOREIGN KEY (owner, session_id) REFERENCES gym_sessions (owner, id) ON DELETE CASCADE
+	);
+
+	CREATE TABLE gym_sets (
+		owner             TEXT NOT NULL,
+		session_id        TEXT NOT NULL,
+		exercise_position INTEGER NOT NULL,
+		position          INTEGER NOT NULL,
+		weight            REAL NOT NULL,
+		reps              INTEGER NOT NULL,
+		is_warmup         INTEGER NOT NULL,
+		is_failure        INTEGER NOT NULL,
+		is_drop_set       INTEGER NOT NULL,
+		completed         INTEGER NOT NULL,
+		PRIMARY KEY (owner, session_id, exercise_position, position),
+		FOREIGN KEY (owner, session_id, exercise_position)
+			REFERENCES gym_exercises (owner, session_id, position) ON DELETE CASCADE
+	);`,
+
+	`CREATE TABLE tombstones (
+		collection TEXT NOT NULL,
+		owner      TEXT NOT NULL,
+		id         TEXT NOT NULL,
+		deleted_at INTEGER NOT NULL,
+		PRIMARY KEY (collection, owner, id)
+	);
+	CREATE INDEX tombstones_owner_deleted_at ON tombstones (collection, owner, deleted_at);`,
+
+	`CREATE TABLE users (
+		id         TEXT PRIMARY KEY,
+		name       TEXT NOT NULL,
+		created_at INTEGER NOT NULL
+	);
+
+	CREATE TABLE api_tokens (
+		id         TEXT PRIMARY KEY,
+		user_id    TEXT NOT NULL,
+		name       TEXT NOT NULL,
+		scopes     TEXT,
+		hash       TEXT NOT NULL UNIQUE,
+		created_at INTEGER NOT NULL
+	);
+	CREATE INDEX api_tokens_user_id ON api_tokens (user_id);`,
+
+	`CREATE TABLE idempotency_keys (
+		key         TEXT PRIMARY KEY,
+		fingerprint TEXT NOT NULL,
+		completed   INTEGER NOT NULL,
+		status      INTEGER NOT NULL,
+		header      TEXT NOT NULL,
+		body        BLOB,
+		created_at  INTEGER NOT NULL,
+		expires_at  INTEGER NOT NULL
+	);
+	CREATE INDEX idempotency_keys_expires_at ON idempotency_keys (expires_at);`,
+}
+
+// OpenSQLite opens (creating if needed) the SQLite database at path and
+// applies any pending schema migrations
+func OpenSQLite(ctx context.Context, path string) (*sql.DB, error) {
+	// Built as a URI so a path containing ? or # is escaped rather than cut short
+	dsn := (&url.URL{
+		Scheme:   "file",
+		OmitHost: true,
+		Path:     path,
+		RawQuery: "_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)",
+	}).String()
+	db := sql.OpenDB(sqliteConnector{dsn: dsn})
+	// SQLite allows a single writer; one connection also keeps :memory: databases shared
+	db.SetMaxOpenConns(1)
+
+	if err := migrateSQLite(ctx, db); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+// sqliteConnector opens driver connections that never see a context's
+// cancellation. The driver interrupts a statement when its context ends, but
+// the interrupt can race with the statement finishing and land on the next
+// request's statement on the shared connection, or leave a half-read
+// statement active so every later statement is interrupted too.
+// database/sql still honours cancellation between statements: it checks the
+// context before each one, closes open rows and rolls back the transaction.
+type sqliteConnector struct {
+	dsn string
+}
+
+func (c sqliteConnector) Connect(context.Context) (driver.Conn, error) {
+	conn, err := c.Driver().Open(c.dsn)
+	if err != nil {
+		return nil, err
+	}
+	return uninterruptibleConn{conn.(sqliteConn)}, nil
+}
+
+func (c sqliteConnector) Driver() driver.Driver { return &sqlite.Driver{} }
+
+// sqliteConn is the subset of the driver's connection used by database/sql
+type sqliteConn interface {
+	driver.Conn
+	driver.ConnBeginTx
+	driver.ConnPrepareContext
+	driver.ExecerContext
+	driver.QueryerContext
+	driver.Pinger
+}
+
+// uninterruptibleConn passes contexts to the driver without their cancellation
+type uninterruptibleConn struct {
+	sqliteConn
+}
+
+func (c uninterruptibleConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	return c.sqliteConn.BeginTx(context.WithoutCancel(ctx), opts)
+}
+
+func (c uninterruptibleConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	stmt, err := c.sqliteConn.PrepareContext(context.WithoutCancel(ctx), query)
+	if err != nil {
+		return nil, err
+	}
+	return uninterruptibleStmt{stmt.(sqliteStmt)}, nil
+}
+
+func (c uninterruptibleConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	return c.sqliteConn.ExecContext(context.WithoutCancel(ctx), query, args)
+}
+
+func (c uninterruptibleConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	return c.sqliteConn.QueryContext(context.WithoutCancel(ctx), query, args)
+}
+
+func (c uninterruptibleConn) Ping(ctx context.Context) error {
+	return c.sqliteConn.Ping(context.WithoutCancel(ctx))
+}
+
+// sqliteStmt is the subset of the driver's prepared statement used by database/sql
+type sqliteStmt interface {
+	driver.Stmt
+	driver.StmtExecContext
+	driver.StmtQueryContext
+}
+
+// uninterruptibleStmt passes contexts to the driver without their cancellation
+type uninterruptibleStmt struct {
+	sqliteStmt
+}
+
+func (s uninterruptibleStmt) ExecContext(ctx context.Context, args []driver.NamedValue) (driver.Result, error) {
+	return s.sqliteStmt.ExecContext(context.WithoutCancel(ctx), args)
+}
+
+func (s uninterruptibleStmt) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
+	return s.sqliteStmt.QueryContext(context.WithoutCancel(ctx), args)
+}
+
+// migrateSQLite applies every migration newer than the recorded schema version
+func migrateSQLite(ctx context.Context, db *sql.DB) error {
+	if _, err := db.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (version INTEGER PRIMARY KEY)`); err != nil {
+		return err
+	}
+
+	var version int
+	if err := db.QueryRowContext(ctx, `SELECT COALESCE(MAX(version), 0) FROM schema_migrations`).Scan(&version); err != nil {
+		return err
+	}
+
+	for i := version; i < len(sqliteMigrations); i++ {
+		tx, err := db.BeginTx(ctx, nil)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, sqliteMigrations[i]); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("migration %d: %w", i+1, err)
+		}
+		if _, err := tx.ExecContext(ctx, `INSERT INTO schema_migrations (version) VALUES (?)`, i+1); err != nil {
+			tx.Rollback()
+			return err
+		}
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// NewSQLiteStores returns Stores over the shared sessions of an SQLite
+// database opened with OpenSQLite
+func NewSQLiteStores(db *sql.DB) *Stores {
+	return newSQLiteStores(db, "")
+}
+
+// newSQLiteStores returns Stores over the sessions owned by owner
+func newSQLiteStores(db *sql.DB, owner string) *Stores {
+	stores := sqliteStoresIn(db, nil, owner)
+	stores.runTx = func(ctx context.Context, fn func(*Stores) error) error {
+		return sqliteTx(ctx, db, nil, func(tx *sql.Tx) error {
+			return fn(sqliteStoresIn(db, tx, owner))
+		})
+	}
+	return stores
+}
+
+// sqliteStoresIn returns Stores over the sessions owned by owner that run
+// in tx, or each in their own transaction when tx is nil
+func sqliteStoresIn(db *sql.DB, tx *sql.Tx, owner string) *Stores {
+	return &Stores{
+		Indoor:      &sqlStore[IndoorSession, *IndoorSession]{db: db, tx: tx, owner: owner, collection: IndoorCollection, table: "indoor_sessions", write: writeIndoorSession, read: readIndoorSessions},
+		Outdoor:     &sqlStore[OutdoorSession, *OutdoorSession]{db: db, tx: tx, owner: owner, collection: OutdoorCollection, table: "outdoor_sessions", write: writeOutdoorSession, read: readOutdoorSessions},
+		Fingerboard: &sqlStore[FingerboardSession, *FingerboardSession]{db: db, tx: tx, owner: owner, collection: FingerboardCollection, table: "fingerboard_sessions", write: writeFingerboardSession, read: readFingerboardSessions},
+		Competition: &sqlStore[CompetitionSession, *CompetitionSession]{db: db, tx: tx, owner: owner, collection: CompetitionCollection, table: "competition_sessions", write: writeCompetitionSession, read: readCompetitionSessions},
+		Gym:         &sqlStore[GymSession, *GymSession]{db: db, tx: tx, owner: owner, collection: GymCollection, table: "gym_sessions", write: writeGymSession, read: readGymSessions},
+	}
+}
+
+// NewSQLiteBackend returns a Backend storing users, tokens and sessions in
+// an SQLite database opened with OpenSQLite
+func NewSQLiteBackend(db *sql.DB) Backend {
+	return &sqliteBackend{db: db}
+}
+
+type sqliteBackend struct {
+	db *sql.DB
+}
+
+func (b *sqliteBackend) Users() UserStore { return &sqliteUsers{db: b.db} }
+
+func (b *sqliteBackend) Stores(userID string) *Stores { return newSQLiteStores(b.db, userID) }
+
+func (b *sqliteBackend) Idempotency() IdempotencyStore { return &sqliteIdempotency{db: b.db} }
+
+// sqlStore is a SessionStore over one session table and its child tables.
+// write inserts the session row and its children; read loads sessions back
+// by ID, in the order given.
+// Child rows cascade from the session row, so a session is replaced by
+// deleting and rewriting it. Rows are keyed by owner and ID, and every query
+// is restricted to the owner's rows.
+// Operations run in their own transaction, or all in tx when it is set.
+type sqlStore[T any, P recordPtr[T]] struct {
+	db         *sql.DB
+	owner      string // User ID owning the sessions, empty for the shared ones
+	collection string // Collection name recorded on tombstones
+	table      string
+	write      func(ctx context.Context, tx *sql.Tx, owner string, session *T) error
+	read       func(ctx context.Context, tx *sql.Tx, owner string, ids []string) ([]T, error)
+	tx         *sql.Tx
+}
+
+func (s *sqlStore[T, P]) List(ctx context.Context, opts ListOptions) ([]T, error) {
+	query := `SELECT id FROM ` + s.table + ` WHERE owner = ?`
+	args := []interface{}{s.owner}
+	order := "date DESC, id DESC"
+
+	if !opts.Since.IsZero() {
+		query += ` AND updated_at > ?`
+		args = append(args, opts.Since.UnixNano())
+		order = "updated_at DESC, id DESC"
+	}
+	if opts.StartDate != "" {
+		query += ` AND date >= ?`
+		args = append(args, opts.StartDate)
+	}
+	if opts.EndDate != "" {
+		query += ` AND date <= ?`
+		args = append(args, opts.EndDate)
+	}
+	if opts.After != nil {
+		if !opts.Since.IsZero() {
+			after := opts.After.UpdatedAt.UnixNano()
+			query += ` AND (updated_at < ? OR (updated_at = ? AND id < ?))`
+			args = append(args, after, after, opts.After.ID)
+		} else {
+			query += ` AND (date < ? OR (date = ? AND id < ?))`
+			args = append(args, opts.After.Date, opts.After.Date, opts.After.ID)
+		}
+	}
+	query += ` ORDER BY ` + order
+	if opts.Limit > 0 {
+		query += ` LIMIT ?`
+		args = append(args, opts.Limit)
+	}
+
+	var sessions []T
+	err := s.inTx(ctx, readOnly, func(tx *sql.Tx) error {
+		ids, err := queryStrings(ctx, tx, query, args...)
+		if err != nil {
+			return err
+		}
+		for len(ids) > 0 {
+			batch := ids[:min(len(ids), sqliteReadBatch)]
+			read, err := s.read(ctx, tx, s.owner, batch)
+			if err != nil {
+				return err
+			}
+			sessions = append(sessions, read...)
+			ids = ids[len(batch):]
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return sessions, nil
+}
+
+func (s *sqlStore[T, P]) Get(ctx context.Context, id string) (T, error) {
+	var session T
+	err := s.inTx(ctx, readOnly, func(tx *sql.Tx) (err error) {
+		session, err = s.readOne(ctx, tx, id)
+		return err
+	})
+	return session, err
+}
+
+func (s *sqlStore[T, P]) Create(ctx context.Context, session T) (T, error) {
+	now := storeNow()
+	P(&session).setID(newDocumentID())
+	P(&session).setCreatedAt(now)
+	P(&session).setUpdatedAt(now)
+
+	err := s.inTx(ctx, nil, func(tx *sql.Tx) error {
+		return s.write(ctx, tx, s.owner, &session)
+	})
+	return session, err
+}
+
+func (s *sqlStore[T, P]) Update(ctx context.Context, id string, apply func(*T) error) (T, error) {
+	var updated T
+	err := s.inTx(ctx, nil, func(tx *sql.Tx) (err error) {
+		if updated, err = s.readOne(ctx, tx, id); err != nil {
+			return err
+		}
+		if err := apply(&updated); err != nil {
+			return err
+		}
+		P(&updated).setID(id)
+		P(&updated).setUpdatedAt(storeNow())
+
+		if err := s.delete(ctx, tx, id); err != nil {
+			return err
+		}
+		return s.write(ctx, tx, s.owner, &updated)
+	})
+	return updated, err
+}
+
+func (s *sqlStore[T, P]) Put(ctx context.Context, id string, apply func(*T, bool) error) (T, bool, error) {
+	var session T
+	var created bool
+	err := s.inTx(ctx, nil, func(tx *sql.Tx) error {
+		var err error
+		session, err = s.readOne(ctx, tx, id)
+		exists := err == nil
+		if err != nil && !errors.Is(err, ErrNotFound) {
+			return err
+		}
+		if err := apply(&session, exists); err != nil {
+			return err
+		}
+
+		now := storeNow()
+		P(&session).setID(id)
+		P(&session).setUpdatedAt(now)
+		if exists {
+			if err := s.delete(ctx, tx, id); err != nil {
+				return err
+			}
+		} else {
+			P(&session).setCreatedAt(now)
+			if _, err := tx.ExecContext(ctx, `DELETE FROM tombstones WHERE collection = ? AND id = ? AND owner = ?`,
+				s.collection, id, s.owner); err != nil {
+				return err
+			}
+		}
+		created = !exists
+		return s.write(ctx, tx, s.owner, &session)
+	})
+	if err != nil {
+		return session, false, err
+	}
+	return session, created, nil
+}
+
+func (s *sqlStore[T, P]) Delete(ctx context.Context, id string, check func(*T) error) error {
+	return s.inTx(ctx, nil, func(tx *sql.Tx) error {
+		if err := s.owns(ctx, tx, id); err != nil {
+			return err
+		}
+		if check != nil {
+			current, err := s.readOne(ctx, tx, id)
+			if err != nil {
+				return err
+			}
+			if err := check(&current); err != nil {
+				return err
+			}
+		}
+
+		if err := s.delete(ctx, tx, id); err != nil {
+			return err
+		}
+		_, err := tx.ExecContext(ctx, `INSERT OR REPLACE INTO tombstones (collection, id, owner, deleted_at) VALUES (?, ?, ?, ?)`,
+			s.collection, id, s.owner, storeNow().UnixNano())
+		return err
+	})
+}
+
+func (s *sqlStore[T, P]) Deleted(ctx context.Context, since time.Time) ([]Tombstone, error) {
+	var tombstones []Tombstone
+	err := s.inTx(ctx, readOnly, func(tx *sql.Tx) error {
+		rows, err := tx.QueryContext(ctx, `SELECT id, deleted_at FROM tombstones
+		WHERE collection = ? AND owner = ? AND deleted_at > ? ORDER BY deleted_at`, s.collection, s.owner, since.UnixNano())
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			t := Tombstone{Collection: s.collection}
+			var deletedAt int64
+			if err := rows.Scan(&t.ID, &deletedAt); err != nil {
+				return err
+			}
+			t.DeletedAt = unixNano(deletedAt)
+			tombstones = append(tombstones, t)
+		}
+		return rows.Err()
+	})
+	if err != nil {
+		return nil, err
+	}
+	return tombstones, nil
+}
+
+func (s *sqlStore[T, P]) PurgeTombstones(ctx context.Context, cutoff time.Time) error {
+	return s.inTx(ctx, nil, func(tx *sql.Tx) error {
+		_, err := tx.ExecContext(ctx, `DELETE FROM tombstones WHERE collection = ? AND owner = ? AND deleted_at < ?`,
+			s.collection, s.owner, cutoff.UnixNano())
+		return err
+	})
+}
+
+// sqliteReadBatch caps the sessions a List reads at once, keeping the bind
+// parameters of each query well inside SQLite's limit
+const sqliteReadBatch = MaxPageSize
+
+// readOnly marks transactions that only read
+var readOnly = &sql.TxOptions{ReadOnly: true}
+
+// inTx runs fn in the transaction the store belongs to, or else in a new
+// one that is committed if fn succeeds
+func (s *sqlStore[T, P]) inTx(ctx context.Context, opts *sql.TxOptions, fn func(tx *sql.Tx) error) error {
+	if s.tx != nil {
+		return fn(s.tx)
+	}
+	return sqliteTx(ctx, s.db, opts, fn)
+}
+
+// sqliteTx runs fn in a transaction, committed when fn returns nil
+func sqliteTx(ctx context.Context, db *sql.DB, opts *sql.TxOptions, fn func(tx *sql.Tx) error) error {
+	tx, err := db.BeginTx(ctx, opts)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = fn(tx)
+	if err == nil {
+		err = tx.Commit()
+	}
+	// database/sql rolls back a transaction whose context ends, so the next
+	// statement or the commit fails with ErrTxDone; report the cause instead
+	if ctxErr := ctx.Err(); ctxErr != nil && errors.Is(err, sql.ErrTxDone) {
+		return ctxErr
+	}
+	return err
+}
+
+// owns returns ErrNotFound unless the session exists and belongs to the store's owner
+func (s *sqlStore[T, P]) owns(ctx context.Context, tx *sql.Tx, id string) error {
+	var one int
+	err := tx.QueryRowContext(ctx, `SELECT 1 FROM `+s.table+` WHERE id = ? AND owner = ?`, id, s.owner).Scan(&one)
+	return noRowsAsNotFound(err)
+}
+
+// readOne reads the owner's session with the given ID, or returns ErrNotFound
+func (s *sqlStore[T, P]) readOne(ctx context.Context, tx *sql.Tx, id string) (T, error) {
+	var session T
+	sessions, err := s.read(ctx, tx, s.owner, []string{id})
+	if err != nil {
+		return session, err
+	}
+	if len(sessions) == 0 {
+		return session, ErrNotFound
+	}
+	return sessions[0], nil
+}
+
+// delete removes the owner's session row, its children cascading with it
+func (s *sqlStore[T, P]) delete(ctx context.Context, tx *sql.Tx, id string) error {
+	_, err := tx.ExecContext(ctx, `DELETE FROM `+s.table+` WHERE owner = ? AND id = ?`, s.owner, id)
+	return err
+}
+
+// sqliteIdempotency is an IdempotencyStore over the idempotency_keys table
+type sqliteIdempotency struct {
+	db *sql.DB
+}
+
+func (s *sqliteIdempotency) Reserve(ctx context.Context, rec IdempotencyRecord) (*IdempotencyRecord, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM idempotency_keys WHERE expires_at < ?`, rec.CreatedAt.UnixNano()); err != nil {
+		return nil, err
+	}
+
+	existing := IdempotencyRecord{Key: rec.Key}
+	var header string
+	var createdAt, expiresAt int64
+	err = tx.QueryRowContext(ctx, `SELECT fingerprint, completed, status, header, body, created_at, expires_at
+	FROM idempotency_keys WHERE key = ?`, rec.Key).Scan(
+		&existing.Fingerprint, &existing.Completed, &existing.Status, &header, &existing.Body, &createdAt, &expiresAt)
+	if err == nil {
+		if err := json.Unmarshal([]byte(header), &existing.Header); err != nil {
+			return nil, err
+		}
+		existing.CreatedAt, existing.ExpiresAt = unixNano(createdAt), unixNano(expiresAt)
+		return &existing, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+
+	if err := s.write(ctx, tx, rec); err != nil {
+		return nil, err
+	}
+	return nil, tx.Commit()
+}
+
+func (s *sqliteIdempotency) Complete(ctx context.Context, rec IdempotencyRecord) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := s.write(ctx, tx, rec); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *sqliteIdempotency) Release(ctx context.Context, key string) error {
+	_, err := s.db.ExecContext(ctx, `DELETE FROM idempotency_keys WHERE key = ?`, key)
+	return err
+}
+
+func (s *sqliteIdempotency) write(ctx context.Context, tx *sql.Tx, rec IdempotencyRecord) error {
+	header, err := json.Marshal(rec.Header)
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, `INSERT OR REPLACE INTO idempotency_keys
+		(key, fingerprint, completed, status, header, body, created_at, expires_at) VALUES (`+placeholders(8)+`)`,
+		rec.Key, rec.Fingerprint, rec.Completed, rec.Status, string(header), rec.Body, rec.CreatedAt.UnixNano(), rec.ExpiresAt.UnixNano())
+	return err
+}
+
+// sqliteUsers is a UserStore over the users and api_tokens tables
+type sqliteUsers struct {
+	db *sql.DB
+}
+
+func (u *sqliteUsers) CreateUser(ctx context.Context, name string) (User, error) {
+	user := User{ID: newDocumentID(), Name: name, CreatedAt: storeNow()}
+	_, err := u.db.ExecContext(ctx, `INSERT INTO users (id, name, created_at) VALUES (?, ?, ?)`,
+		user.ID, user.Name, user.CreatedAt.UnixNano())
+	return user, err
+}
+
+func (u *sqliteUsers) GetUser(ctx context.Context, id string) (User, error) {
+	user := User{ID: id}
+	var createdAt int64
+	err := u.db.QueryRowContext(ctx, `SELECT name, created_at FROM users WHERE id = ?`, id).Scan(&user.Name, &createdAt)
+	if err != nil {
+		return user, noRowsAsNotFound(err)
+	}
+	user.CreatedAt = unixNano(createdAt)
+	return user, nil
+}
+
+func (u *sqliteUsers) ListUsers(ctx context.Context) ([]User, error) {
+	rows, err := u.db.QueryContext(ctx, `SELECT id, name, created_at FROM users ORDER BY created_at`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var users []User
+	for rows.Next() {
+		var user User
+		var createdAt int64
+		if err := rows.Scan(&user.ID, &user.Name, &createdAt); err != nil {
+			return nil, err
+		}
+		user.CreatedAt = unixNano(createdAt)
+		users = append(users, user)
+	}
+	return users, rows.Err()
+}
+
+// apiTokenColumns are scanned by scanAPIToken
+const apiTokenColumns = `id, user_id, name, scopes, hash, created_at`
+
+// scanAPIToken scans a row selecting apiTokenColumns. Scopes are JSON text,
+// NULL for an unrestricted token.
+func scanAPIToken(row interface{ Scan(...interface{}) error }) (APIToken, error) {
+	var token APIToken
+	var scopes sql.NullString
+	var createdAt int64
+	if err := row.Scan(&token.ID, &token.UserID, &token.Name, &scopes, &token.Hash, &createdAt); err != nil {
+		return token, noRowsAsNotFound(err)
+	}
+	if scopes.Valid {
+		if err := json.Unmarshal([]byte(scopes.String), &token.Scopes); err != nil {
+			return token, err
+		}
+	}
+	token.CreatedAt = unixNano(createdAt)
+	return token, nil
+}
+
+func (u *sqliteUsers) CreateToken(ctx context.Context, token APIToken) (APIToken, error) {
+	token.ID = newDocumentID()
+	token.CreatedAt = storeNow()
+	var scopes sql.NullString
+	if token.Scopes != nil {
+		scopes = sql.NullString{String: jsonText(token.Scopes), Valid: true}
+	}
+	_, err := u.db.ExecContext(ctx, `INSERT INTO api_tokens (`+apiTokenColumns+`) VALUES (?, ?, ?, ?, ?, ?)`,
+		token.ID, token.UserID, token.Name, scopes, token.Hash, token.CreatedAt.UnixNano())
+	return token, err
+}
+
+func (u *sqliteUsers) GetToken(ctx context.Context, id string) (APIToken, error) {
+	return scanAPIToken(u.db.QueryRowContext(ctx, `SELECT `+apiTokenColumns+` FROM api_tokens WHERE id = ?`, id))
+}
+
+func (u *sqliteUsers) ListTokens(ctx context.Context, userID string) ([]APIToken, error) {
+	rows, err := u.db.QueryContext(ctx, `SELECT `+apiTokenColumns+` FROM api_tokens
+	WHERE user_id = ? ORDER BY created_at`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tokens []APIToken
+	for rows.Next() {
+		token, err := scanAPIToken(rows)
+		if err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, token)
+	}
+	return tokens, rows.Err()
+}
+
+func (u *sqliteUsers) RevokeToken(ctx context.Context, userID, id string) error {
+	res, err := u.db.ExecContext(ctx, `DELETE FROM api_tokens WHERE id = ? AND user_id = ?`, id, userID)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (u *sqliteUsers) TokenByHash(ctx context.Context, hash string) (APIToken, error) {
+	return scanAPIToken(u.db.QueryRowContext(ctx, `SELECT `+apiTokenColumns+` FROM api_tokens WHERE hash = ?`, hash))
+}
+
+// queryRows runs a query, calling scan on each row in turn
+func queryRows(ctx context.Context, tx *sql.Tx, query string, args []interface{}, scan func(*sql.Rows) error) error {
+	rows, err := tx.QueryContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		if err := scan(rows); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// queryStrings runs a query selecting a single text column
+func queryStrings(ctx context.Context, tx *sql.Tx, query string, args ...interface{}) ([]string, error) {
+	rows, err := tx.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var values []string
+	for rows.Next() {
+		var v string
+		if err := rows.Scan(&v); err != nil {
+			return nil, err
+		}
+		values = append(values, v)
+	}
+	return values, rows.Err()
+}
+
+// noRowsAsNotFound maps sql.ErrNoRows to ErrNotFound
+func noRowsAsNotFound(err error) error {
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrNotFound
+	}
+	return err
+}
+
+// placeholders returns n comma separated bind parameters
+func placeholders(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?, ", n), ", ")
+}
@@ -0,0 +1,450 @@
+package function
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+)
+
+// Row mappings between the session models and the SQLite schema in sqlite.go.
+// String lists are stored as JSON text; nested climbs, exercises, sets and
+// rounds live in child tables ordered by position. Sessions are read several
+// at a time, with one query per table however many sessions there are.
+
+func writeIndoorSession(ctx context.Context, tx *sql.Tx, owner string, s *IndoorSession) error {
+	_, err := tx.ExecContext(ctx, `INSERT INTO indoor_sessions (
+		owner, id, date, location, custom_location, climbing_type, training_types, difficulty,
+		categories, energy_systems, wall_angles, finger_load, shoulder_load, forearm_load,
+		open_grip, crimp_grip, pinch_grip, sloper_grip, jug_grip, notes, created_at, updated_at
+	) VALUES (`+placeholders(22)+`)`,
+		owner, s.ID, s.Date, s.Location, s.CustomLocation, s.ClimbingType, jsonText(s.TrainingTypes), s.Difficulty,
+		jsonText(s.Categories), jsonText(s.EnergySystems), jsonText(s.WallAngles), s.FingerLoad, s.ShoulderLoad, s.ForearmLoad,
+		s.OpenGrip, s.CrimpGrip, s.PinchGrip, s.SloperGrip, s.JugGrip, s.Notes, s.CreatedAt.UnixNano(), s.UpdatedAt.UnixNano())
+	if err != nil {
+		return err
+	}
+	return writeClimbs(ctx, tx, "indoor_climbs", owner, s.ID, s.Climbs)
+}
+
+func readIndoorSessions(ctx context.Context, tx *sql.Tx, owner string, ids []string) ([]IndoorSession, error) {
+	where, args := sessionsIn("id", owner, ids)
+	byID := make(map[string]*IndoorSession, len(ids))
+	err := queryRows(ctx, tx, `SELECT
+		id, date, location, custom_location, climbing_type, training_types, difficulty,
+		categories, energy_systems, wall_angles, finger_load, shoulder_load, forearm_load,
+		open_grip, crimp_grip, pinch_grip, sloper_grip, jug_grip, notes, created_at, updated_at
+	FROM indoor_sessions WHERE `+where, args, func(rows *sql.Rows) error {
+		s := IndoorSession{Climbs: []ClimbEntry{}}
+		var trainingTypes, categories, energySystems, wallAngles string
+		var createdAt, updatedAt int64
+		if err := rows.Scan(
+			&s.ID, &s.Date, &s.Location, &s.CustomLocation, &s.ClimbingType, &trainingTypes, &s.Difficulty,
+			&categories, &energySystems, &wallAngles, &s.FingerLoad, &s.ShoulderLoad, &s.ForearmLoad,
+			&s.OpenGrip, &s.CrimpGrip, &s.PinchGrip, &s.SloperGrip, &s.JugGrip, &s.Notes, &createdAt, &updatedAt); err != nil {
+			return err
+		}
+		if err := decodeStringLists(map[*[]string]string{
+			&s.TrainingTypes: trainingTypes,
+			&s.Categories:    categories,
+			&s.EnergySystems: energySystems,
+			&s.WallAngles:    wallAngles,
+		}); err != nil {
+			return err
+		}
+		s.CreatedAt, s.UpdatedAt = unixNano(createdAt), unixNano(updatedAt)
+		byID[s.ID] = &s
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = readClimbs(ctx, tx, "indoor_climbs", owner, ids, func(id string, c ClimbEntry) {
+		byID[id].Climbs = append(byID[id].Climbs, c)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return inOrder(ids, byID), nil
+}
+
+func writeOutdoorSession(ctx context.Context, tx *sql.Tx, owner string, s *OutdoorSession) error {
+	_, err := tx.ExecContext(ctx, `INSERT INTO outdoor_sessions (
+		owner, id, date, area, crag, sector, climbing_type, training_types, difficulty,
+		categories, energy_systems, finger_load, shoulder_load, forearm_load,
+		open_grip, crimp_grip, pinch_grip, sloper_grip, jug_grip, notes, created_at, updated_at
+	) VALUES (`+placeholders(22)+`)`,
+		owner, s.ID, s.Date, s.Area, s.Crag, s.Sector, s.ClimbingType, jsonText(s.TrainingTypes), s.Difficulty,
+		jsonText(s.Categories), jsonText(s.EnergySystems), s.FingerLoad, s.ShoulderLoad, s.ForearmLoad,
+		s.OpenGrip, s.CrimpGrip, s.PinchGrip, s.SloperGrip, s.JugGrip, s.Notes, s.CreatedAt.UnixNano(), s.UpdatedAt.UnixNano())
+	if err != nil {
+		return err
+	}
+	return writeClimbs(ctx, tx, "outdoor_climbs", owner, s.ID, s.Climbs)
+}
+
+func readOutdoorSessions(ctx context.Context, tx *sql.Tx, owner string, ids []string) ([]OutdoorSession, error) {
+	where, args := sessionsIn("id", owner, ids)
+	byID := make(map[string]*OutdoorSession, len(ids))
+	err := queryRows(ctx, tx, `SELECT
+		id, date, area, crag, sector, climbing_type, training_types, difficulty,
+		categories, energy_systems, finger_load, shoulder_load, forearm_load,
+		open_grip, crimp_grip, pinch_grip, sloper_grip, jug_grip, notes, created_at, updated_at
+	FROM outdoor_sessions WHERE `+where, args, func(rows *sql.Rows) error {
+		s := OutdoorSession{Climbs: []ClimbEntry{}}
+		var trainingTypes, categories, energySystems string
+		var createdAt, updatedAt int64
+		if err := rows.Scan(
+			&s.ID, &s.Date, &s.Area, &s.Crag, &s.Sector, &s.ClimbingType, &trainingTypes, &s.Difficulty,
+			&categories, &energySystems, &s.FingerLoad, &s.ShoulderLoad, &s.ForearmLoad,
+			&s.OpenGrip, &s.CrimpGrip, &s.PinchGrip, &s.SloperGrip, &s.JugGrip, &s.Notes, &createdAt, &updatedAt); err != nil {
+			return err
+		}
+		if err := decodeStringLists(map[*[]string]string{
+			&s.TrainingTypes: trainingTypes,
+			&s.Categories:    categories,
+			&s.EnergySystems: energySystems,
+		}); err != nil {
+			return err
+		}
+		s.CreatedAt, s.UpdatedAt = unixNano(createdAt), unixNano(updatedAt)
+		byID[s.ID] = &s
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = readClimbs(ctx, tx, "outdoor_climbs", owner, ids, func(id string, c ClimbEntry) {
+		byID[id].Climbs = append(byID[id].Climbs, c)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return inOrder(ids, byID), nil
+}
+
+// writeClimbs inserts the climbs of an indoor or outdoor session into table
+func writeClimbs(ctx context.Context, tx *sql.Tx, table, owner, sessionID string, climbs []ClimbEntry) error {
+	for i, c := range climbs {
+		_, err := tx.ExecContext(ctx, `INSERT INTO `+table+` (
+			owner, session_id, position, is_sport, name, grade, attempt_type, attempts_num, notes, wall, technique_focus
+		) VALUES (`+placeholders(11)+`)`,
+			owner, sessionID, i, c.IsSport, c.Name, c.Grade, c.AttemptType, c.AttemptsNum, c.Notes, c.Wall, c.TechniqueFocus)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readClimbs loads the climbs of the owner's indoor or outdoor sessions with
+// the given IDs from table, passing each to add in order
+func readClimbs(ctx context.Context, tx *sql.Tx, table, owner string, ids []string, add func(id string, c ClimbEntry)) error {
+	where, args := sessionsIn("session_id", owner, ids)
+	return queryRows(ctx, tx, `SELECT
+		session_id, is_sport, name, grade, attempt_type, attempts_num, notes, wall, technique_focus
+	FROM `+table+` WHERE `+where+` ORDER BY session_id, position`, args, func(rows *sql.Rows) error {
+		var id string
+		var c ClimbEntry
+		if err := rows.Scan(&id, &c.IsSport, &c.Name, &c.Grade, &c.AttemptType, &c.AttemptsNum, &c.Notes, &c.Wall, &c.TechniqueFocus); err != nil {
+			return err
+		}
+		add(id, c)
+		return nil
+	})
+}
+
+func writeFingerboardSession(ctx context.Context, tx *sql.Tx, owner string, s *FingerboardSession) error {
+	_, err := tx.ExecContext(ctx, `INSERT INTO fingerboard_sessions (owner, id, date, location, created_at, updated_at)
+	VALUES (`+placeholders(6)+`)`,
+		owner, s.ID, s.Date, s.Location, s.CreatedAt.UnixNano(), s.UpdatedAt.UnixNano())
+	if err != nil {
+		return err
+	}
+
+	for i, e := range s.Exercises {
+		_, err := tx.ExecContext(ctx, `INSERT INTO fingerboard_exercises (
+			owner, session_id, position, exercise_id, name, grip_type, sets, notes
+		) VALUES (`+placeholders(8)+`)`,
+			owner, s.ID, i, e.ID, e.Name, e.GripType, e.Sets, e.Notes)
+		if err != nil {
+			return err
+		}
+		for j, set := range e.Details {
+			_, err := tx.ExecContext(ctx, `INSERT INTO fingerboard_sets (
+				owner, session_id, exercise_position, position, weight, reps
+			) VALUES (`+placeholders(6)+`)`,
+				owner, s.ID, i, j, set.Weight, set.Reps)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func readFingerboardSessions(ctx context.Context, tx *sql.Tx, owner string, ids []string) ([]FingerboardSession, error) {
+	where, args := sessionsIn("id", owner, ids)
+	byID := make(map[string]*FingerboardSession, len(ids))
+	err := queryRows(ctx, tx, `SELECT id, date, location, created_at, updated_at
+	FROM fingerboard_sessions WHERE `+where, args, func(rows *sql.Rows) error {
+		s := FingerboardSession{Exercises: []FingerboardExercise{}}
+		var createdAt, updatedAt int64
+		if err := rows.Scan(&s.ID, &s.Date, &s.Location, &createdAt, &updatedAt); err != nil {
+			return err
+		}
+		s.CreatedAt, s.UpdatedAt = unixNano(createdAt), unixNano(updatedAt)
+		byID[s.ID] = &s
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	where, args = sessionsIn("session_id", owner, ids)
+	err = queryRows(ctx, tx, `SELECT session_id, exercise_id, name, grip_type, sets, notes
+	FROM fingerboard_exercises WHERE `+where+` ORDER BY session_id, position`, args, func(rows *sql.Rows) error {
+		var id string
+		e := FingerboardExercise{Details: []ExerciseSet{}}
+		if err := rows.Scan(&id, &e.ID, &e.Name, &e.GripType, &e.Sets, &e.Notes); err != nil {
+			return err
+		}
+		byID[id].Exercises = append(byID[id].Exercises, e)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = queryRows(ctx, tx, `SELECT session_id, exercise_position, weight, reps
+	FROM fingerboard_sets WHERE `+where+` ORDER BY session_id, exercise_position, position`, args, func(rows *sql.Rows) error {
+		var id string
+		var i int
+		var set ExerciseSet
+		if err := rows.Scan(&id, &i, &set.Weight, &set.Reps); err != nil {
+			return err
+		}
+		e := &byID[id].Exercises[i]
+		e.Details = append(e.Details, set)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return inOrder(ids, byID), nil
+}
+
+func writeCompetitionSession(ctx context.Context, tx *sql.Tx, owner string, s *CompetitionSession) error {
+	_, err := tx.ExecContext(ctx, `INSERT INTO competition_sessions (
+		owner, id, date, venue, custom_venue, type, finger_load, shoulder_load, forearm_load, notes, created_at, updated_at
+	) VALUES (`+placeholders(12)+`)`,
+		owner, s.ID, s.Date, s.Venue, s.CustomVenue, s.Type, s.FingerLoad, s.ShoulderLoad, s.ForearmLoad, s.Notes,
+		s.CreatedAt.UnixNano(), s.UpdatedAt.UnixNano())
+	if err != nil {
+		return err
+	}
+
+	for i, round := range s.Rounds {
+		_, err := tx.ExecContext(ctx, `INSERT INTO competition_rounds (owner, session_id, position, name, placing)
+		VALUES (`+placeholders(5)+`)`,
+			owner, s.ID, i, round.Name, round.Position)
+		if err != nil {
+			return err
+		}
+		for j, c := range round.Climbs {
+			_, err := tx.ExecContext(ctx, `INSERT INTO competition_climbs (
+				owner, session_id, round_position, position, name, status, attempt_count, notes
+			) VALUES (`+placeholders(8)+`)`,
+				owner, s.ID, i, j, c.Name, c.Status, c.AttemptCount, c.Notes)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func readCompetitionSessions(ctx context.Context, tx *sql.Tx, owner string, ids []string) ([]CompetitionSession, error) {
+	where, args := sessionsIn("id", owner, ids)
+	byID := make(map[string]*CompetitionSession, len(ids))
+	err := queryRows(ctx, tx, `SELECT
+		id, date, venue, custom_venue, type, finger_load, shoulder_load, forearm_load, notes, created_at, updated_at
+	FROM competition_sessions WHERE `+where, args, func(rows *sql.Rows) error {
+		s := CompetitionSession{Rounds: []CompetitionRound{}}
+		var createdAt, updatedAt int64
+		if err := rows.Scan(
+			&s.ID, &s.Date, &s.Venue, &s.CustomVenue, &s.Type, &s.FingerLoad, &s.ShoulderLoad, &s.ForearmLoad, &s.Notes,
+			&createdAt, &updatedAt); err != nil {
+			return err
+		}
+		s.CreatedAt, s.UpdatedAt = unixNano(createdAt), unixNano(updatedAt)
+		byID[s.ID] = &s
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	where, args = sessionsIn("session_id", owner, ids)
+	err = queryRows(ctx, tx, `SELECT session_id, name, placing
+	FROM competition_rounds WHERE `+where+` ORDER BY session_id, position`, args, func(rows *sql.Rows) error {
+		var id string
+		round := CompetitionRound{Climbs: []CompetitionClimbResult{}}
+		var placing sql.NullInt64
+		if err := rows.Scan(&id, &round.Name, &placing); err != nil {
+			return err
+		}
+		if placing.Valid {
+			p := int(placing.Int64)
+			round.Position = &p
+		}
+		byID[id].Rounds = append(byID[id].Rounds, round)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = queryRows(ctx, tx, `SELECT session_id, round_position, name, status, attempt_count, notes
+	FROM competition_climbs WHERE `+where+` ORDER BY session_id, round_position, position`, args, func(rows *sql.Rows) error {
+		var id string
+		var i int
+		var c CompetitionClimbResult
+		if err := rows.Scan(&id, &i, &c.Name, &c.Status, &c.AttemptCount, &c.Notes); err != nil {
+			return err
+		}
+		round := &byID[id].Rounds[i]
+		round.Climbs = append(round.Climbs, c)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return inOrder(ids, byID), nil
+}
+
+func writeGymSession(ctx context.Context, tx *sql.Tx, owner string, s *GymSession) error {
+	_, err := tx.ExecContext(ctx, `INSERT INTO gym_sessions (
+		owner, id, date, name, bodyweight, training_block, created_at, updated_at
+	) VALUES (`+placeholders(8)+`)`,
+		owner, s.ID, s.Date, s.Name, s.Bodyweight, s.TrainingBlock, s.CreatedAt.UnixNano(), s.UpdatedAt.UnixNano())
+	if err != nil {
+		return err
+	}
+
+	for i, e := range s.Exercises {
+		_, err := tx.ExecContext(ctx, `INSERT INTO gym_exercises (
+			owner, session_id, position, exercise_id, name, notes, linked_to, difficulty
+		) VALUES (`+placeholders(8)+`)`,
+			owner, s.ID, i, e.ID, e.Name, e.Notes, e.LinkedTo, e.Difficulty)
+		if err != nil {
+			return err
+		}
+		for j, set := range e.Sets {
+			_, err := tx.ExecContext(ctx, `INSERT INTO gym_sets (
+				owner, session_id, exercise_position, position, weight, reps, is_warmup, is_failure, is_drop_set, completed
+			) VALUES (`+placeholders(10)+`)`,
+				owner, s.ID, i, j, set.Weight, set.Reps, set.IsWarmup, set.IsFailure, set.IsDropSet, set.Completed)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func readGymSessions(ctx context.Context, tx *sql.Tx, owner string, ids []string) ([]GymSession, error) {
+	where, args := sessionsIn("id", owner, ids)
+	byID := make(map[string]*GymSession, len(ids))
+	err := queryRows(ctx, tx, `SELECT id, date, name, bodyweight, training_block, created_at, updated_at
+	FROM gym_sessions WHERE `+where, args, func(rows *sql.Rows) error {
+		s := GymSession{Exercises: []GymExercise{}}
+		var createdAt, updatedAt int64
+		if err := rows.Scan(&s.ID, &s.Date, &s.Name, &s.Bodyweight, &s.TrainingBlock, &createdAt, &updatedAt); err != nil {
+			return err
+		}
+		s.CreatedAt, s.UpdatedAt = unixNano(createdAt), unixNano(updatedAt)
+		byID[s.ID] = &s
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	where, args = sessionsIn("session_id", owner, ids)
+	err = queryRows(ctx, tx, `SELECT session_id, exercise_id, name, notes, linked_to, difficulty
+	FROM gym_exercises WHERE `+where+` ORDER BY session_id, position`, args, func(rows *sql.Rows) error {
+		var id string
+		e := GymExercise{Sets: []GymSet{}}
+		if err := rows.Scan(&id, &e.ID, &e.Name, &e.Notes, &e.LinkedTo, &e.Difficulty); err != nil {
+			return err
+		}
+		byID[id].Exercises = append(byID[id].Exercises, e)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = queryRows(ctx, tx, `SELECT session_id, exercise_position, weight, reps, is_warmup, is_failure, is_drop_set, completed
+	FROM gym_sets WHERE `+where+` ORDER BY session_id, exercise_position, position`, args, func(rows *sql.Rows) error {
+		var id string
+		var i int
+		var set GymSet
+		if err := rows.Scan(&id, &i, &set.Weight, &set.Reps, &set.IsWarmup, &set.IsFailure, &set.IsDropSet, &set.Completed); err != nil {
+			return err
+		}
+		e := &byID[id].Exercises[i]
+		e.Sets = append(e.Sets, set)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return inOrder(ids, byID), nil
+}
+
+// sessionsIn returns the condition selecting the owner's rows for the
+// sessions with the given IDs, held in column, and its arguments
+func sessionsIn(column, owner string, ids []string) (string, []interface{}) {
+	args := make([]interface{}, 0, len(ids)+1)
+	args = append(args, owner)
+	for _, id := range ids {
+		args = append(args, id)
+	}
+	return `owner = ? AND ` + column + ` IN (` + placeholders(len(ids)) + `)`, args
+}
+
+// inOrder returns the sessions of byID in the order of ids, leaving out IDs
+// that have none
+func inOrder[T any](ids []string, byID map[string]*T) []T {
+	sessions := make([]T, 0, len(byID))
+	for _, id := range ids {
+		if s, ok := byID[id]; ok {
+			sessions = append(sessions, *s)
+		}
+	}
+	return sessions
+}
+
+// jsonText encodes a string list column; nil is stored as "null" so it reads back as nil
+func jsonText(v []string) string {
+	data, _ := json.Marshal(v)
+	return string(data)
+}
+
+// decodeStringLists decodes string list columns written by jsonText into their destinations
+func decodeStringLists(columns map[*[]string]string) error {
+	for dst, text := range columns {
+		if err := json.Unmarshal([]byte(text), dst); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func unixNano(n int64) time.Time {
+	return time.Unix(0, n).UTC()
+}
@@ -0,0 +1,170 @@
+package function
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// ErrNotFound is returned by a SessionStore when the requested session does not exist
+var ErrNotFound = errors.New("session not found")
+
+// MaxSessionIDLength caps client-supplied session IDs
+const MaxSessionIDLength = 128
+
+// invalidSessionIDMessage explains a session ID rejected by ValidSessionID
+const invalidSessionIDMessage = "Session ID must be 1 to 128 letters, digits, '-' or '_', and not start and end with __"
+
+// ValidSessionID reports whether id may be used as a client-supplied session
+// ID: 1 to MaxSessionIDLength ASCII letters, digits, '-' or '_'. UUIDs and
+// Firestore auto-IDs both qualify. IDs matching __.*__ are reserved by
+// Firestore, as are . and .., which the allowed characters already exclude.
+func ValidSessionID(id string) bool {
+	if !validDocID(id) {
+		return false
+	}
+	for _, c := range id {
+		if !('a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' || c == '-' || c == '_') {
+			return false
+		}
+	}
+	return true
+}
+
+// validDocID reports whether an ID chosen outside this API, such as a token
+// subject, may name a Firestore document: 1 to MaxSessionIDLength bytes of
+// UTF-8 without '/', other than . and .., and not matching __.*__
+func validDocID(id string) bool {
+	if id == "" || len(id) > MaxSessionIDLength || !utf8.ValidString(id) {
+		return false
+	}
+	if id == "." || id == ".." || strings.Contains(id, "/") {
+		return false
+	}
+	return !(len(id) >= 4 && strings.HasPrefix(id, "__") && strings.HasSuffix(id, "__"))
+}
+
+// ListOptions holds the filters accepted by the List*Sessions endpoints
+type ListOptions struct {
+	StartDate string    // Inclusive lower bound on the session date (YYYY-MM-DD)
+	EndDate   string    // Inclusive upper bound on the session date (YYYY-MM-DD)
+	Since     time.Time // Incremental sync - only sessions updated strictly after this time
+	Limit     int       // Maximum number of sessions to return, 0 for no limit
+	After     *Cursor   // Resume after this session when paging
+}
+
+// SessionStore is the persistence layer behind the handlers for one session type.
+// Sessions are listed newest first: by updatedAt when Since is set, otherwise by
+// date, with ties broken by descending ID so that paging is stable.
+type SessionStore[T any] interface {
+	List(ctx context.Context, opts ListOptions) ([]T, error)
+	Get(ctx context.Context, id string) (T, error)
+	// Create assigns the ID and timestamps and returns the stored session
+	Create(ctx context.Context, session T) (T, error)
+	// Update loads the session, lets apply modify it, bumps updatedAt and writes it back
+	Update(ctx context.Context, id string, apply func(*T) error) (T, error)
+	// Put creates or replaces the session with a caller-chosen ID. apply is
+	// called with the stored session, or a zero one when exists is false, and
+	// may modify it or abort. Creating clears any tombstone left under the ID.
+	// The returned bool reports whether the session was created.
+	Put(ctx context.Context, id string, apply func(s *T, exists bool) error) (T, bool, error)
+	// Delete removes the session and records a Tombstone for since-sync. A
+	// non-nil check is called with the stored session first and aborts the
+	// delete if it returns an error.
+	Delete(ctx context.Context, id string, check func(*T) error) error
+	// Deleted returns the tombstones recorded strictly after since, oldest first
+	Deleted(ctx context.Context, since time.Time) ([]Tombstone, error)
+	// PurgeTombstones drops tombstones recorded before cutoff
+	PurgeTombstones(ctx context.Context, cutoff time.Time) error
+}
+
+// storeNow returns the time stores stamp on createdAt and updatedAt. Firestore
+// keeps microseconds, so every backend truncates to that precision and the
+// value returned from a write matches what a later read sees, keeping ETags stable.
+func storeNow() time.Time {
+	return time.Now().UTC().Truncate(time.Microsecond)
+}
+
+// Stores bundles the session stores for every collection served by WorkoutAPI
+type Stores struct {
+	Indoor      SessionStore[IndoorSession]
+	Outdoor     SessionStore[OutdoorSession]
+	Fingerboard SessionStore[FingerboardSession]
+	Competition SessionStore[CompetitionSession]
+	Gym         SessionStore[GymSession]
+
+	// runTx implements RunTransaction for the backend; nil for Stores that
+	// already belong to a transaction
+	runTx func(ctx context.Context, fn func(tx *Stores) error) error
+}
+
+// RunTransaction calls fn with Stores whose writes are applied atomically
+// across every collection: all of them when fn returns nil, none when it
+// returns an error, which RunTransaction returns. fn may be called more than
+// once if the transaction is retried, so it must not keep state from an
+// earlier call. Only Get, Create, Update, Put and Delete are supported on the
+// transaction's stores. Called on a transaction's Stores, fn joins that
+// transaction.
+func (s *Stores) RunTransaction(ctx context.Context, fn func(tx *Stores) error) error {
+	if s.runTx == nil {
+		return fn(s)
+	}
+	return s.runTx(ctx, fn)
+}
+
+// errNotInTransaction is returned by store operations a transaction does not support
+var errNotInTransaction = errors.New("operation is not supported in a transaction")
+
+// record is implemented by the pointer type of every session model so that
+// stores can manage IDs and timestamps without knowing the concrete type
+type record interface {
+	getID() string
+	setID(id string)
+	getDate() string
+	getUpdatedAt() time.Time
+	setCreatedAt(t time.Time)
+	setUpdatedAt(t time.Time)
+}
+
+// recordPtr constrains a type parameter to *T where *T implements record
+type recordPtr[T any] interface {
+	*T
+	record
+}
+
+func (s *IndoorSession) getID() string            { return s.ID }
+func (s *IndoorSession) setID(id string)          { s.ID = id }
+func (s *IndoorSession) getDate() string          { return s.Date }
+func (s *IndoorSession) getUpdatedAt() time.Time  { return s.UpdatedAt }
+func (s *IndoorSession) setCreatedAt(t time.Time) { s.CreatedAt = t }
+func (s *IndoorSession) setUpdatedAt(t time.Time) { s.UpdatedAt = t }
+
+func (s *OutdoorSession) getID() string            { return s.ID }
+func (s *OutdoorSession) setID(id string)          { s.ID = id }
+func (s *OutdoorSession) getDate() string          { return s.Date }
+func (s *OutdoorSession) getUpdatedAt() time.Time  { return s.UpdatedAt }
+func (s *OutdoorSession) setCreatedAt(t time.Time) { s.CreatedAt = t }
+func (s *OutdoorSession) setUpdatedAt(t time.Time) { s.UpdatedAt = t }
+
+func (s *FingerboardSession) getID() string            { return s.ID }
+func (s *FingerboardSession) setID(id string)          { s.ID = id }
+func (s *FingerboardSession) getDate() string          { return s.Date }
+func (s *FingerboardSession) getUpdatedAt() time.Time  { return s.UpdatedAt }
+func (s *FingerboardSession) setCreatedAt(t time.Time) { s.CreatedAt = t }
+func (s *FingerboardSession) setUpdatedAt(t time.Time) { s.UpdatedAt = t }
+
+func (s *CompetitionSession) getID() string            { return s.ID }
+func (s *CompetitionSession) setID(id string)          { s.ID = id }
+func (s *CompetitionSession) getDate() string          { return s.Date }
+func (s *CompetitionSession) getUpdatedAt() time.Time  { return s.UpdatedAt }
+func (s *CompetitionSession) setCreatedAt(t time.Time) { s.CreatedAt = t }
+func (s *CompetitionSession) setUpdatedAt(t time.Time) { s.UpdatedAt = t }
+
+func (s *GymSession) getID() string            { return s.ID }
+func (s *GymSession) setID(id string)          { s.ID = id }
+func (s *GymSession) getDate() string          { return s.Date }
+func (s *GymSession) getUpdatedAt() time.Time  { return s.UpdatedAt }
+func (s *GymSession) setCreatedAt(t time.Time) { s.CreatedAt = t }
+func (s *GymSession) setUpdatedAt(t time.Time) { s.UpdatedAt = t }
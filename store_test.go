@@ -0,0 +1,655 @@
+package function
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/firestore"
+)
+
+func memoryStores(t *testing.T) *Stores {
+	return NewMemoryStores()
+}
+
+func sqliteStores(t *testing.T) *Stores {
+	return NewSQLiteStores(openTestSQLite(t))
+}
+
+// openTestSQLite opens a fresh SQLite database that is closed when the test ends
+func openTestSQLite(t *testing.T) *sql.DB {
+	t.Helper()
+	db, err := OpenSQLite(context.Background(), filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+// firestoreTestProject is the project ID used against the emulator
+const firestoreTestProject = "workout-api-test"
+
+// firestoreTestClient connects to the Firestore emulator with an empty
+// database. Tests using it are skipped unless FIRESTORE_EMULATOR_HOST is set.
+func firestoreTestClient(t *testing.T) *firestore.Client {
+	t.Helper()
+	host := os.Getenv("FIRESTORE_EMULATOR_HOST")
+	if host == "" {
+		t.Skip("FIRESTORE_EMULATOR_HOST is not set")
+	}
+
+	url := fmt.Sprintf("http://%s/emulator/v1/projects/%s/databases/%s/documents", host, firestoreTestProject, DatabaseID)
+	req, err := http.NewRequest("DELETE", url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("clearing the Firestore emulator: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("clearing the Firestore emulator: status %d", resp.StatusCode)
+	}
+
+	client, err := firestore.NewClientWithDatabase(context.Background(), firestoreTestProject, DatabaseID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { client.Close() })
+	return client
+}
+
+func firestoreStores(t *testing.T) *Stores {
+	return NewFirestoreStores(firestoreTestClient(t))
+}
+
+// storeBackends returns testBackends plus Firestore, which runs only
+// against the emulator
+func storeBackends() map[string]func(*testing.T) Backend {
+	backends := testBackends()
+	backends["firestore"] = func(t *testing.T) Backend { return NewFirestoreBackend(firestoreTestClient(t)) }
+	return backends
+}
+
+func TestMemoryStore(t *testing.T) {
+	testAllStores(t, memoryStores)
+}
+
+func TestSQLiteStore(t *testing.T) {
+	testAllStores(t, sqliteStores)
+}
+
+func TestFirestoreStore(t *testing.T) {
+	firestoreTestClient(t) // Skip the whole suite without the emulator
+	testAllStores(t, firestoreStores)
+}
+
+// testAllStores runs the store suite against every collection of newStores
+func testAllStores(t *testing.T, newStores func(t *testing.T) *Stores) {
+	t.Run("indoor", func(t *testing.T) {
+		runStoreTests(t, func() SessionStore[IndoorSession] { return newStores(t).Indoor })
+	})
+	t.Run("outdoor", func(t *testing.T) {
+		runStoreTests(t, func() SessionStore[OutdoorSession] { return newStores(t).Outdoor })
+	})
+	t.Run("fingerboard", func(t *testing.T) {
+		runStoreTests(t, func() SessionStore[FingerboardSession] { return newStores(t).Fingerboard })
+	})
+	t.Run("competition", func(t *testing.T) {
+		runStoreTests(t, func() SessionStore[CompetitionSession] { return newStores(t).Competition })
+	})
+	t.Run("gym", func(t *testing.T) {
+		runStoreTests(t, func() SessionStore[GymSession] { return newStores(t).Gym })
+	})
+}
+
+// newTestSession returns a session of type T decoded from JSON
+func newTestSession[T any](t *testing.T, body string) T {
+	t.Helper()
+	var s T
+	if err := json.Unmarshal([]byte(body), &s); err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+// create stores a session dated date and returns it
+func create[T any](t *testing.T, store SessionStore[T], date string) T {
+	t.Helper()
+	s, err := store.Create(context.Background(), newTestSession[T](t, `{"date":"`+date+`"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+// ids returns the IDs of sessions in order
+func ids[T any, P recordPtr[T]](sessions []T) string {
+	var out []string
+	for i := range sessions {
+		out = append(out, P(&sessions[i]).getID())
+	}
+	return strings.Join(out, ",")
+}
+
+// runStoreTests checks the SessionStore contract. newStore must return an
+// empty store each time it is called.
+func runStoreTests[T any, P recordPtr[T]](t *testing.T, newStore func() SessionStore[T]) {
+	ctx := context.Background()
+
+	t.Run("CreateGet", func(t *testing.T) {
+		store := newStore()
+		created := create(t, store, "2024-05-01")
+		c := P(&created)
+		if !ValidSessionID(c.getID()) {
+			t.Fatalf("Create assigned invalid ID %q", c.getID())
+		}
+		if c.getUpdatedAt().IsZero() {
+			t.Error("Create did not set updatedAt")
+		}
+
+		got, err := store.Get(ctx, c.getID())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if g := P(&got); g.getDate() != "2024-05-01" || !g.getUpdatedAt().Equal(c.getUpdatedAt()) {
+			t.Errorf("Get = %+v, want %+v", got, created)
+		}
+
+		if _, err := store.Get(ctx, "missing"); !errors.Is(err, ErrNotFound) {
+			t.Errorf("Get missing: got %v, want ErrNotFound", err)
+		}
+	})
+
+	t.Run("List", func(t *testing.T) {
+		store := newStore()
+		if got, err := store.List(ctx, ListOptions{}); err != nil || len(got) != 0 {
+			t.Fatalf("List empty store = %v, %v", got, err)
+		}
+
+		a := create(t, store, "2024-05-01")
+		b := create(t, store, "2024-05-03")
+		c := create(t, store, "2024-05-02")
+		got, err := store.List(ctx, ListOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := ids[T, P]([]T{b, c, a})
+		if ids[T, P](got) != want {
+			t.Errorf("List order = %s, want %s", ids[T, P](got), want)
+		}
+	})
+
+	t.Run("DateFilters", func(t *testing.T) {
+		store := newStore()
+		create(t, store, "2024-04-30")
+		in1 := create(t, store, "2024-05-01")
+		in2 := create(t, store, "2024-05-31")
+		create(t, store, "2024-06-01")
+
+		got, err := store.List(ctx, ListOptions{StartDate: "2024-05-01", EndDate: "2024-05-31"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := ids[T, P]([]T{in2, in1}); ids[T, P](got) != want {
+			t.Errorf("List between dates = %s, want %s", ids[T, P](got), want)
+		}
+
+		got, err = store.List(ctx, ListOptions{StartDate: "2024-06-01"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(got) != 1 {
+			t.Errorf("List from 2024-06-01 returned %d sessions, want 1", len(got))
+		}
+	})
+
+	t.Run("Since", func(t *testing.T) {
+		store := newStore()
+		old := create(t, store, "2024-05-01")
+		checkpoint := P(&old).getUpdatedAt()
+		time.Sleep(time.Millisecond)
+
+		fresh := create(t, store, "2024-01-01")
+		time.Sleep(time.Millisecond)
+		touched, err := store.Update(ctx, P(&old).getID(), func(*T) error { return nil })
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		got, err := store.List(ctx, ListOptions{Since: checkpoint})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := ids[T, P]([]T{touched, fresh}); ids[T, P](got) != want {
+			t.Errorf("List since = %s, want %s by updatedAt", ids[T, P](got), want)
+		}
+
+		got, err = store.List(ctx, ListOptions{Since: P(&touched).getUpdatedAt()})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(got) != 0 {
+			t.Errorf("List since latest update returned %s, want nothing", ids[T, P](got))
+		}
+	})
+
+	t.Run("Cursor", func(t *testing.T) {
+		store := newStore()
+		for _, date := range []string{"2024-05-01", "2024-05-02", "2024-05-02", "2024-05-03", "2024-05-04"} {
+			create(t, store, date)
+		}
+		all, err := store.List(ctx, ListOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var paged []T
+		opts := ListOptions{Limit: 2}
+		for page := 0; ; page++ {
+			if page > len(all) {
+				t.Fatal("paging did not terminate")
+			}
+			got, err := store.List(ctx, opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			paged = append(paged, got...)
+			if len(got) < opts.Limit {
+				break
+			}
+			last := P(&got[len(got)-1])
+			opts.After = &Cursor{Date: last.getDate(), ID: last.getID()}
+		}
+		if ids[T, P](paged) != ids[T, P](all) {
+			t.Errorf("paged = %s, want %s", ids[T, P](paged), ids[T, P](all))
+		}
+	})
+
+	t.Run("SinceCursor", func(t *testing.T) {
+		store := newStore()
+		for i := 0; i < 4; i++ {
+			create(t, store, "2024-05-01")
+			time.Sleep(time.Millisecond)
+		}
+		opts := ListOptions{Since: time.Unix(1, 0)}
+		all, err := store.List(ctx, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		opts.Limit = 3
+		first, err := store.List(ctx, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		last := P(&first[len(first)-1])
+		opts.After = &Cursor{UpdatedAt: last.getUpdatedAt(), ID: last.getID()}
+		rest, err := store.List(ctx, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := ids[T, P](append(first, rest...)); got != ids[T, P](all) {
+			t.Errorf("paged since = %s, want %s", got, ids[T, P](all))
+		}
+	})
+
+	t.Run("Update", func(t *testing.T) {
+		store := newStore()
+		created := create(t, store, "2024-05-01")
+		id := P(&created).getID()
+		time.Sleep(time.Millisecond)
+
+		updated, err := store.Update(ctx, id, func(s *T) error {
+			*s = newTestSession[T](t, `{"date":"2024-06-01"}`)
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		u := P(&updated)
+		if u.getID() != id || u.getDate() != "2024-06-01" {
+			t.Errorf("Update = %+v, want ID %s dated 2024-06-01", updated, id)
+		}
+		if !u.getUpdatedAt().After(P(&created).getUpdatedAt()) {
+			t.Error("Update did not bump updatedAt")
+		}
+
+		got, _ := store.Get(ctx, id)
+		if P(&got).getDate() != "2024-06-01" {
+			t.Errorf("Get after Update has date %s", P(&got).getDate())
+		}
+
+		abort := errors.New("abort")
+		if _, err := store.Update(ctx, id, func(s *T) error {
+			*s = newTestSession[T](t, `{"date":"2024-07-01"}`)
+			return abort
+		}); !errors.Is(err, abort) {
+			t.Errorf("Update with failing apply: got %v, want %v", err, abort)
+		}
+		if got, _ := store.Get(ctx, id); P(&got).getDate() != "2024-06-01" {
+			t.Error("aborted Update was written")
+		}
+
+		if _, err := store.Update(ctx, "missing", func(*T) error { return nil }); !errors.Is(err, ErrNotFound) {
+			t.Errorf("Update missing: got %v, want ErrNotFound", err)
+		}
+	})
+
+	t.Run("Put", func(t *testing.T) {
+		store := newStore()
+		created, isNew, err := store.Put(ctx, "client-id", func(s *T, exists bool) error {
+			if exists {
+				t.Error("Put reported an existing session in an empty store")
+			}
+			*s = newTestSession[T](t, `{"date":"2024-05-01"}`)
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !isNew || P(&created).getID() != "client-id" {
+			t.Errorf("Put create = %+v, created %v", created, isNew)
+		}
+		time.Sleep(time.Millisecond)
+
+		replaced, isNew, err := store.Put(ctx, "client-id", func(s *T, exists bool) error {
+			if !exists || P(s).getDate() != "2024-05-01" {
+				t.Errorf("Put replace saw %+v, exists %v", *s, exists)
+			}
+			*s = newTestSession[T](t, `{"date":"2024-05-02"}`)
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if isNew || P(&replaced).getDate() != "2024-05-02" {
+			t.Errorf("Put replace = %+v, created %v", replaced, isNew)
+		}
+		if !P(&replaced).getUpdatedAt().After(P(&created).getUpdatedAt()) {
+			t.Error("Put replace did not bump updatedAt")
+		}
+		if got, err := store.List(ctx, ListOptions{}); err != nil || len(got) != 1 {
+			t.Errorf("List after Put = %d sessions, %v; want 1", len(got), err)
+		}
+
+		abort := errors.New("abort")
+		if _, _, err := store.Put(ctx, "other-id", func(*T, bool) error { return abort }); !errors.Is(err, abort) {
+			t.Errorf("Put with failing apply: got %v, want %v", err, abort)
+		}
+		if _, err := store.Get(ctx, "other-id"); !errors.Is(err, ErrNotFound) {
+			t.Errorf("aborted Put was written: %v", err)
+		}
+	})
+
+	t.Run("Delete", func(t *testing.T) {
+		store := newStore()
+		keep := create(t, store, "2024-05-01")
+		gone := create(t, store, "2024-05-02")
+		id := P(&gone).getID()
+		before := storeNow().Add(-time.Millisecond)
+
+		abort := errors.New("abort")
+		if err := store.Delete(ctx, id, func(*T) error { return abort }); !errors.Is(err, abort) {
+			t.Errorf("Delete with failing check: got %v, want %v", err, abort)
+		}
+		if _, err := store.Get(ctx, id); err != nil {
+			t.Fatalf("aborted Delete removed the session: %v", err)
+		}
+
+		if err := store.Delete(ctx, id, nil); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := store.Get(ctx, id); !errors.Is(err, ErrNotFound) {
+			t.Errorf("Get after Delete: got %v, want ErrNotFound", err)
+		}
+		if err := store.Delete(ctx, id, nil); !errors.Is(err, ErrNotFound) {
+			t.Errorf("second Delete: got %v, want ErrNotFound", err)
+		}
+		if got, _ := store.List(ctx, ListOptions{}); ids[T, P](got) != P(&keep).getID() {
+			t.Errorf("List after Delete = %s", ids[T, P](got))
+		}
+
+		tombstones, err := store.Deleted(ctx, before)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(tombstones) != 1 || tombstones[0].ID != id {
+			t.Fatalf("Deleted = %+v, want a tombstone for %s", tombstones, id)
+		}
+		if d := tombstones[0].DeletedAt; d.Before(before) || d.Location() != time.UTC || d.Nanosecond()%1000 != 0 {
+			t.Errorf("tombstone DeletedAt = %v, want a UTC microsecond store timestamp after %v", d, before)
+		}
+		if later, _ := store.Deleted(ctx, tombstones[0].DeletedAt); len(later) != 0 {
+			t.Errorf("Deleted since the tombstone = %+v, want none", later)
+		}
+
+		// Recreating the ID clears its tombstone
+		if _, _, err := store.Put(ctx, id, func(*T, bool) error { return nil }); err != nil {
+			t.Fatal(err)
+		}
+		if tombstones, _ := store.Deleted(ctx, before); len(tombstones) != 0 {
+			t.Errorf("Deleted after Put recreated the session = %+v", tombstones)
+		}
+
+		if err := store.Delete(ctx, id, nil); err != nil {
+			t.Fatal(err)
+		}
+		if err := store.PurgeTombstones(ctx, storeNow().Add(time.Second)); err != nil {
+			t.Fatal(err)
+		}
+		if tombstones, _ := store.Deleted(ctx, before); len(tombstones) != 0 {
+			t.Errorf("Deleted after PurgeTombstones = %+v", tombstones)
+		}
+	})
+}
+
+func TestMemoryBackendOwnerIsolation(t *testing.T) {
+	testOwnerIsolation(t, NewMemoryBackend())
+}
+
+func TestSQLiteBackendOwnerIsolation(t *testing.T) {
+	testOwnerIsolation(t, NewSQLiteBackend(openTestSQLite(t)))
+}
+
+// TestOpenSQLitePath checks that a path with URI delimiters in it opens the
+// file it names, with the connection pragmas applied
+func TestOpenSQLitePath(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "work?outs#1 100%.db")
+	db, err := OpenSQLite(context.Background(), path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	var foreignKeys int
+	var journalMode string
+	if err := db.QueryRow(`PRAGMA foreign_keys`).Scan(&foreignKeys); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.QueryRow(`PRAGMA journal_mode`).Scan(&journalMode); err != nil {
+		t.Fatal(err)
+	}
+	if foreignKeys != 1 || journalMode != "wal" {
+		t.Errorf("foreign_keys = %d, journal_mode = %q; want 1, wal", foreignKeys, journalMode)
+	}
+	if _, err := os.Stat(path); err != nil {
+		t.Errorf("database not created at %q: %v", path, err)
+	}
+}
+
+func TestFirestoreBackendOwnerIsolation(t *testing.T) {
+	testOwnerIsolation(t, NewFirestoreBackend(firestoreTestClient(t)))
+}
+
+// testOwnerIsolation checks that one user's sessions are invisible to another
+func testOwnerIsolation(t *testing.T, backend Backend) {
+	ctx := context.Background()
+	alice, bob := backend.Stores("alice").Indoor, backend.Stores("bob").Indoor
+
+	session := create(t, alice, "2024-05-01")
+	id := session.ID
+	deleted := create(t, alice, "2024-05-02")
+	if err := alice.Delete(ctx, deleted.ID, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, err := bob.List(ctx, ListOptions{}); err != nil || len(got) != 0 {
+		t.Errorf("bob List = %v, %v; want nothing", got, err)
+	}
+	if got, err := bob.List(ctx, ListOptions{Since: time.Unix(1, 0)}); err != nil || len(got) != 0 {
+		t.Errorf("bob List since = %v, %v; want nothing", got, err)
+	}
+	if _, err := bob.Get(ctx, id); !errors.Is(err, ErrNotFound) {
+		t.Errorf("bob Get: got %v, want ErrNotFound", err)
+	}
+	if _, err := bob.Update(ctx, id, func(s *IndoorSession) error { s.Notes = "bob"; return nil }); !errors.Is(err, ErrNotFound) {
+		t.Errorf("bob Update: got %v, want ErrNotFound", err)
+	}
+	if err := bob.Delete(ctx, id, nil); !errors.Is(err, ErrNotFound) {
+		t.Errorf("bob Delete: got %v, want ErrNotFound", err)
+	}
+	if tombstones, err := bob.Deleted(ctx, time.Time{}); err != nil || len(tombstones) != 0 {
+		t.Errorf("bob Deleted = %v, %v; want nothing", tombstones, err)
+	}
+
+	// IDs are kept per user, so bob may use the ID of alice's session for his own
+	_, created, err := bob.Put(ctx, id, func(s *IndoorSession, exists bool) error {
+		if exists {
+			t.Error("bob Put saw alice's session")
+		}
+		s.Notes = "bob"
+		return nil
+	})
+	if err != nil || !created {
+		t.Errorf("bob Put = %v, %v; want a new session", created, err)
+	}
+	if got, err := bob.Get(ctx, id); err != nil || got.Notes != "bob" {
+		t.Errorf("bob Get after Put = %+v, %v; want his own session", got, err)
+	}
+
+	got, err := alice.Get(ctx, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Notes != "" {
+		t.Errorf("alice's session was modified by bob: %+v", got)
+	}
+	aliceTombstones, err := alice.Deleted(ctx, time.Time{})
+	if err != nil || len(aliceTombstones) != 1 {
+		t.Fatalf("alice Deleted = %+v, %v; want one tombstone", aliceTombstones, err)
+	}
+
+	// The ID of alice's deleted session is free again. Bob reusing and
+	// deleting it, then purging his tombstones, leaves alice's tombstone alone.
+	if _, _, err := bob.Put(ctx, deleted.ID, func(s *IndoorSession, exists bool) error { return nil }); err != nil {
+		t.Fatalf("bob Put with a deleted ID: %v", err)
+	}
+	if err := bob.Delete(ctx, deleted.ID, nil); err != nil {
+		t.Fatal(err)
+	}
+	if tombstones, err := bob.Deleted(ctx, time.Time{}); err != nil || len(tombstones) != 1 || tombstones[0].ID != deleted.ID {
+		t.Errorf("bob Deleted = %+v, %v; want his own tombstone", tombstones, err)
+	}
+	if tombstones, err := alice.Deleted(ctx, time.Time{}); err != nil || len(tombstones) != 1 || !tombstones[0].DeletedAt.Equal(aliceTombstones[0].DeletedAt) {
+		t.Errorf("alice Deleted after bob's delete = %+v, %v; want %+v", tombstones, err, aliceTombstones)
+	}
+	if err := bob.PurgeTombstones(ctx, time.Now().Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if tombstones, err := bob.Deleted(ctx, time.Time{}); err != nil || len(tombstones) != 0 {
+		t.Errorf("bob Deleted after purging = %+v, %v; want nothing", tombstones, err)
+	}
+	if tombstones, err := alice.Deleted(ctx, time.Time{}); err != nil || len(tombstones) != 1 {
+		t.Errorf("alice Deleted after bob purged = %+v, %v; want her tombstone", tombstones, err)
+	}
+}
+
+func TestStoreEmptyListsReadBackEmpty(t *testing.T) {
+	for name, newStores := range map[string]func(*testing.T) *Stores{"memory": memoryStores, "sqlite": sqliteStores, "firestore": firestoreStores} {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			stores := newStores(t)
+
+			indoor, err := stores.Indoor.Create(ctx, IndoorSession{Date: "2024-05-01", TrainingTypes: []string{}, Climbs: []ClimbEntry{}})
+			if err != nil {
+				t.Fatal(err)
+			}
+			fingerboard, err := stores.Fingerboard.Create(ctx, FingerboardSession{Date: "2024-05-01",
+				Exercises: []FingerboardExercise{{Name: "Hangs", Details: []ExerciseSet{}}}})
+			if err != nil {
+				t.Fatal(err)
+			}
+			competition, err := stores.Competition.Create(ctx, CompetitionSession{Date: "2024-05-01", Rounds: []CompetitionRound{}})
+			if err != nil {
+				t.Fatal(err)
+			}
+			gym, err := stores.Gym.Create(ctx, GymSession{Date: "2024-05-01",
+				Exercises: []GymExercise{{Name: "Rows", Sets: []GymSet{}}}})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			checks := []struct {
+				get  func() (interface{}, error)
+				want []string
+			}{
+				{func() (interface{}, error) { return stores.Indoor.Get(ctx, indoor.ID) }, []string{`"trainingTypes":[]`, `"climbs":[]`}},
+				{func() (interface{}, error) { return stores.Fingerboard.Get(ctx, fingerboard.ID) }, []string{`"details":[]`}},
+				{func() (interface{}, error) { return stores.Competition.Get(ctx, competition.ID) }, []string{`"rounds":[]`}},
+				{func() (interface{}, error) { return stores.Gym.Get(ctx, gym.ID) }, []string{`"sets":[]`}},
+			}
+			for _, c := range checks {
+				got, err := c.get()
+				if err != nil {
+					t.Fatal(err)
+				}
+				data, _ := json.Marshal(got)
+				for _, want := range c.want {
+					if !strings.Contains(string(data), want) {
+						t.Errorf("%s does not contain %s", data, want)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestValidSessionID(t *testing.T) {
+	tests := map[string]bool{
+		"5f0c7a9e-2b1d-4c3e-9f8a-1b2c3d4e5f60": true,
+		"Xy7pQ2aB9cD4eF6gH8iJ":                 true,
+		"__x":                                  true,
+		"x__":                                  true,
+		"___":                                  true,
+		"":                                     false,
+		strings.Repeat("a", MaxSessionIDLength+1): false,
+		"__reserved__": false,
+		"____":         false,
+		".":            false,
+		"..":           false,
+		"a/b":          false,
+		"café":         false,
+	}
+	for id, want := range tests {
+		if got := ValidSessionID(id); got != want {
+			t.Errorf("ValidSessionID(%q) = %v, want %v", id, got, want)
+		}
+	}
+
+	useMemoryBackend(t)
+	w := request(t, NewHandler(NewMemoryBackend()), "PUT", "/indoor_sessions/__reserved__", `{"date":"2024-05-01"}`)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("PUT with a reserved ID: got %d %s, want 400", w.Code, w.Body.String())
+	}
+}
@@ -0,0 +1,235 @@
+package function
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+)
+
+// SyncOverlap is subtracted from the server clock when issuing a checkpoint.
+// updatedAt is stamped before a write commits, and instances' clocks may
+// drift slightly, so a change can land with a timestamp just before the
+// moment it became visible. Re-reading a short window means such changes are
+// delivered on the next sync; clients must treat upserts as idempotent.
+const SyncOverlap = 5 * time.Second
+
+// SyncPageSize caps the upserts returned for each collection by one /sync
+// request. A collection with more carries a nextCursor to fetch the rest.
+const SyncPageSize = MaxPageSize
+
+// SyncChanges holds the changes to one collection since a checkpoint
+type SyncChanges[T any] struct {
+	Upserts    []T         `json:"upserts"`
+	Deleted    []Tombstone `json:"deleted"`
+	NextCursor string      `json:"nextCursor,omitempty"`
+}
+
+// SyncResponse is returned by GET /sync, grouped by resource
+type SyncResponse struct {
+	// Checkpoint is the server-issued value to send as since on the next sync
+	Checkpoint          time.Time                       `json:"checkpoint"`
+	IndoorSessions      SyncChanges[IndoorSession]      `json:"indoor_sessions"`
+	OutdoorSessions     SyncChanges[OutdoorSession]     `json:"outdoor_sessions"`
+	FingerboardSessions SyncChanges[FingerboardSession] `json:"fingerboard_sessions"`
+	CompetitionSessions SyncChanges[CompetitionSession] `json:"competition_sessions"`
+	GymSessions         SyncChanges[GymSession]         `json:"gym_sessions"`
+}
+
+// syncCursor continues one collection's changes on the next page. It keeps
+// the checkpoint issued with the first page: a session changed while the
+// client pages moves ahead of the cursor, so only that checkpoint is early
+// enough to deliver it on the next sync.
+type syncCursor struct {
+	Cursor
+	Checkpoint time.Time `json:"c"`
+}
+
+func (c syncCursor) encode() string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeSyncCursor(s string) (*syncCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	var c syncCursor
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, err
+	}
+	if c.ID == "" || c.Checkpoint.IsZero() {
+		return nil, errors.New("cursor is incomplete")
+	}
+	return &c, nil
+}
+
+// HandleSync returns every change across all five collections since the
+// given checkpoint. The since parameter applies to all collections and can be
+// overridden per collection with a parameter named after the resource, e.g.
+// /sync?since=...&gym_sessions=.... Without a checkpoint a collection is
+// returned in full.
+//
+// Each collection returns at most SyncPageSize upserts. The rest are fetched
+// by repeating the request with each nextCursor as a parameter named after
+// its resource plus _cursor, e.g. gym_sessions_cursor=...; collections
+// without a cursor are left out of such a request. Deletions come with the
+// first page, and every page returns the first page's checkpoint.
+func HandleSync(w http.ResponseWriter, r *http.Request, stores *Stores) {
+	ctx, span := startHandlerSpan(r, "HandleSync", "")
+	defer span.End()
+
+	cursors := map[string]*syncCursor{}
+	for _, resource := range Resources {
+		param := resource + "_cursor"
+		if value := r.URL.Query().Get(param); value != "" {
+			cursor, err := decodeSyncCursor(value)
+			if err != nil {
+				writeSyncError(w, r, resource, &syncParamError{param: param, want: "a nextCursor returned by /sync"})
+				return
+			}
+			cursors[resource] = cursor
+		}
+	}
+
+	// Issue the checkpoint before reading so nothing written during the sync
+	// is skipped, or carry over the one issued with the first page
+	checkpoint := time.Now().UTC().Add(-SyncOverlap)
+	if len(cursors) > 0 {
+		checkpoint = time.Time{}
+		for _, cursor := range cursors {
+			if checkpoint.IsZero() || cursor.Checkpoint.Before(checkpoint) {
+				checkpoint = cursor.Checkpoint
+			}
+		}
+	}
+
+	resp := SyncResponse{Checkpoint: checkpoint}
+	var err error
+	if resp.IndoorSessions, err = syncResource(ctx, r, "indoor_sessions", stores.Indoor, checkpoint, cursors); err != nil {
+		writeSyncError(w, r, "indoor_sessions", err)
+		return
+	}
+	if resp.OutdoorSessions, err = syncResource(ctx, r, "outdoor_sessions", stores.Outdoor, checkpoint, cursors); err != nil {
+		writeSyncError(w, r, "outdoor_sessions", err)
+		return
+	}
+	if resp.FingerboardSessions, err = syncResource(ctx, r, "fingerboard_sessions", stores.Fingerboard, checkpoint, cursors); err != nil {
+		writeSyncError(w, r, "fingerboard_sessions", err)
+		return
+	}
+	if resp.CompetitionSessions, err = syncResource(ctx, r, "competition_sessions", stores.Competition, checkpoint, cursors); err != nil {
+		writeSyncError(w, r, "competition_sessions", err)
+		return
+	}
+	if resp.GymSessions, err = syncResource(ctx, r, "gym_sessions", stores.Gym, checkpoint, cursors); err != nil {
+		writeSyncError(w, r, "gym_sessions", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// writeSyncError responds to a syncResource failure
+func writeSyncError(w http.ResponseWriter, r *http.Request, collection string, err error) {
+	var paramErr *syncParamError
+	switch {
+	case errors.As(err, &paramErr):
+		writeError(w, r, http.StatusBadRequest, CodeInvalidParameter, paramErr.Error())
+	case errors.Is(err, errResyncRequired):
+		writeDeletedError(w, r, collection, err)
+	default:
+		logFor(r.Context()).Error("sync failed", "collection", collection, "error", err)
+		writeError(w, r, http.StatusInternalServerError, CodeInternal, "Failed to fetch changes")
+	}
+}
+
+type syncParamError struct {
+	param string
+	want  string
+}
+
+func (e *syncParamError) Error() string {
+	return e.param + " must be " + e.want
+}
+
+// syncCheckpoint returns the checkpoint for a resource: its own parameter if
+// present, else since, else the zero time for a full sync
+func syncCheckpoint(r *http.Request, resource string) (time.Time, error) {
+	param := resource
+	value := r.URL.Query().Get(param)
+	if value == "" {
+		param = "since"
+		value = r.URL.Query().Get(param)
+	}
+	if value == "" {
+		return time.Time{}, nil
+	}
+	since, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, &syncParamError{param: param, want: "an RFC 3339 timestamp"}
+	}
+	return since, nil
+}
+
+// syncResource lists a page of the sessions of one resource updated after its
+// checkpoint, and with the first page the sessions deleted after it
+func syncResource[T any, P recordPtr[T]](ctx context.Context, r *http.Request, resource string, store SessionStore[T],
+	checkpoint time.Time, cursors map[string]*syncCursor) (SyncChanges[T], error) {
+	changes := SyncChanges[T]{Upserts: []T{}, Deleted: []Tombstone{}}
+
+	cursor := cursors[resource]
+	if cursor == nil && len(cursors) > 0 {
+		return changes, nil // Continuing other collections only
+	}
+
+	since, err := syncCheckpoint(r, resource)
+	if err != nil {
+		return changes, err
+	}
+
+	if !since.IsZero() && since.Before(time.Now().Add(-TombstoneRetention())) {
+		return changes, errResyncRequired
+	}
+
+	opts := ListOptions{Since: since, Limit: SyncPageSize + 1}
+	if cursor != nil {
+		opts.After = &cursor.Cursor
+	}
+	upserts, err := store.List(ctx, opts)
+	if err != nil {
+		return changes, err
+	}
+	if len(upserts) > SyncPageSize {
+		upserts = upserts[:SyncPageSize]
+		last := P(&upserts[SyncPageSize-1])
+		next := syncCursor{Cursor: Cursor{ID: last.getID()}, Checkpoint: checkpoint}
+		if since.IsZero() {
+			next.Date = last.getDate()
+		} else {
+			next.UpdatedAt = last.getUpdatedAt()
+		}
+		changes.NextCursor = next.encode()
+	}
+	if upserts != nil {
+		changes.Upserts = upserts
+	}
+
+	if since.IsZero() || cursor != nil {
+		// A full sync has nothing deleted from the client's view, and later
+		// pages leave deletions to the first
+		return changes, nil
+	}
+	deleted, err := store.Deleted(ctx, since)
+	if err != nil {
+		return changes, err
+	}
+	if deleted != nil {
+		changes.Deleted = deleted
+	}
+	return changes, nil
+}
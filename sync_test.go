@@ -0,0 +1,170 @@
+package function
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+)
+
+// getSync requests /sync with the given query parameters
+func getSync(t *testing.T, handler http.Handler, query url.Values) SyncResponse {
+	t.Helper()
+	w := request(t, handler, "GET", "/sync?"+query.Encode(), "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("GET /sync?%s: got %d %s", query.Encode(), w.Code, w.Body.String())
+	}
+	var resp SyncResponse
+	decode(t, w, &resp)
+	return resp
+}
+
+func TestSync(t *testing.T) {
+	useMemoryBackend(t)
+	backend := NewMemoryBackend()
+	handler := NewHandler(backend)
+	ctx := context.Background()
+	indoor, gym := backend.Stores("").Indoor, backend.Stores("").Gym
+
+	kept := create(t, indoor, "2024-05-01")
+	removed := create(t, indoor, "2024-05-02")
+	if _, err := gym.Create(ctx, GymSession{Date: "2024-05-03"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// A full sync returns every session and no deletions
+	before := time.Now()
+	full := getSync(t, handler, nil)
+	if n := len(full.IndoorSessions.Upserts); n != 2 {
+		t.Errorf("full sync: %d indoor sessions, want 2", n)
+	}
+	if n := len(full.GymSessions.Upserts); n != 1 {
+		t.Errorf("full sync: %d gym sessions, want 1", n)
+	}
+	if full.IndoorSessions.Deleted == nil || len(full.IndoorSessions.Deleted) != 0 || full.IndoorSessions.NextCursor != "" {
+		t.Errorf("full sync: deleted = %v, nextCursor = %q; want none", full.IndoorSessions.Deleted, full.IndoorSessions.NextCursor)
+	}
+	// The checkpoint trails the server clock by SyncOverlap
+	if lag := before.Sub(full.Checkpoint); lag < SyncOverlap-time.Second || lag > SyncOverlap+time.Second {
+		t.Errorf("checkpoint %s is %s behind the clock, want %s", full.Checkpoint, lag, SyncOverlap)
+	}
+
+	if err := indoor.Delete(ctx, removed.ID, nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := indoor.Update(ctx, kept.ID, func(s *IndoorSession) error { s.Notes = "edited"; return nil }); err != nil {
+		t.Fatal(err)
+	}
+
+	// Changes made after the checkpoint come back with their tombstones, and
+	// the overlap re-delivers sessions written just before it
+	next := getSync(t, handler, url.Values{"since": {full.Checkpoint.Format(time.RFC3339Nano)}})
+	if got := next.IndoorSessions.Upserts; len(got) != 1 || got[0].ID != kept.ID || got[0].Notes != "edited" {
+		t.Errorf("since sync: indoor upserts = %+v, want the edited session", got)
+	}
+	if got := next.IndoorSessions.Deleted; len(got) != 1 || got[0].ID != removed.ID || got[0].Collection != IndoorCollection {
+		t.Errorf("since sync: indoor deleted = %+v, want %s", got, removed.ID)
+	}
+	if n := len(next.GymSessions.Upserts); n != 1 {
+		t.Errorf("since sync within SyncOverlap of the write: %d gym sessions, want 1", n)
+	}
+
+	// A per-collection checkpoint overrides since
+	later := time.Now().Add(time.Minute).Format(time.RFC3339)
+	partial := getSync(t, handler, url.Values{"since": {full.Checkpoint.Format(time.RFC3339Nano)}, "indoor_sessions": {later}})
+	if n, d := len(partial.IndoorSessions.Upserts), len(partial.IndoorSessions.Deleted); n != 0 || d != 0 {
+		t.Errorf("indoor checkpoint in the future: %d upserts, %d deleted; want none", n, d)
+	}
+	if n := len(partial.GymSessions.Upserts); n != 1 {
+		t.Errorf("gym with since: %d sessions, want 1", n)
+	}
+
+	for _, tt := range []struct {
+		query  string
+		status int
+	}{
+		{"since=yesterday", http.StatusBadRequest},
+		{"gym_sessions=2024-13-01T00:00:00Z", http.StatusBadRequest},
+		{"gym_sessions_cursor=garbage", http.StatusBadRequest},
+		{"since=" + time.Now().Add(-TombstoneRetention()-time.Hour).UTC().Format(time.RFC3339), http.StatusGone},
+	} {
+		if w := request(t, handler, "GET", "/sync?"+tt.query, ""); w.Code != tt.status {
+			t.Errorf("GET /sync?%s: got %d %s, want %d", tt.query, w.Code, w.Body.String(), tt.status)
+		}
+	}
+}
+
+func TestSyncPages(t *testing.T) {
+	useMemoryBackend(t)
+	backend := NewMemoryBackend()
+	handler := NewHandler(backend)
+	ctx := context.Background()
+	indoor := backend.Stores("").Indoor
+
+	const total = SyncPageSize + 20
+	for i := 0; i < total; i++ {
+		if _, err := indoor.Create(ctx, IndoorSession{Date: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC).AddDate(0, 0, i%365).Format(DateLayout)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	removed := create(t, backend.Stores("").Gym, "2024-05-01")
+	since := time.Now().Add(-time.Hour).Format(time.RFC3339)
+	if err := backend.Stores("").Gym.Delete(ctx, removed.ID, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, query := range map[string]url.Values{"full": {}, "since": {"since": {since}}} {
+		t.Run(name, func(t *testing.T) {
+			first := getSync(t, handler, query)
+			if n := len(first.IndoorSessions.Upserts); n != SyncPageSize || first.IndoorSessions.NextCursor == "" {
+				t.Fatalf("first page: %d sessions, nextCursor %q; want %d and a cursor", n, first.IndoorSessions.NextCursor, SyncPageSize)
+			}
+			if name == "since" && len(first.GymSessions.Deleted) != 1 {
+				t.Errorf("first page: gym deleted = %+v, want the tombstone", first.GymSessions.Deleted)
+			}
+
+			seen := map[string]bool{}
+			for _, s := range first.IndoorSessions.Upserts {
+				seen[s.ID] = true
+			}
+			// Add a session while paging: it is ahead of the cursor, and the
+			// carried checkpoint makes the next sync deliver it
+			added := create(t, indoor, "2024-12-31")
+			t.Cleanup(func() { indoor.Delete(ctx, added.ID, nil) })
+
+			page := url.Values{"indoor_sessions_cursor": {first.IndoorSessions.NextCursor}}
+			for k, v := range query {
+				page[k] = v
+			}
+			second := getSync(t, handler, page)
+			if !second.Checkpoint.Equal(first.Checkpoint) {
+				t.Errorf("second page checkpoint = %s, want the first page's %s", second.Checkpoint, first.Checkpoint)
+			}
+			if second.IndoorSessions.NextCursor != "" {
+				t.Errorf("second page has a nextCursor")
+			}
+			if len(second.GymSessions.Upserts) != 0 || len(second.GymSessions.Deleted) != 0 {
+				t.Errorf("second page repeated the gym collection: %+v", second.GymSessions)
+			}
+			for _, s := range second.IndoorSessions.Upserts {
+				if seen[s.ID] {
+					t.Errorf("session %s on both pages", s.ID)
+				}
+				seen[s.ID] = true
+			}
+			if len(seen) != total {
+				t.Errorf("pages hold %d sessions, want %d", len(seen), total)
+			}
+
+			after := getSync(t, handler, url.Values{"since": {second.Checkpoint.Format(time.RFC3339Nano)}})
+			found := false
+			for _, s := range after.IndoorSessions.Upserts {
+				found = found || s.ID == added.ID
+			}
+			if !found {
+				t.Errorf("session added while paging is missing from the next sync")
+			}
+		})
+	}
+}
@@ -0,0 +1,69 @@
+package function
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"time"
+)
+
+// DefaultTombstoneRetention is how long deletions are remembered for since-sync
+// unless TOMBSTONE_RETENTION overrides it
+const DefaultTombstoneRetention = 30 * 24 * time.Hour
+
+// Tombstone records a deleted session so incremental sync can report it
+type Tombstone struct {
+	ID         string    `json:"id" firestore:"id"`
+	Collection string    `json:"collection" firestore:"collection"`
+	DeletedAt  time.Time `json:"deletedAt" firestore:"deletedAt"`
+}
+
+// errResyncRequired means the since checkpoint predates the tombstone
+// retention window, so deletions may have been forgotten
+var errResyncRequired = errors.New("since is older than the tombstone retention period")
+
+// TombstoneRetention returns the configured tombstone retention period
+func TombstoneRetention() time.Duration {
+	if d, err := time.ParseDuration(os.Getenv("TOMBSTONE_RETENTION")); err == nil && d > 0 {
+		return d
+	}
+	return DefaultTombstoneRetention
+}
+
+// listDeleted returns the tombstones to include in a since-sync list response,
+// or nil when the client did not ask for them with includeDeleted=true.
+// They are only sent with the first page of a paged listing.
+func listDeleted[T any](ctx context.Context, r *http.Request, store SessionStore[T], opts ListOptions) ([]Tombstone, error) {
+	if r.URL.Query().Get("includeDeleted") != "true" || opts.Since.IsZero() || opts.After != nil {
+		return nil, nil
+	}
+	if opts.Since.Before(time.Now().Add(-TombstoneRetention())) {
+		return nil, errResyncRequired
+	}
+
+	deleted, err := store.Deleted(ctx, opts.Since)
+	if err != nil {
+		return nil, err
+	}
+	if deleted == nil {
+		deleted = []Tombstone{}
+	}
+	return deleted, nil
+}
+
+// writeDeletedError responds to a listDeleted failure
+func writeDeletedError(w http.ResponseWriter, r *http.Request, collection string, err error) {
+	if errors.Is(err, errResyncRequired) {
+		writeError(w, r, http.StatusGone, CodeResyncRequired, "Checkpoint is too old, a full resync is required")
+		return
+	}
+	logFor(r.Context()).Error("list deleted sessions failed", "collection", collection, "error", err)
+	writeError(w, r, http.StatusInternalServerError, CodeInternal, "Failed to fetch deleted sessions")
+}
+
+// purgeTombstones drops tombstones past the retention period. It runs
+// opportunistically after deletes, so failures are ignored.
+func purgeTombstones[T any](ctx context.Context, store SessionStore[T]) {
+	store.PurgeTombstones(ctx, time.Now().Add(-TombstoneRetention()))
+}
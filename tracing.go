@@ -0,0 +1,135 @@
+package function
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracer creates every WorkoutAPI span. Until SetupTracing installs a
+// provider it is a no-op.
+var tracer = otel.Tracer("github.com/yourname/func-workout-api")
+
+var (
+	tracingOnce     sync.Once
+	tracingShutdown = func(context.Context) error { return nil }
+	tracingErr      error
+	tracingErrOnce  sync.Once // WorkoutAPI reports a bad configuration once, not per request
+)
+
+// SetupTracing installs the OpenTelemetry tracer provider selected by
+// OTEL_TRACES_EXPORTER:
+//
+//	otlp     export over OTLP/HTTP, configured by the standard OTEL_EXPORTER_OTLP_* variables
+//	console  pretty-print spans to stdout for local inspection
+//	none     (or unset) tracing disabled
+//
+// Spans are sampled per OTEL_TRACES_SAMPLER and tagged with OTEL_SERVICE_NAME,
+// default workoutapi.
+// Incoming W3C traceparent headers are honoured. Only the first call has any
+// effect; the returned function flushes and stops the exporter.
+func SetupTracing() (func(context.Context) error, error) {
+	tracingOnce.Do(func() {
+		var exporter sdktrace.SpanExporter
+		switch name := os.Getenv("OTEL_TRACES_EXPORTER"); name {
+		case "", "none":
+			return
+		case "otlp":
+			exporter, tracingErr = otlptracehttp.New(context.Background())
+		case "console", "stdout":
+			exporter, tracingErr = stdouttrace.New(stdouttrace.WithPrettyPrint())
+		default:
+			tracingErr = fmt.Errorf("unknown OTEL_TRACES_EXPORTER %q", name)
+		}
+		if tracingErr != nil {
+			return
+		}
+
+		// OTEL_SERVICE_NAME and OTEL_RESOURCE_ATTRIBUTES override the default name
+		res, err := resource.New(context.Background(),
+			resource.WithAttributes(attribute.String("service.name", "workoutapi")),
+			resource.WithFromEnv(), resource.WithTelemetrySDK())
+		if err != nil {
+			tracingErr = err
+			return
+		}
+		provider := sdktrace.NewTracerProvider(sdktrace.WithBatcher(exporter), sdktrace.WithResource(res))
+		otel.SetTracerProvider(provider)
+		otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+		tracingShutdown = provider.Shutdown
+	})
+	return tracingShutdown, tracingErr
+}
+
+// startRequestSpan starts the server span for a request, continuing the
+// caller's trace if it sent one
+func startRequestSpan(r *http.Request) (*http.Request, trace.Span) {
+	ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+	ctx, span := tracer.Start(ctx, "WorkoutAPI "+r.Method, trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(
+			attribute.String("http.request.method", r.Method),
+			attribute.String("url.path", r.URL.Path),
+		))
+	return r.WithContext(ctx), span
+}
+
+// endRequestSpan names the span after the route and records the outcome
+func endRequestSpan(span trace.Span, r *http.Request, status int) {
+	route := routeOf(r.URL.Path)
+	span.SetName(r.Method + " " + route)
+	span.SetAttributes(
+		attribute.String("http.route", route),
+		attribute.Int("http.response.status_code", status),
+		attribute.String("request.id", RequestIDFromContext(r.Context())),
+	)
+	if status >= 500 {
+		span.SetStatus(codes.Error, http.StatusText(status))
+	}
+	span.End()
+}
+
+// startHandlerSpan starts the span for a CRUD handler, tagged with the session
+// ID when the handler has one
+func startHandlerSpan(r *http.Request, name, id string) (context.Context, trace.Span) {
+	ctx, span := tracer.Start(r.Context(), name)
+	if id != "" {
+		span.SetAttributes(attribute.String("session.id", id))
+	}
+	return ctx, span
+}
+
+// startStoreSpan starts the span for a store operation on collection
+func startStoreSpan(ctx context.Context, collection, operation, id string) (context.Context, trace.Span) {
+	ctx, span := tracer.Start(ctx, operation+" "+collection, trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("db.collection.name", collection),
+			attribute.String("db.operation.name", operation),
+		))
+	if id != "" {
+		span.SetAttributes(attribute.String("session.id", id))
+	}
+	return ctx, span
+}
+
+// endStoreSpan records how a store operation ended. A missing session or a
+// failed precondition is an expected outcome, not a span error.
+func endStoreSpan(span trace.Span, err error) {
+	if err != nil && !errors.Is(err, ErrNotFound) && !errors.Is(err, errPreconditionFailed) {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
@@ -0,0 +1,99 @@
+package function
+
+import (
+	"net/http"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// recordSpans sends every span to a recorder for the rest of the test
+func recordSpans(t *testing.T) *tracetest.SpanRecorder {
+	t.Helper()
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	saved := tracer
+	tracer = provider.Tracer("test")
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	t.Cleanup(func() { tracer = saved })
+	return recorder
+}
+
+// spanAttr returns the value of attribute key on span, or ""
+func spanAttr(span sdktrace.ReadOnlySpan, key attribute.Key) string {
+	for _, kv := range span.Attributes() {
+		if kv.Key == key {
+			return kv.Value.Emit()
+		}
+	}
+	return ""
+}
+
+func TestRequestSpans(t *testing.T) {
+	useMemoryBackend(t)
+	recorder := recordSpans(t)
+	handler := NewHandler(NewMemoryBackend())
+
+	w := request(t, handler, "POST", "/indoor_sessions", `{"date":"2024-05-01"}`)
+	var session IndoorSession
+	decode(t, w, &session)
+
+	const traceparent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	if w := request(t, handler, "GET", "/indoor_sessions/"+session.ID, "", "traceparent", traceparent); w.Code != http.StatusOK {
+		t.Fatalf("GET: got %d %s", w.Code, w.Body.String())
+	}
+
+	spans := map[string]sdktrace.ReadOnlySpan{}
+	for _, span := range recorder.Ended() {
+		if span.SpanContext().TraceID().String() == "4bf92f3577b34da6a3ce929d0e0e4736" {
+			spans[span.Name()] = span
+		}
+	}
+	server, handlerSpan, store := spans["GET /indoor_sessions/{id}"], spans["GetIndoorSession"], spans["get indoor_sessions"]
+	if server == nil || handlerSpan == nil || store == nil {
+		names := make([]string, 0, len(spans))
+		for name := range spans {
+			names = append(names, name)
+		}
+		t.Fatalf("spans in the incoming trace = %v, want server, handler and store spans", names)
+	}
+
+	if server.SpanKind() != trace.SpanKindServer || !server.Parent().IsRemote() || server.Parent().SpanID().String() != "00f067aa0ba902b7" {
+		t.Errorf("server span kind %v, parent %v: want a server span continuing the traceparent", server.SpanKind(), server.Parent())
+	}
+	if handlerSpan.Parent().SpanID() != server.SpanContext().SpanID() {
+		t.Errorf("handler span parent = %v, want the server span", handlerSpan.Parent().SpanID())
+	}
+	if store.SpanKind() != trace.SpanKindClient || store.Parent().SpanID() != handlerSpan.SpanContext().SpanID() {
+		t.Errorf("store span kind %v, parent %v: want a client span under the handler span", store.SpanKind(), store.Parent().SpanID())
+	}
+
+	if got := spanAttr(server, "http.route"); got != "/indoor_sessions/{id}" {
+		t.Errorf("server span http.route = %q", got)
+	}
+	if got := spanAttr(handlerSpan, "session.id"); got != session.ID {
+		t.Errorf("handler span session.id = %q, want %q", got, session.ID)
+	}
+	if got := spanAttr(store, "db.collection.name"); got != "indoor_sessions" {
+		t.Errorf("store span db.collection.name = %q, want indoor_sessions", got)
+	}
+	if got := spanAttr(store, "session.id"); got != session.ID {
+		t.Errorf("store span session.id = %q, want %q", got, session.ID)
+	}
+
+	// Without a traceparent the server span starts a new trace
+	var post sdktrace.ReadOnlySpan
+	for _, span := range recorder.Ended() {
+		if span.Name() == "POST /indoor_sessions" {
+			post = span
+		}
+	}
+	if post == nil || post.Parent().IsValid() || post.SpanContext().TraceID() == server.SpanContext().TraceID() {
+		t.Errorf("POST server span = %v, want a root span in its own trace", post)
+	}
+}
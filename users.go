@@ -0,0 +1,193 @@
+package function
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// TokenPrefix starts every API token so they are easy to recognise in config and logs
+const TokenPrefix = "wk_"
+
+// User is a climber whose sessions are kept apart from everyone else's
+type User struct {
+	ID        string    `json:"id" firestore:"-"`
+	Name      string    `json:"name" firestore:"name"`
+	CreatedAt time.Time `json:"createdAt" firestore:"createdAt"`
+}
+
+// APIToken is a per-user credential sent as x-api-key. Only a hash of the
+// secret is stored; the secret itself is returned once, when it is issued.
+type APIToken struct {
+	ID        string    `json:"id" firestore:"-"`
+	UserID    string    `json:"userId" firestore:"userId"`
+	Name      string    `json:"name" firestore:"name"`
+	Scopes    []string  `json:"scopes" firestore:"scopes,omitempty"` // nil for an unrestricted token
+	Hash      string    `json:"-" firestore:"hash"`
+	CreatedAt time.Time `json:"createdAt" firestore:"createdAt"`
+}
+
+// UserStore persists users and their API tokens
+type UserStore interface {
+	CreateUser(ctx context.Context, name string) (User, error)
+	GetUser(ctx context.Context, id string) (User, error)
+	ListUsers(ctx context.Context) ([]User, error)
+	// CreateToken stores a token with Hash already set and assigns its ID
+	CreateToken(ctx context.Context, token APIToken) (APIToken, error)
+	GetToken(ctx context.Context, id string) (APIToken, error)
+	ListTokens(ctx context.Context, userID string) ([]APIToken, error)
+	// RevokeToken deletes one of the user's tokens
+	RevokeToken(ctx context.Context, userID, id string) error
+	// TokenByHash returns the token whose secret hashes to hash, or ErrNotFound
+	TokenByHash(ctx context.Context, hash string) (APIToken, error)
+}
+
+// Backend is a storage backend holding the users registry and every user's sessions
+type Backend interface {
+	Users() UserStore
+	// Stores returns the session stores owned by userID. The empty user ID
+	// selects the shared top-level collections used with admin keys.
+	Stores(userID string) *Stores
+	Idempotency() IdempotencyStore
+}
+
+// newTokenSecret returns a fresh random API token
+func newTokenSecret() string {
+	return TokenPrefix + newDocumentID() + newDocumentID()
+}
+
+// hashToken returns the stored form of an API token secret
+func hashToken(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// issuedToken is the response to POST /users/{id}/tokens, the only time the
+// secret is ever shown
+type issuedToken struct {
+	APIToken
+	Secret string `json:"secret"`
+}
+
+// HandleUsers serves the admin routes for managing users and their tokens:
+//
+//	GET  /users, POST /users, GET /users/{id}
+//	GET  /users/{id}/tokens, POST /users/{id}/tokens
+//	DELETE /users/{id}/tokens/{tokenId}
+func HandleUsers(w http.ResponseWriter, r *http.Request, users UserStore) {
+	ctx := r.Context()
+
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	method := r.Method
+
+	switch {
+	case len(parts) == 1 && method == "GET":
+		list, err := users.ListUsers(ctx)
+		if err != nil {
+			logFor(ctx).Error("list users failed", "error", err)
+			writeError(w, r, http.StatusInternalServerError, CodeInternal, "Failed to fetch users")
+			return
+		}
+		if list == nil {
+			list = []User{}
+		}
+		writeJSON(w, http.StatusOK, list)
+
+	case len(parts) == 1 && method == "POST":
+		var input struct {
+			Name string `json:"name"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+			writeError(w, r, http.StatusBadRequest, CodeInvalidBody, "Invalid request body")
+			return
+		}
+		if strings.TrimSpace(input.Name) == "" {
+			writeValidationError(w, r, &ValidationError{Fields: []FieldError{{Field: "name", Message: "is required"}}})
+			return
+		}
+		user, err := users.CreateUser(ctx, input.Name)
+		if err != nil {
+			logFor(ctx).Error("create user failed", "error", err)
+			writeError(w, r, http.StatusInternalServerError, CodeInternal, "Failed to create user")
+			return
+		}
+		writeJSON(w, http.StatusCreated, user)
+
+	case len(parts) == 2 && method == "GET":
+		user, err := users.GetUser(ctx, parts[1])
+		if err != nil {
+			writeUserError(w, r, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, user)
+
+	case len(parts) == 3 && parts[2] == "tokens" && method == "GET":
+		if _, err := users.GetUser(ctx, parts[1]); err != nil {
+			writeUserError(w, r, err)
+			return
+		}
+		tokens, err := users.ListTokens(ctx, parts[1])
+		if err != nil {
+			logFor(ctx).Error("list tokens failed", "userId", parts[1], "error", err)
+			writeError(w, r, http.StatusInternalServerError, CodeInternal, "Failed to fetch tokens")
+			return
+		}
+		if tokens == nil {
+			tokens = []APIToken{}
+		}
+		writeJSON(w, http.StatusOK, tokens)
+
+	case len(parts) == 3 && parts[2] == "tokens" && method == "POST":
+		var input struct {
+			Name string `json:"name"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+			writeError(w, r, http.StatusBadRequest, CodeInvalidBody, "Invalid request body")
+			return
+		}
+		if _, err := users.GetUser(ctx, parts[1]); err != nil {
+			writeUserError(w, r, err)
+			return
+		}
+		secret := newTokenSecret()
+		token, err := users.CreateToken(ctx, APIToken{UserID: parts[1], Name: input.Name, Hash: hashToken(secret)})
+		if err != nil {
+			logFor(ctx).Error("create token failed", "userId", parts[1], "error", err)
+			writeError(w, r, http.StatusInternalServerError, CodeInternal, "Failed to create token")
+			return
+		}
+		writeJSON(w, http.StatusCreated, issuedToken{APIToken: token, Secret: secret})
+
+	case len(parts) == 4 && parts[2] == "tokens" && method == "DELETE":
+		if err := users.RevokeToken(ctx, parts[1], parts[3]); err != nil {
+			writeUserError(w, r, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		writeError(w, r, http.StatusNotFound, CodeNotFound, "Not found")
+	}
+}
+
+// writeUserError responds to a UserStore lookup failure
+func writeUserError(w http.ResponseWriter, r *http.Request, err error) {
+	if errors.Is(err, ErrNotFound) {
+		writeError(w, r, http.StatusNotFound, CodeNotFound, "Not found")
+		return
+	}
+	logFor(r.Context()).Error("user lookup failed", "error", err)
+	writeError(w, r, http.StatusInternalServerError, CodeInternal, "Failed to fetch user")
+}
+
+// writeJSON writes v as a JSON response with the given status
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
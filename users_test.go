@@ -0,0 +1,109 @@
+package function
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestUsers(t *testing.T) {
+	useMemoryBackend(t)
+	for name, newBackend := range testBackends() {
+		t.Run(name, func(t *testing.T) {
+			handler := NewHandler(newBackend(t))
+
+			if w := request(t, handler, "POST", "/users", `{"name":" "}`); w.Code != http.StatusUnprocessableEntity {
+				t.Errorf("create without a name: got %d %s, want 422", w.Code, w.Body.String())
+			}
+			w := request(t, handler, "POST", "/users", `{"name":"Ada"}`)
+			if w.Code != http.StatusCreated {
+				t.Fatalf("create user: got %d %s", w.Code, w.Body.String())
+			}
+			var user User
+			decode(t, w, &user)
+			if user.ID == "" || user.Name != "Ada" || user.CreatedAt.IsZero() {
+				t.Errorf("created user = %+v", user)
+			}
+
+			var users []User
+			decode(t, request(t, handler, "GET", "/users", ""), &users)
+			if len(users) != 1 || users[0].ID != user.ID {
+				t.Errorf("GET /users = %+v, want Ada", users)
+			}
+			if w := request(t, handler, "GET", "/users/"+user.ID, ""); w.Code != http.StatusOK {
+				t.Errorf("GET /users/%s: got %d", user.ID, w.Code)
+			}
+			if w := request(t, handler, "GET", "/users/missing", ""); w.Code != http.StatusNotFound {
+				t.Errorf("GET a missing user: got %d, want 404", w.Code)
+			}
+			if w := request(t, handler, "POST", "/users/missing/tokens", `{"name":"phone"}`); w.Code != http.StatusNotFound {
+				t.Errorf("token for a missing user: got %d, want 404", w.Code)
+			}
+
+			w = request(t, handler, "POST", "/users/"+user.ID+"/tokens", `{"name":"phone"}`)
+			if w.Code != http.StatusCreated {
+				t.Fatalf("create token: got %d %s", w.Code, w.Body.String())
+			}
+			var token issuedToken
+			decode(t, w, &token)
+			if !strings.HasPrefix(token.Secret, TokenPrefix) || token.UserID != user.ID || token.ID == "" {
+				t.Errorf("issued token = %+v", token)
+			}
+
+			w = request(t, handler, "GET", "/users/"+user.ID+"/tokens", "")
+			var tokens []APIToken
+			decode(t, w, &tokens)
+			if len(tokens) != 1 || tokens[0].ID != token.ID || strings.Contains(w.Body.String(), token.Secret) {
+				t.Errorf("GET tokens = %s, want the token without its secret", w.Body.String())
+			}
+
+			// The token works, reaching only the user's own sessions
+			if w := request(t, handler, "POST", "/indoor_sessions", `{"date":"2024-05-01"}`, "x-api-key", token.Secret); w.Code != http.StatusCreated {
+				t.Fatalf("create as the user: got %d %s", w.Code, w.Body.String())
+			}
+			if n := countSessions(t, handler, "indoor_sessions"); n != 0 {
+				t.Errorf("admin sees %d of the user's sessions", n)
+			}
+
+			// Neither a user's token nor a scoped key can manage users or tokens
+			scoped := mintKey(t, handler, `["*:read","*:write"]`).Secret
+			for _, req := range []struct{ method, path, body string }{
+				{"GET", "/users", ""},
+				{"POST", "/users", `{"name":"Mallory"}`},
+				{"GET", "/users/" + user.ID, ""},
+				{"GET", "/users/" + user.ID + "/tokens", ""},
+				{"POST", "/users/" + user.ID + "/tokens", `{"name":"extra"}`},
+				{"DELETE", "/users/" + user.ID + "/tokens/" + token.ID, ""},
+			} {
+				for _, key := range []string{token.Secret, scoped} {
+					w := request(t, handler, req.method, req.path, req.body, "x-api-key", key)
+					if w.Code != http.StatusForbidden {
+						t.Errorf("%s %s with a non-admin key: got %d %s, want 403", req.method, req.path, w.Code, w.Body.String())
+						continue
+					}
+					var resp errorResponse
+					decode(t, w, &resp)
+					if resp.Error.Code != CodeForbidden {
+						t.Errorf("%s %s: error code = %q, want %q", req.method, req.path, resp.Error.Code, CodeForbidden)
+					}
+				}
+				if w := request(t, handler, req.method, req.path, req.body, "x-api-key", ""); w.Code != http.StatusUnauthorized {
+					t.Errorf("%s %s without a key: got %d, want 401", req.method, req.path, w.Code)
+				}
+			}
+
+			if w := request(t, handler, "DELETE", "/users/"+user.ID+"/tokens/"+token.ID, ""); w.Code != http.StatusNoContent {
+				t.Fatalf("revoke token: got %d %s", w.Code, w.Body.String())
+			}
+			if w := request(t, handler, "GET", "/indoor_sessions", "", "x-api-key", token.Secret); w.Code != http.StatusUnauthorized {
+				t.Errorf("revoked token: got %d, want 401", w.Code)
+			}
+			if w := request(t, handler, "DELETE", "/users/"+user.ID+"/tokens/"+token.ID, ""); w.Code != http.StatusNotFound {
+				t.Errorf("revoke a revoked token: got %d, want 404", w.Code)
+			}
+			if w := request(t, handler, "PUT", "/users/"+user.ID, `{"name":"Ada"}`); w.Code != http.StatusNotFound {
+				t.Errorf("unknown users route: got %d, want 404", w.Code)
+			}
+		})
+	}
+}
@@ -0,0 +1,274 @@
+package function
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Allowed values for the enum-like string fields. An empty value is treated
+// as "not provided" and accepted. climbingType and attemptType are compared
+// case-insensitively, as older clients sent them in lower case.
+var (
+	ClimbingTypes     = []string{"Bouldering", "Sport", "Trad", "Top Rope", "Mixed"}
+	AttemptTypes      = []string{"Onsight", "Flash", "Redpoint", "Repeat", "Attempt"}
+	CompetitionTypes  = []string{"Bouldering", "Lead", "Speed"}
+	CompetitionStatus = []string{"Flash", "Top", "Zone", "Attempt"}
+)
+
+const (
+	DateLayout = "2006-01-02"
+
+	// Body part loads and grip usage are rated on a 0-10 scale
+	MinLoad = 0
+	MaxLoad = 10
+
+	// Array size limits, keeping every session well inside Firestore's 1 MiB document limit
+	MaxClimbs    = 500 // Per session, and per competition round
+	MaxExercises = 100
+	MaxSets      = 100 // Per exercise
+	MaxRounds    = 20
+	MaxTags      = 20 // Entries in each list of labels such as trainingTypes
+)
+
+// FieldError describes one invalid field of a request body
+type FieldError struct {
+	Field   string `json:"field"` // JSON path, e.g. climbs[2].attemptsNum
+	Message string `json:"message"`
+}
+
+// ValidationError lists every invalid field of a request body
+type ValidationError struct {
+	Fields []FieldError `json:"fields"`
+}
+
+func (e *ValidationError) Error() string {
+	msgs := make([]string, len(e.Fields))
+	for i, f := range e.Fields {
+		msgs[i] = f.Field + ": " + f.Message
+	}
+	return "invalid request: " + strings.Join(msgs, "; ")
+}
+
+// without returns e less the field errors also in other whose value same
+// reports unchanged, or nil when none are left. Errors are matched by exact
+// path, so a value that moves to another list index is checked again.
+func (e *ValidationError) without(other *ValidationError, same func(field string) bool) *ValidationError {
+	if other == nil {
+		return e
+	}
+	existing := make(map[FieldError]bool, len(other.Fields))
+	for _, f := range other.Fields {
+		existing[f] = true
+	}
+	var v validator
+	for _, f := range e.Fields {
+		if !existing[f] || !same(f.Field) {
+			v.fields = append(v.fields, f)
+		}
+	}
+	return v.err()
+}
+
+// writeValidationError responds 422 with the offending fields in the error envelope
+func writeValidationError(w http.ResponseWriter, r *http.Request, err *ValidationError) {
+	writeAPIError(w, r, http.StatusUnprocessableEntity, APIError{
+		Code:    CodeValidationFailed,
+		Message: "Validation failed",
+		Fields:  err.Fields,
+	})
+}
+
+// validator accumulates field errors while walking an input
+type validator struct {
+	fields []FieldError
+}
+
+func (v *validator) addf(field, format string, args ...interface{}) {
+	v.fields = append(v.fields, FieldError{Field: field, Message: fmt.Sprintf(format, args...)})
+}
+
+// err returns the accumulated errors, or nil when the input is valid
+func (v *validator) err() *ValidationError {
+	if len(v.fields) == 0 {
+		return nil
+	}
+	return &ValidationError{Fields: v.fields}
+}
+
+func (v *validator) date(field, value string) {
+	if value == "" {
+		v.addf(field, "is required")
+		return
+	}
+	if _, err := time.Parse(DateLayout, value); err != nil {
+		v.addf(field, "must be a valid date in YYYY-MM-DD format")
+	}
+}
+
+func (v *validator) oneOf(field, value string, allowed []string) {
+	v.match(field, value, allowed, func(a, b string) bool { return a == b })
+}
+
+// oneOfFold is oneOf ignoring case
+func (v *validator) oneOfFold(field, value string, allowed []string) {
+	v.match(field, value, allowed, strings.EqualFold)
+}
+
+func (v *validator) match(field, value string, allowed []string, equal func(a, b string) bool) {
+	if value == "" {
+		return
+	}
+	for _, a := range allowed {
+		if equal(value, a) {
+			return
+		}
+	}
+	v.addf(field, "must be one of %s", strings.Join(allowed, ", "))
+}
+
+func (v *validator) load(field string, value int) {
+	if value < MinLoad || value > MaxLoad {
+		v.addf(field, "must be between %d and %d", MinLoad, MaxLoad)
+	}
+}
+
+func (v *validator) nonNegative(field string, value float64) {
+	if value < 0 {
+		v.addf(field, "must not be negative")
+	}
+}
+
+// maxItems reports a list longer than max, returning false so callers can
+// skip walking it
+func (v *validator) maxItems(field string, n, max int) bool {
+	if n > max {
+		v.addf(field, "must not have more than %d items", max)
+		return false
+	}
+	return true
+}
+
+func (v *validator) climbs(climbs []ClimbEntry) {
+	if !v.maxItems("climbs", len(climbs), MaxClimbs) {
+		return
+	}
+	for i, c := range climbs {
+		path := fmt.Sprintf("climbs[%d].", i)
+		v.oneOfFold(path+"attemptType", c.AttemptType, AttemptTypes)
+		v.nonNegative(path+"attemptsNum", float64(c.AttemptsNum))
+	}
+}
+
+func (v *validator) grips(open, crimp, pinch, sloper, jug int) {
+	v.load("openGrip", open)
+	v.load("crimpGrip", crimp)
+	v.load("pinchGrip", pinch)
+	v.load("sloperGrip", sloper)
+	v.load("jugGrip", jug)
+}
+
+// Validate checks an indoor session create/update request
+func (in IndoorSessionInput) Validate() *ValidationError {
+	var v validator
+	v.date("date", in.Date)
+	v.oneOfFold("climbingType", in.ClimbingType, ClimbingTypes)
+	v.load("fingerLoad", in.FingerLoad)
+	v.load("shoulderLoad", in.ShoulderLoad)
+	v.load("forearmLoad", in.ForearmLoad)
+	v.grips(in.OpenGrip, in.CrimpGrip, in.PinchGrip, in.SloperGrip, in.JugGrip)
+	v.maxItems("trainingTypes", len(in.TrainingTypes), MaxTags)
+	v.maxItems("categories", len(in.Categories), MaxTags)
+	v.maxItems("energySystems", len(in.EnergySystems), MaxTags)
+	v.maxItems("wallAngles", len(in.WallAngles), MaxTags)
+	v.climbs(in.Climbs)
+	return v.err()
+}
+
+// Validate checks an outdoor session create/update request
+func (in OutdoorSessionInput) Validate() *ValidationError {
+	var v validator
+	v.date("date", in.Date)
+	v.oneOfFold("climbingType", in.ClimbingType, ClimbingTypes)
+	v.load("fingerLoad", in.FingerLoad)
+	v.load("shoulderLoad", in.ShoulderLoad)
+	v.load("forearmLoad", in.ForearmLoad)
+	v.grips(in.OpenGrip, in.CrimpGrip, in.PinchGrip, in.SloperGrip, in.JugGrip)
+	v.maxItems("trainingTypes", len(in.TrainingTypes), MaxTags)
+	v.maxItems("categories", len(in.Categories), MaxTags)
+	v.maxItems("energySystems", len(in.EnergySystems), MaxTags)
+	v.climbs(in.Climbs)
+	return v.err()
+}
+
+// Validate checks a fingerboard session create/update request
+func (in FingerboardSessionInput) Validate() *ValidationError {
+	var v validator
+	v.date("date", in.Date)
+	if !v.maxItems("exercises", len(in.Exercises), MaxExercises) {
+		return v.err()
+	}
+	for i, e := range in.Exercises {
+		path := fmt.Sprintf("exercises[%d].", i)
+		v.nonNegative(path+"sets", float64(e.Sets))
+		if !v.maxItems(path+"details", len(e.Details), MaxSets) {
+			continue
+		}
+		for j, set := range e.Details {
+			setPath := fmt.Sprintf("%sdetails[%d].", path, j)
+			v.nonNegative(setPath+"weight", set.Weight)
+			v.nonNegative(setPath+"reps", float64(set.Reps))
+		}
+	}
+	return v.err()
+}
+
+// Validate checks a competition session create/update request
+func (in CompetitionSessionInput) Validate() *ValidationError {
+	var v validator
+	v.date("date", in.Date)
+	v.oneOf("type", in.Type, CompetitionTypes)
+	v.load("fingerLoad", in.FingerLoad)
+	v.load("shoulderLoad", in.ShoulderLoad)
+	v.load("forearmLoad", in.ForearmLoad)
+	if !v.maxItems("rounds", len(in.Rounds), MaxRounds) {
+		return v.err()
+	}
+	for i, round := range in.Rounds {
+		path := fmt.Sprintf("rounds[%d].", i)
+		if round.Position != nil && *round.Position < 1 {
+			v.addf(path+"position", "must be at least 1")
+		}
+		if !v.maxItems(path+"climbs", len(round.Climbs), MaxClimbs) {
+			continue
+		}
+		for j, c := range round.Climbs {
+			climbPath := fmt.Sprintf("%sclimbs[%d].", path, j)
+			v.oneOf(climbPath+"status", c.Status, CompetitionStatus)
+			v.nonNegative(climbPath+"attemptCount", float64(c.AttemptCount))
+		}
+	}
+	return v.err()
+}
+
+// Validate checks a gym session create/update request
+func (in GymSessionInput) Validate() *ValidationError {
+	var v validator
+	v.date("date", in.Date)
+	v.nonNegative("bodyweight", in.Bodyweight)
+	if !v.maxItems("exercises", len(in.Exercises), MaxExercises) {
+		return v.err()
+	}
+	for i, e := range in.Exercises {
+		if !v.maxItems(fmt.Sprintf("exercises[%d].sets", i), len(e.Sets), MaxSets) {
+			continue
+		}
+		for j, set := range e.Sets {
+			path := fmt.Sprintf("exercises[%d].sets[%d].", i, j)
+			v.nonNegative(path+"weight", set.Weight)
+			v.nonNegative(path+"reps", float64(set.Reps))
+		}
+	}
+	return v.err()
+}
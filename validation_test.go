@@ -0,0 +1,140 @@
+package function
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	position := 0
+	tests := []struct {
+		name  string
+		input interface{ Validate() *ValidationError }
+		want  []string // Offending field paths
+	}{
+		{"indoor minimal", IndoorSessionInput{Date: "2024-05-01"}, nil},
+		{"indoor valid", IndoorSessionInput{
+			Date: "2024-05-01", ClimbingType: "Bouldering", FingerLoad: 10, JugGrip: 0,
+			Climbs: []ClimbEntry{{AttemptType: "Flash", AttemptsNum: 2}},
+		}, nil},
+		{"indoor legacy casing", IndoorSessionInput{
+			Date: "2024-05-01", ClimbingType: "top rope",
+			Climbs: []ClimbEntry{{AttemptType: "REDPOINT"}},
+		}, nil},
+		{"indoor invalid", IndoorSessionInput{
+			Date: "2024-13-45", ClimbingType: "Indoor Bouldering", FingerLoad: 9000, ShoulderLoad: -1, CrimpGrip: 11,
+			Climbs: []ClimbEntry{{}, {AttemptType: "Sent first go"}, {AttemptsNum: -1}},
+		}, []string{"date", "climbingType", "fingerLoad", "shoulderLoad", "crimpGrip", "climbs[1].attemptType", "climbs[2].attemptsNum"}},
+		{"outdoor invalid", OutdoorSessionInput{ClimbingType: "Alpine", ForearmLoad: 9000}, []string{"date", "climbingType", "forearmLoad"}},
+		{"fingerboard invalid set", FingerboardSessionInput{
+			Date:      "2024-05-01",
+			Exercises: []FingerboardExercise{{Details: []ExerciseSet{{Weight: -5, Reps: 3}}}},
+		}, []string{"exercises[0].details[0].weight"}},
+		{"competition enums", CompetitionSessionInput{
+			Date: "2024-05-01", Type: "Climbing",
+			Rounds: []CompetitionRound{{Position: &position, Climbs: []CompetitionClimbResult{{Status: "Sent"}}}},
+		}, []string{"type", "rounds[0].position", "rounds[0].climbs[0].status"}},
+		{"competition valid", CompetitionSessionInput{
+			Date: "2024-05-01", Type: "Lead",
+			Rounds: []CompetitionRound{{Climbs: []CompetitionClimbResult{{Status: "Top"}}}},
+		}, nil},
+		{"gym invalid", GymSessionInput{
+			Date: "2024-05-01", Bodyweight: -70,
+			Exercises: []GymExercise{{Sets: []GymSet{{Reps: -1}}}},
+		}, []string{"bodyweight", "exercises[0].sets[0].reps"}},
+		{"too many climbs", IndoorSessionInput{Date: "2024-05-01", Climbs: make([]ClimbEntry, MaxClimbs+1)}, []string{"climbs"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			if verr := tt.input.Validate(); verr != nil {
+				for _, f := range verr.Fields {
+					got = append(got, f.Field)
+				}
+			}
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("Validate fields = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestPatchLegacySession checks that sessions stored before validation
+// existed can still be patched, keeping their invalid values, while the
+// values a patch sets are validated
+func TestPatchLegacySession(t *testing.T) {
+	useMemoryBackend(t)
+	backend := NewMemoryBackend()
+	stored, err := backend.Stores("").Indoor.Create(context.Background(), IndoorSession{
+		Date: "2023-01-01", ClimbingType: "Boulder (indoor)", FingerLoad: 80,
+		Climbs: []ClimbEntry{{Grade: "V3", AttemptsNum: -1}, {Grade: "V2"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := NewHandler(backend)
+	patch := func(body string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest("PATCH", "/indoor_sessions/"+stored.ID, strings.NewReader(body))
+		r.Header.Set("Content-Type", MergePatchMediaType)
+		if strings.HasPrefix(body, "[") {
+			r.Header.Set("Content-Type", JSONPatchMediaType)
+		}
+		r.Header.Set("x-api-key", testAdminKey)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w
+	}
+
+	w := patch(`{"notes":"Added later"}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("PATCH legacy session: got %d %s", w.Code, w.Body.String())
+	}
+	var got IndoorSession
+	decode(t, w, &got)
+	if got.Notes != "Added later" || got.ClimbingType != "Boulder (indoor)" || got.FingerLoad != 80 ||
+		len(got.Climbs) != 2 || got.Climbs[0].AttemptsNum != -1 {
+		t.Errorf("PATCH result = %+v", got)
+	}
+
+	invalid := []struct {
+		name, body string
+		fields     []string
+	}{
+		{"invalid load", `{"shoulderLoad":9000}`, []string{"shoulderLoad"}},
+		{"new climbs after the legacy value",
+			`[{"op":"replace","path":"/climbs","value":[{"attemptsNum":-1},{"attemptsNum":-99},{"attemptsNum":-7}]}]`,
+			[]string{"climbs[1].attemptsNum", "climbs[2].attemptsNum"}},
+		{"changed legacy value", `[{"op":"replace","path":"/climbs/0/attemptsNum","value":-1000}]`, []string{"climbs[0].attemptsNum"}},
+		{"legacy value moved to another climb", `[{"op":"move","from":"/climbs/0","path":"/climbs/1"}]`, []string{"climbs[1].attemptsNum"}},
+	}
+	for _, tt := range invalid {
+		w = patch(tt.body)
+		if w.Code != http.StatusUnprocessableEntity {
+			t.Fatalf("PATCH with %s: got %d %s", tt.name, w.Code, w.Body.String())
+		}
+		var resp errorResponse
+		decode(t, w, &resp)
+		var fields []string
+		for _, f := range resp.Error.Fields {
+			fields = append(fields, f.Field)
+		}
+		if !reflect.DeepEqual(fields, tt.fields) {
+			t.Errorf("PATCH with %s: fields = %v, want %v", tt.name, fields, tt.fields)
+		}
+	}
+
+	w = patch(`[{"op":"remove","path":"/climbs/0"}]`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("PATCH removing the legacy climb: got %d %s", w.Code, w.Body.String())
+	}
+	got = IndoorSession{}
+	decode(t, w, &got)
+	if len(got.Climbs) != 1 || got.Climbs[0].Grade != "V2" {
+		t.Errorf("PATCH removing the legacy climb: climbs = %+v", got.Climbs)
+	}
+}